@@ -21,7 +21,6 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/web3coach/the-blockchain-bar/database"
-	"github.com/web3coach/the-blockchain-bar/node"
 )
 
 func balancesCmd() *cobra.Command {
@@ -45,7 +44,7 @@ func balancesListCmd() *cobra.Command {
 		Use:   "list",
 		Short: "Lists all balances.",
 		Run: func(cmd *cobra.Command, args []string) {
-			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd), node.DefaultMiningDifficulty)
+			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd), 0)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
@@ -56,7 +55,14 @@ func balancesListCmd() *cobra.Command {
 			fmt.Println("__________________")
 			fmt.Println("")
 			for account, balance := range state.Balances {
-				fmt.Println(fmt.Sprintf("%s: %d", account.String(), balance))
+				symbol := state.Genesis().Symbol
+				locked := state.LockedBalance(account)
+				if locked.IsZero() {
+					fmt.Println(fmt.Sprintf("%s: %s %s", account.String(), state.FormatAmount(balance), symbol))
+					continue
+				}
+
+				fmt.Println(fmt.Sprintf("%s: %s %s (spendable: %s %s, locked: %s %s)", account.String(), state.FormatAmount(balance), symbol, state.FormatAmount(state.SpendableBalance(account)), symbol, state.FormatAmount(locked), symbol))
 			}
 			fmt.Println("")
 			fmt.Printf("Accounts nonces:")
@@ -0,0 +1,130 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/web3coach/the-blockchain-bar/database"
+)
+
+func dbCmd() *cobra.Command {
+	var dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Manages the node's blockchain database (migrate, repair, reindex...).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	dbCmd.AddCommand(dbMigrateCmd())
+	dbCmd.AddCommand(dbRepairCmd())
+	dbCmd.AddCommand(dbReindexCmd())
+
+	return dbCmd
+}
+
+func dbMigrateCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Moves all blocks into a different block store and configures the data dir to use it.",
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+			blockStore, _ := cmd.Flags().GetString(flagBlockStore)
+
+			// Initializes the data dir if necessary and validates the current chain before migrating it
+			state, err := database.NewStateFromDisk(dataDir, 0)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			_ = state.Close()
+
+			err = database.MigrateBlockStore(dataDir, blockStore)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Block store of %s is now: %s\n", dataDir, blockStore)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagBlockStore, database.BlockStoreLevelDB, fmt.Sprintf("block store to migrate to: %s or %s", database.BlockStoreFile, database.BlockStoreLevelDB))
+
+	return cmd
+}
+
+func dbRepairCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "repair",
+		Short: "Reports corrupted blocks and removes them, together with all following blocks, so the node can sync them again.",
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+
+			report, err := database.RepairBlockStore(dataDir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Block store: %s\n", report.BlockStore)
+			fmt.Printf("Valid blocks: %d\n", report.ValidBlocks)
+
+			if len(report.Corrupted) == 0 {
+				fmt.Println("No corrupted blocks found.")
+				return
+			}
+
+			fmt.Println("Corrupted blocks:")
+			for _, record := range report.Corrupted {
+				fmt.Printf("\t- %s: %s\n", record.Location, record.Reason)
+			}
+			fmt.Printf("Removed %d corrupted and %d following blocks.\n", len(report.Corrupted), report.RemovedBlocks)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	return cmd
+}
+
+func dbReindexCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "reindex",
+		Short: "Rebuilds the TX and account indexes from the stored blocks.",
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+
+			err := database.RebuildChainIndex(dataDir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Chain index of %s rebuilt.\n", dataDir)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	return cmd
+}
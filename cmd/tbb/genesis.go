@@ -0,0 +1,236 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"github.com/web3coach/the-blockchain-bar/database"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+const flagGenesisTemplate = "template"
+const flagChainID = "chain-id"
+const flagSymbol = "symbol"
+const flagAlloc = "alloc"
+const flagVest = "vest"
+const flagMiningDifficulty = "mining-difficulty"
+const flagBlockReward = "block-reward"
+const flagTxFee = "tx-fee"
+const flagTargetBlockTime = "target-block-time"
+const flagRetargetInterval = "retarget-interval"
+const flagBlockGasLimit = "block-gas-limit"
+const flagBlockMaxBytes = "block-max-bytes"
+const flagFork = "fork"
+
+func genesisCmd() *cobra.Command {
+	var genesisCmd = &cobra.Command{
+		Use:   "genesis",
+		Short: "Creates new chains (init).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	genesisCmd.AddCommand(genesisInitCmd())
+
+	return genesisCmd
+}
+
+func genesisInitCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "init",
+		Short: "Initializes a data dir with the genesis of a new chain.",
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+
+			genesis, err := genesisFromCmd(cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			err = database.InitGenesis(dataDir, genesis)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Chain '%s' initialized in %s with %d genesis allocations.\n", genesis.ChainID, dataDir, len(genesis.Balances))
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagGenesisTemplate, "", "path to a genesis.json template, the other flags override its values")
+	cmd.Flags().String(flagChainID, "", "unique ID of the new chain (required without a template)")
+	cmd.Flags().String(flagSymbol, "TBB", "symbol of the chain native token")
+	cmd.Flags().StringArray(flagAlloc, []string{}, "genesis balance in the ACCOUNT=AMOUNT format, repeatable")
+	cmd.Flags().StringArray(flagVest, []string{}, "genesis tranche locked until a block height in the ACCOUNT=AMOUNT@HEIGHT format, repeatable")
+	cmd.Flags().Uint(flagMiningDifficulty, database.DefaultMiningDifficulty, "number of zeroes a block hash must start with, retargeted since the TIP5 fork")
+	cmd.Flags().Uint(flagBlockReward, database.DefaultBlockReward, "tokens minted to the miner of each block")
+	cmd.Flags().Uint(flagTxFee, database.DefaultTxFee, "flat fee per TX paid to the miner before the TIP1 fork")
+	cmd.Flags().Uint64(flagTargetBlockTime, database.DefaultTargetBlockTime, "seconds between blocks the difficulty retargeting aims for")
+	cmd.Flags().Uint64(flagRetargetInterval, database.DefaultRetargetInterval, "number of blocks between difficulty retargets")
+	cmd.Flags().Uint(flagBlockGasLimit, database.DefaultBlockGasLimit, "gas the TXs of a block can use since the TIP8 fork")
+	cmd.Flags().Uint64(flagBlockMaxBytes, database.DefaultBlockMaxBytes, "encoded size in bytes of the TXs of a block since the TIP8 fork")
+	cmd.Flags().StringArray(flagFork, []string{}, fmt.Sprintf("fork activation in the FORK=HEIGHT format, repeatable. Known forks: %v", database.KnownForks))
+
+	return cmd
+}
+
+// genesisFromCmd starts from the template, or from a chain with all known forks active, and applies the set flags on top.
+func genesisFromCmd(cmd *cobra.Command) (database.Genesis, error) {
+	var genesis database.Genesis
+	flags := cmd.Flags()
+
+	template, _ := flags.GetString(flagGenesisTemplate)
+	if template != "" {
+		var err error
+		genesis, err = database.LoadGenesis(fs.ExpandPath(template))
+		if err != nil {
+			return database.Genesis{}, err
+		}
+	} else {
+		genesis = database.Genesis{
+			Time:             time.Now().UTC().Format(time.RFC3339Nano),
+			Symbol:           "TBB",
+			Balances:         make(map[common.Address]uint),
+			MiningDifficulty: database.GenesisParam(database.DefaultMiningDifficulty),
+			BlockReward:      database.GenesisParam(database.DefaultBlockReward),
+			TxFee:            database.GenesisParam(database.DefaultTxFee),
+			TargetBlockTime:  database.DefaultTargetBlockTime,
+			RetargetInterval: database.DefaultRetargetInterval,
+			BlockGasLimit:    database.DefaultBlockGasLimit,
+			BlockMaxBytes:    database.DefaultBlockMaxBytes,
+			Forks:            make(map[database.Fork]uint64),
+		}
+
+		for _, fork := range database.KnownForks {
+			genesis.Forks[fork] = 0
+		}
+	}
+
+	if genesis.Balances == nil {
+		genesis.Balances = make(map[common.Address]uint)
+	}
+
+	if genesis.Forks == nil {
+		genesis.Forks = make(map[database.Fork]uint64)
+	}
+
+	if flags.Changed(flagChainID) {
+		genesis.ChainID, _ = flags.GetString(flagChainID)
+	}
+	if flags.Changed(flagSymbol) {
+		genesis.Symbol, _ = flags.GetString(flagSymbol)
+	}
+	if flags.Changed(flagMiningDifficulty) {
+		miningDifficulty, _ := flags.GetUint(flagMiningDifficulty)
+		genesis.MiningDifficulty = database.GenesisParam(miningDifficulty)
+	}
+	if flags.Changed(flagBlockReward) {
+		blockReward, _ := flags.GetUint(flagBlockReward)
+		genesis.BlockReward = database.GenesisParam(blockReward)
+	}
+	if flags.Changed(flagTxFee) {
+		txFee, _ := flags.GetUint(flagTxFee)
+		genesis.TxFee = database.GenesisParam(txFee)
+	}
+	if flags.Changed(flagTargetBlockTime) {
+		genesis.TargetBlockTime, _ = flags.GetUint64(flagTargetBlockTime)
+	}
+	if flags.Changed(flagRetargetInterval) {
+		genesis.RetargetInterval, _ = flags.GetUint64(flagRetargetInterval)
+	}
+	if flags.Changed(flagBlockGasLimit) {
+		genesis.BlockGasLimit, _ = flags.GetUint(flagBlockGasLimit)
+	}
+	if flags.Changed(flagBlockMaxBytes) {
+		genesis.BlockMaxBytes, _ = flags.GetUint64(flagBlockMaxBytes)
+	}
+	forks, _ := flags.GetStringArray(flagFork)
+	for _, fork := range forks {
+		parts := strings.SplitN(fork, "=", 2)
+		if len(parts) != 2 {
+			return database.Genesis{}, fmt.Errorf("invalid fork '%s', expected FORK=HEIGHT", fork)
+		}
+
+		height, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return database.Genesis{}, fmt.Errorf("invalid fork '%s' height: %s", fork, err)
+		}
+
+		genesis.Forks[database.Fork(parts[0])] = height
+	}
+
+	allocs, _ := flags.GetStringArray(flagAlloc)
+	for _, alloc := range allocs {
+		parts := strings.SplitN(alloc, "=", 2)
+		if len(parts) != 2 || !common.IsHexAddress(parts[0]) {
+			return database.Genesis{}, fmt.Errorf("invalid allocation '%s', expected ACCOUNT=AMOUNT", alloc)
+		}
+
+		amount, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return database.Genesis{}, fmt.Errorf("invalid allocation '%s' amount: %s", alloc, err)
+		}
+
+		genesis.Balances[database.NewAccount(parts[0])] = uint(amount)
+	}
+
+	vests, _ := flags.GetStringArray(flagVest)
+	for _, vest := range vests {
+		parts := strings.SplitN(vest, "=", 2)
+		if len(parts) != 2 || !common.IsHexAddress(parts[0]) {
+			return database.Genesis{}, fmt.Errorf("invalid vesting '%s', expected ACCOUNT=AMOUNT@HEIGHT", vest)
+		}
+
+		tranche := strings.SplitN(parts[1], "@", 2)
+		if len(tranche) != 2 {
+			return database.Genesis{}, fmt.Errorf("invalid vesting '%s', expected ACCOUNT=AMOUNT@HEIGHT", vest)
+		}
+
+		amount, err := strconv.ParseUint(tranche[0], 10, 64)
+		if err != nil {
+			return database.Genesis{}, fmt.Errorf("invalid vesting '%s' amount: %s", vest, err)
+		}
+
+		height, err := strconv.ParseUint(tranche[1], 10, 64)
+		if err != nil {
+			return database.Genesis{}, fmt.Errorf("invalid vesting '%s' height: %s", vest, err)
+		}
+
+		if genesis.Vesting == nil {
+			genesis.Vesting = make(map[common.Address][]database.GenesisVesting)
+		}
+
+		account := database.NewAccount(parts[0])
+		genesis.Vesting[account] = append(genesis.Vesting[account], database.GenesisVesting{
+			Amount:   uint(amount),
+			TimeLock: database.TimeLock{UntilHeight: height},
+		})
+	}
+
+	return genesis, nil
+}
@@ -32,6 +32,9 @@ const flagPort = "port"
 const flagBootstrapAcc = "bootstrap-account"
 const flagBootstrapIp = "bootstrap-ip"
 const flagBootstrapPort = "bootstrap-port"
+const flagMempoolSize = "mempool-size"
+const flagMempoolTTL = "mempool-ttl"
+const flagBlockStore = "block-store"
 
 func main() {
 	var tbbCmd = &cobra.Command{
@@ -43,8 +46,11 @@ func main() {
 
 	tbbCmd.AddCommand(versionCmd)
 	tbbCmd.AddCommand(balancesCmd())
+	tbbCmd.AddCommand(tokensCmd())
 	tbbCmd.AddCommand(walletCmd())
 	tbbCmd.AddCommand(runCmd())
+	tbbCmd.AddCommand(dbCmd())
+	tbbCmd.AddCommand(genesisCmd())
 
 	err := tbbCmd.Execute()
 	if err != nil {
@@ -38,6 +38,8 @@ func runCmd() *cobra.Command {
 			bootstrapIp, _ := cmd.Flags().GetString(flagBootstrapIp)
 			bootstrapPort, _ := cmd.Flags().GetUint64(flagBootstrapPort)
 			bootstrapAcc, _ := cmd.Flags().GetString(flagBootstrapAcc)
+			mempoolSize, _ := cmd.Flags().GetInt(flagMempoolSize)
+			mempoolTTL, _ := cmd.Flags().GetDuration(flagMempoolTTL)
 
 			fmt.Println("Launching TBB node and its HTTP API...")
 
@@ -55,7 +57,8 @@ func runCmd() *cobra.Command {
 			}
 
 			version := fmt.Sprintf("%s.%s.%s-alpha %s %s", Major, Minor, Fix, shortGitCommit(GitCommit), Verbal)
-			n := node.New(getDataDirFromCmd(cmd), ip, port, database.NewAccount(miner), bootstrap, version, node.DefaultMiningDifficulty)
+			n := node.New(getDataDirFromCmd(cmd), ip, port, database.NewAccount(miner), bootstrap, version, 0)
+			n.ConfigureMempool(mempoolSize, mempoolTTL)
 			err := n.Run(context.Background(), isSSLDisabled, sslEmail)
 			if err != nil {
 				fmt.Println(err)
@@ -73,6 +76,8 @@ func runCmd() *cobra.Command {
 	runCmd.Flags().String(flagBootstrapIp, node.DefaultBootstrapIp, "default bootstrap Web3Coach's server to interconnect peers")
 	runCmd.Flags().Uint64(flagBootstrapPort, node.HttpSSLPort, "default bootstrap Web3Coach's server port to interconnect peers")
 	runCmd.Flags().String(flagBootstrapAcc, node.DefaultBootstrapAcc, "default bootstrap Web3Coach's Genesis account with 1M TBB tokens")
+	runCmd.Flags().Int(flagMempoolSize, node.DefaultMempoolSize, "max number of pending TXs, the lowest paying TX is evicted for a better paying one (0 for unlimited)")
+	runCmd.Flags().Duration(flagMempoolTTL, node.DefaultMempoolTTL, "how long a TX can stay pending before it's dropped (0 to never expire)")
 
 	return runCmd
 }
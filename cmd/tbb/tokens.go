@@ -0,0 +1,102 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/web3coach/the-blockchain-bar/database"
+)
+
+func tokensCmd() *cobra.Command {
+	var tokensCmd = &cobra.Command{
+		Use:   "tokens",
+		Short: "Interacts with user-issued tokens (list, balances...).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	tokensCmd.AddCommand(tokensListCmd())
+	tokensCmd.AddCommand(tokensBalancesCmd())
+
+	return tokensCmd
+}
+
+func tokensListCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists all issued tokens.",
+		Run: func(cmd *cobra.Command, args []string) {
+			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd), 0)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			fmt.Printf("Tokens at %x:\n", state.LatestBlockHash())
+			fmt.Println("__________________")
+			fmt.Println("")
+			for _, token := range state.Tokens() {
+				fmt.Println(fmt.Sprintf("%s: supply %s, issued by %s", token.Symbol, token.Supply.String(), token.Issuer.String()))
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	return cmd
+}
+
+func tokensBalancesCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "balances",
+		Short: "Lists the balances of a token holders.",
+		Run: func(cmd *cobra.Command, args []string) {
+			symbol, _ := cmd.Flags().GetString(flagSymbol)
+
+			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd), 0)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			if _, ok := state.Token(symbol); !ok {
+				fmt.Fprintln(os.Stderr, fmt.Errorf("unknown token '%s'", symbol))
+				os.Exit(1)
+			}
+
+			fmt.Printf("%s balances at %x:\n", symbol, state.LatestBlockHash())
+			fmt.Println("__________________")
+			fmt.Println("")
+			for account, balance := range state.TokenBalances(symbol) {
+				fmt.Println(fmt.Sprintf("%s: %s %s", account.String(), balance.String(), symbol))
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagSymbol, "", "symbol of the token")
+	cmd.MarkFlagRequired(flagSymbol)
+
+	return cmd
+}
@@ -16,6 +16,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -23,10 +24,23 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/spf13/cobra"
+	"github.com/web3coach/the-blockchain-bar/database"
 	"github.com/web3coach/the-blockchain-bar/wallet"
 )
 
+const flagThreshold = "threshold"
+const flagSigner = "signer"
+const flagAccount = "account"
+const flagTxFile = "tx-file"
+const flagFrom = "from"
+const flagTo = "to"
+const flagAmount = "amount"
+const flagGasPrice = "gas-price"
+const flagNonce = "nonce"
+const flagData = "data"
+
 func walletCmd() *cobra.Command {
 	var walletCmd = &cobra.Command{
 		Use:   "wallet",
@@ -40,6 +54,9 @@ func walletCmd() *cobra.Command {
 
 	walletCmd.AddCommand(walletNewAccountCmd())
 	walletCmd.AddCommand(walletPrintPrivKeyCmd())
+	walletCmd.AddCommand(walletMultisigAddressCmd())
+	walletCmd.AddCommand(walletMultisigTxCmd())
+	walletCmd.AddCommand(walletCosignCmd())
 
 	return walletCmd
 }
@@ -97,6 +114,140 @@ func walletPrintPrivKeyCmd() *cobra.Command {
 	return cmd
 }
 
+func walletMultisigAddressCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "multisig-address",
+		Short: "Prints the address of the multisig account requiring a threshold of signatures from the signers.",
+		Run: func(cmd *cobra.Command, args []string) {
+			threshold, _ := cmd.Flags().GetUint(flagThreshold)
+			signers, _ := cmd.Flags().GetStringSlice(flagSigner)
+
+			accounts := make([]common.Address, 0, len(signers))
+			for _, signer := range signers {
+				accounts = append(accounts, database.NewAccount(signer))
+			}
+			multisig := database.NewMultisig(threshold, accounts)
+
+			fmt.Printf("Multisig %d-of-%d account: %s\n", multisig.Threshold, len(multisig.Signers), multisig.Address().Hex())
+		},
+	}
+
+	cmd.Flags().Uint(flagThreshold, 1, "number of signatures required to spend from the account")
+	cmd.Flags().StringSlice(flagSigner, nil, "signer account, repeat the flag for each signer")
+	cmd.MarkFlagRequired(flagSigner)
+
+	return cmd
+}
+
+func walletMultisigTxCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "multisig-tx",
+		Short: "Writes a multisig spend TX into a file for the multisig signers to co-sign.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			to, _ := cmd.Flags().GetString(flagTo)
+			amountTBB, _ := cmd.Flags().GetString(flagAmount)
+			gasPrice, _ := cmd.Flags().GetUint(flagGasPrice)
+			nonce, _ := cmd.Flags().GetUint(flagNonce)
+			chainID, _ := cmd.Flags().GetString(flagChainID)
+			data, _ := cmd.Flags().GetString(flagData)
+			txFile, _ := cmd.Flags().GetString(flagTxFile)
+
+			amount, err := database.ParseTBB(amountTBB)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			tx := database.NewMultisigSpendTx(database.NewAccount(from), database.NewAccount(to), database.TxGas, gasPrice, amount, nonce, data)
+			tx.ChainID = chainID
+
+			err = writeTxFile(txFile, database.SignedTx{Tx: tx})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Multisig TX written to %s, co-sign it with: tbb wallet cosign --%s=%s\n", txFile, flagTxFile, txFile)
+		},
+	}
+
+	cmd.Flags().String(flagFrom, "", "multisig account spending")
+	cmd.Flags().String(flagTo, "", "recipient account")
+	cmd.Flags().String(flagAmount, "", "TBB amount to transfer, e.g. 1.5")
+	cmd.Flags().Uint(flagGasPrice, database.TxGasPriceDefault, "gas price in TBB")
+	cmd.Flags().Uint(flagNonce, 0, "next nonce of the multisig account")
+	cmd.Flags().String(flagChainID, "", "chain ID of the genesis the TX is signed for")
+	cmd.Flags().String(flagData, "", "TX data")
+	cmd.Flags().String(flagTxFile, "", "path of the TX file to write")
+	cmd.MarkFlagRequired(flagFrom)
+	cmd.MarkFlagRequired(flagTo)
+	cmd.MarkFlagRequired(flagAmount)
+	cmd.MarkFlagRequired(flagNonce)
+	cmd.MarkFlagRequired(flagChainID)
+	cmd.MarkFlagRequired(flagTxFile)
+
+	return cmd
+}
+
+func walletCosignCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "cosign",
+		Short: "Adds the signature of a keystore account to a partially signed multisig TX file.",
+		Run: func(cmd *cobra.Command, args []string) {
+			account, _ := cmd.Flags().GetString(flagAccount)
+			txFile, _ := cmd.Flags().GetString(flagTxFile)
+
+			txJson, err := ioutil.ReadFile(txFile)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			var tx database.SignedTx
+			err = json.Unmarshal(txJson, &tx)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			password := getPassPhrase("Please enter a password to decrypt the wallet:", false)
+			keystoreDir := wallet.GetKeystoreDirPath(getDataDirFromCmd(cmd))
+
+			tx, err = wallet.CosignTxWithKeystoreAccount(tx, database.NewAccount(account), password, keystoreDir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			err = writeTxFile(txFile, tx)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("TX signed by %d signers. Once enough signers co-signed it, submit it to a node: curl -X POST --data @%s http://localhost:8080/tx/submit\n", len(tx.Sigs), txFile)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagAccount, "", "keystore account of the signer")
+	cmd.Flags().String(flagTxFile, "", "path of the partially signed TX file")
+	cmd.MarkFlagRequired(flagAccount)
+	cmd.MarkFlagRequired(flagTxFile)
+
+	return cmd
+}
+
+func writeTxFile(path string, tx database.SignedTx) error {
+	txJson, err := json.MarshalIndent(tx, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, txJson, 0644)
+}
+
 func getPassPhrase(prompt string, confirmation bool) string {
 	return utils.GetPassPhrase(prompt, confirmation)
 }
@@ -0,0 +1,183 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// AmountDecimals is the number of decimals of a TBB, an Amount of 1 being 10^-18 TBB since the TIP9 fork.
+const AmountDecimals = 18
+
+// MaxAmountBits bounds amounts to 256 bits, arithmetic exceeding it fails with ErrAmountOverflow.
+const MaxAmountBits = 256
+
+var ErrAmountOverflow = errors.New("amount overflows 256 bits")
+var ErrAmountNegative = errors.New("amount can't be negative")
+
+var tbbSubunits = new(big.Int).Exp(big.NewInt(10), big.NewInt(AmountDecimals), nil)
+
+// Amount is an arbitrary-precision non-negative token amount. The zero value is a zero amount.
+//
+// Amounts are immutable, the arithmetic methods return new amounts.
+type Amount struct {
+	v *big.Int
+}
+
+// NewAmount returns the amount of the given smallest units.
+func NewAmount(value uint64) Amount {
+	return Amount{new(big.Int).SetUint64(value)}
+}
+
+// AmountFromTBB returns the amount of whole TBB in the smallest unit.
+func AmountFromTBB(tbb uint64) Amount {
+	return Amount{new(big.Int).Mul(new(big.Int).SetUint64(tbb), tbbSubunits)}
+}
+
+// ParseAmount parses a decimal integer amount of smallest units.
+func ParseAmount(value string) (Amount, error) {
+	v, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("invalid amount '%s'", value)
+	}
+
+	return newCheckedAmount(v)
+}
+
+// ParseTBB parses a decimal TBB amount with up to AmountDecimals fractional digits, e.g. "1.5".
+func ParseTBB(value string) (Amount, error) {
+	whole, fraction := value, ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		whole, fraction = value[:i], value[i+1:]
+	}
+
+	if len(fraction) > AmountDecimals {
+		return Amount{}, fmt.Errorf("invalid TBB amount '%s'. At most %d decimals are allowed", value, AmountDecimals)
+	}
+
+	if whole == "" {
+		whole = "0"
+	}
+
+	if strings.ContainsAny(whole+fraction, "+-") {
+		return Amount{}, fmt.Errorf("invalid TBB amount '%s'", value)
+	}
+
+	v, ok := new(big.Int).SetString(whole+fraction+strings.Repeat("0", AmountDecimals-len(fraction)), 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("invalid TBB amount '%s'", value)
+	}
+
+	return newCheckedAmount(v)
+}
+
+func newCheckedAmount(v *big.Int) (Amount, error) {
+	if v.Sign() < 0 {
+		return Amount{}, ErrAmountNegative
+	}
+
+	if v.BitLen() > MaxAmountBits {
+		return Amount{}, ErrAmountOverflow
+	}
+
+	return Amount{v}, nil
+}
+
+func (a Amount) big() *big.Int {
+	if a.v == nil {
+		return new(big.Int)
+	}
+
+	return a.v
+}
+
+func (a Amount) Add(b Amount) (Amount, error) {
+	return newCheckedAmount(new(big.Int).Add(a.big(), b.big()))
+}
+
+// Sub fails with ErrAmountNegative if b is greater than a.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	return newCheckedAmount(new(big.Int).Sub(a.big(), b.big()))
+}
+
+func (a Amount) Mul(b Amount) (Amount, error) {
+	return newCheckedAmount(new(big.Int).Mul(a.big(), b.big()))
+}
+
+// Cmp returns -1, 0 or +1 if a is lower, equal or greater than b.
+func (a Amount) Cmp(b Amount) int {
+	return a.big().Cmp(b.big())
+}
+
+func (a Amount) IsZero() bool {
+	return a.big().Sign() == 0
+}
+
+// IsUint64 reports whether the amount fits an uint64.
+func (a Amount) IsUint64() bool {
+	return a.big().IsUint64()
+}
+
+// Bytes returns the big-endian bytes of the amount.
+func (a Amount) Bytes() []byte {
+	return a.big().Bytes()
+}
+
+// Uint64 returns the amount truncated to an uint64, see IsUint64.
+func (a Amount) Uint64() uint64 {
+	return a.big().Uint64()
+}
+
+// String returns the amount in decimal smallest units.
+func (a Amount) String() string {
+	return a.big().String()
+}
+
+// FormatTBB returns the amount of smallest units in decimal TBB without trailing zeros, e.g. "1.5".
+func (a Amount) FormatTBB() string {
+	whole, fraction := new(big.Int).QuoRem(a.big(), tbbSubunits, new(big.Int))
+	if fraction.Sign() == 0 {
+		return whole.String()
+	}
+
+	digits := fraction.String()
+	digits = strings.Repeat("0", AmountDecimals-len(digits)) + digits
+
+	return whole.String() + "." + strings.TrimRight(digits, "0")
+}
+
+// MarshalJSON encodes the amount as a decimal string, JSON numbers lose precision beyond 53 bits in most clients.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON decodes decimal strings as well as the JSON numbers of the balances predating the TIP9 fork.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+
+	amount, err := ParseAmount(value)
+	if err != nil {
+		return err
+	}
+
+	*a = amount
+
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - The TIP9 fork activates at block 2 on a chain of legacy TXs, the first blocks transfer whole TBB values
+//   - The balances are converted to the smallest unit once block 1 is applied
+//   - Value TXs are rejected since TIP9, a fractional TBB amount is transferred instead
+//   - Amounts overflowing 256 bits are rejected instead of wrapping around
+func TestState_TIP9Amounts(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	forks := make(map[Fork]uint64)
+	for _, fork := range KnownForks {
+		forks[fork] = 0
+	}
+	forks[ForkTIP9] = 2
+	delete(forks, ForkTIP10)
+
+	err = InitGenesis(dataDir, Genesis{
+		ChainID:          testChainID,
+		Symbol:           "TBB",
+		Balances:         map[common.Address]uint{andrej: 1000},
+		MiningDifficulty: GenesisParam(defaultTestMiningDifficulty),
+		Forks:            forks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	for nonce := uint(1); nonce <= 2; nonce++ {
+		_, err := state.AddBlock(mineTestBlock(t, state, babaYaga, signTestValueTx(t, andrejKey, andrej, babaYaga, 10, nonce)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Andrej paid 2 * (10 TBB + 21 gas * 1 TBB), BabaYaga received the values, rewards and fees
+	expectedAndrejBalance := AmountFromTBB(1000 - 2*(10+TxGas*TxGasPriceDefault))
+	if state.Balances[andrej].Cmp(expectedAndrejBalance) != 0 {
+		t.Fatalf("Andrej balance should be migrated to %s not %s", expectedAndrejBalance, state.Balances[andrej])
+	}
+
+	expectedBabaYagaBalance := AmountFromTBB(2 * (10 + BlockReward + TxGas*TxGasPriceDefault))
+	if state.Balances[babaYaga].Cmp(expectedBabaYagaBalance) != 0 {
+		t.Fatalf("BabaYaga balance should be migrated to %s not %s", expectedBabaYagaBalance, state.Balances[babaYaga])
+	}
+
+	if state.FormatAmount(state.Balances[andrej]) != "938" {
+		t.Errorf("Andrej balance should format as 938 TBB not %s", state.FormatAmount(state.Balances[andrej]))
+	}
+
+	if err := ValidateTx(signTestValueTx(t, andrejKey, andrej, babaYaga, 10, 3), state); err == nil {
+		t.Error("TX transferring a Value should be rejected since TIP9")
+	}
+
+	huge, err := ParseAmount("1" + strings.Repeat("0", 77))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hugeTx, err := signTx(NewAmountTx(andrej, babaYaga, TxGas, TxGasPriceDefault, huge, 3, ""), testChainID, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateTx(hugeTx, state); err == nil {
+		t.Error("TX cost overflowing 256 bits should be rejected")
+	}
+
+	halfTBB, err := ParseTBB("0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := signTx(NewAmountTx(andrej, babaYaga, TxGas, TxGasPriceDefault, halfTBB, 3, ""), testChainID, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, andrej, tx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Andrej paid 0.5 TBB, the 21 gas fee went back to him as the miner along with the block reward
+	expectedAndrejBalance, _ = expectedAndrejBalance.Add(AmountFromTBB(BlockReward))
+	expectedAndrejBalance, _ = expectedAndrejBalance.Sub(halfTBB)
+	if state.Balances[andrej].Cmp(expectedAndrejBalance) != 0 {
+		t.Errorf("Andrej balance should be %s not %s", expectedAndrejBalance, state.Balances[andrej])
+	}
+
+	if state.FormatAmount(state.Balances[babaYaga]) != "262.5" {
+		t.Errorf("BabaYaga balance should format as 262.5 TBB not %s", state.FormatAmount(state.Balances[babaYaga]))
+	}
+
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(txJson), `"amount":"500000000000000000"`) {
+		t.Errorf("TX amount should be encoded as a decimal string, got %s", txJson)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -59,6 +60,15 @@ type BlockHeader struct {
 	Nonce  uint32         `json:"nonce"`
 	Time   uint64         `json:"time"`
 	Miner  common.Address `json:"miner"`
+
+	// TxRoot is the Merkle root of the block TXs, populated since the TIP2 fork
+	TxRoot *Hash `json:"tx_root,omitempty"`
+	// StateRoot is the root of the accounts state after applying the block, populated since the TIP3 fork
+	StateRoot *Hash `json:"state_root,omitempty"`
+	// Difficulty is the retargeted mining difficulty of the block, populated since the TIP5 fork
+	Difficulty *uint `json:"difficulty,omitempty"`
+	// Bits is the compact 256-bit target the block hash must not exceed, replaces the Difficulty since the TIP6 fork
+	Bits *uint32 `json:"bits,omitempty"`
 }
 
 type BlockFS struct {
@@ -67,7 +77,7 @@ type BlockFS struct {
 }
 
 func NewBlock(parent Hash, number uint64, nonce uint32, time uint64, miner common.Address, txs []SignedTx) Block {
-	return Block{BlockHeader{parent, number, nonce, time, miner}, txs}
+	return Block{BlockHeader{Parent: parent, Number: number, Nonce: nonce, Time: time, Miner: miner}, txs}
 }
 
 func (b Block) Hash() (Hash, error) {
@@ -89,7 +99,17 @@ func (b Block) GasReward() uint {
 	return reward
 }
 
+// BlockWork returns the expected number of hash attempts needed to mine a block with the given difficulty.
+func BlockWork(miningDifficulty uint) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), 8*miningDifficulty)
+}
+
+// IsBlockHashValid checks the hash starts with exactly miningDifficulty zero bytes, the PoW rule before the TIP6 fork.
 func IsBlockHashValid(hash Hash, miningDifficulty uint) bool {
+	if miningDifficulty >= uint(len(hash)) {
+		return false
+	}
+
 	zeroesCount := uint(0)
 
 	for i := uint(0); i < miningDifficulty; i++ {
@@ -0,0 +1,87 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// TxGas is the gas the TX uses in the block at the given height, a flat TxGas before the TIP1 fork.
+func (c ChainConfig) TxGas(tx Tx, height uint64) uint {
+	if c.IsActive(ForkTIP1, height) {
+		return tx.Gas
+	}
+
+	return TxGas
+}
+
+// TxSize is the number of bytes the TX takes in the encoded block.
+func TxSize(tx SignedTx) (uint64, error) {
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(len(txJson)), nil
+}
+
+// verifyBlockLimits checks the block TXs fit in the block gas limit and byte cap since the TIP8 fork.
+func (c ChainConfig) verifyBlockLimits(b Block) error {
+	if !c.IsActive(ForkTIP8, b.Header.Number) {
+		return nil
+	}
+
+	gas := uint(0)
+	size := uint64(0)
+	for _, tx := range b.TXs {
+		gas += c.TxGas(tx.Tx, b.Header.Number)
+
+		txSize, err := TxSize(tx)
+		if err != nil {
+			return err
+		}
+		size += txSize
+	}
+
+	if gas > c.BlockGasLimit {
+		return fmt.Errorf("invalid block. TXs use %d gas, the block gas limit is %d", gas, c.BlockGasLimit)
+	}
+
+	if size > c.BlockMaxBytes {
+		return fmt.Errorf("invalid block. TXs take %d bytes, the block cap is %d bytes", size, c.BlockMaxBytes)
+	}
+
+	return nil
+}
+
+// verifyTxFitsBlock rejects TXs exceeding the block limits on their own.
+func (c ChainConfig) verifyTxFitsBlock(tx SignedTx, height uint64) error {
+	if gas := c.TxGas(tx.Tx, height); gas > c.BlockGasLimit {
+		return fmt.Errorf("wrong TX. TX uses %d gas, the block gas limit is %d", gas, c.BlockGasLimit)
+	}
+
+	size, err := TxSize(tx)
+	if err != nil {
+		return err
+	}
+
+	if size > c.BlockMaxBytes {
+		return fmt.Errorf("wrong TX. TX takes %d bytes, the block cap is %d bytes", size, c.BlockMaxBytes)
+	}
+
+	return nil
+}
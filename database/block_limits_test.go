@@ -0,0 +1,93 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - The genesis block gas limit fits 3 TXs
+//   - A block with 5 TXs is rejected
+//   - A block with the first 3 TXs is valid
+//   - A TX larger than the block byte cap is rejected on its own
+func TestState_BlockLimits(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	forks := make(map[Fork]uint64)
+	for _, fork := range KnownForks {
+		forks[fork] = 0
+	}
+
+	txs := make([]SignedTx, 0)
+	for nonce := uint(1); nonce <= 5; nonce++ {
+		txs = append(txs, signTestTx(t, andrejKey, andrej, babaYaga, 1, nonce))
+	}
+
+	txSize, err := TxSize(txs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = InitGenesis(dataDir, Genesis{
+		ChainID:          testChainID,
+		Balances:         map[common.Address]uint{andrej: 1000},
+		MiningDifficulty: GenesisParam(defaultTestMiningDifficulty),
+		BlockGasLimit:    3 * TxGas,
+		BlockMaxBytes:    4 * txSize,
+		Forks:            forks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if _, err := state.AddBlock(mineTestBlock(t, state, andrej, txs...)); err == nil {
+		t.Fatal("block exceeding the block gas limit should be rejected")
+	}
+
+	if _, err := state.AddBlock(mineTestBlock(t, state, andrej, txs[:3]...)); err != nil {
+		t.Fatalf("block fitting the limits should be valid: %s", err)
+	}
+
+	largeTx, err := signTx(NewTransferTx(andrej, babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(1), 4, strings.Repeat("x", int(4*txSize))), testChainID, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateTx(largeTx, state); err == nil {
+		t.Fatal("TX larger than the block byte cap should be rejected")
+	}
+}
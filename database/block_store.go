@@ -0,0 +1,140 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const BlockStoreFile = "file"
+const BlockStoreLevelDB = "leveldb"
+
+// BlockStore persists the blocks of the main chain.
+//
+// Blocks are stored in ascending height order. Side branch blocks are never stored,
+// a chain reorganization truncates the store to the common ancestor first.
+type BlockStore interface {
+	// Put appends the block on top of the latest stored block.
+	Put(blockFs BlockFS) error
+	GetByHash(hash Hash) (BlockFS, error)
+	GetByHeight(height uint64) (BlockFS, error)
+	// Iterate calls fn for every block from the `from` up to, and including, the `to` height until fn returns false.
+	Iterate(from, to uint64, fn func(blockFs BlockFS) (bool, error)) error
+	// Latest returns the highest stored block, ok is false if the store is empty.
+	Latest() (blockFs BlockFS, ok bool, err error)
+	// Truncate removes all blocks at the given height and above.
+	Truncate(fromHeight uint64) error
+	Close() error
+}
+
+// OpenBlockStore opens the block store the data dir was configured with. Defaults to the flat file block.db.
+func OpenBlockStore(dataDir string) (BlockStore, error) {
+	engine, err := readBlockStoreEngine(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return openBlockStore(dataDir, engine)
+}
+
+// MigrateBlockStore copies all blocks of the data dir into a new block store of the given engine
+// and configures the data dir to use it from now on.
+func MigrateBlockStore(dataDir string, engine string) error {
+	currentEngine, err := readBlockStoreEngine(dataDir)
+	if err != nil {
+		return err
+	}
+
+	if currentEngine == engine {
+		return nil
+	}
+
+	src, err := openBlockStore(dataDir, currentEngine)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	err = removeBlockStore(dataDir, engine)
+	if err != nil {
+		return err
+	}
+
+	dst, err := openBlockStore(dataDir, engine)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	latest, ok, err := src.Latest()
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		err = src.Iterate(0, latest.Value.Header.Number, func(blockFs BlockFS) (bool, error) {
+			return true, dst.Put(blockFs)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ioutil.WriteFile(getBlockStoreEngineFilePath(dataDir), []byte(engine), 0644)
+	if err != nil {
+		return err
+	}
+
+	return removeBlockStore(dataDir, currentEngine)
+}
+
+func openBlockStore(dataDir string, engine string) (BlockStore, error) {
+	switch engine {
+	case BlockStoreFile:
+		return newFileBlockStore(getBlocksDbFilePath(dataDir))
+	case BlockStoreLevelDB:
+		return newLevelDBBlockStore(getLevelDBBlockStoreDirPath(dataDir))
+	default:
+		return nil, fmt.Errorf("unknown block store '%s'. Supported: %s, %s", engine, BlockStoreFile, BlockStoreLevelDB)
+	}
+}
+
+func removeBlockStore(dataDir string, engine string) error {
+	switch engine {
+	case BlockStoreFile:
+		return writeEmptyBlocksDbToDisk(getBlocksDbFilePath(dataDir))
+	case BlockStoreLevelDB:
+		return os.RemoveAll(getLevelDBBlockStoreDirPath(dataDir))
+	default:
+		return fmt.Errorf("unknown block store '%s'. Supported: %s, %s", engine, BlockStoreFile, BlockStoreLevelDB)
+	}
+}
+
+func readBlockStoreEngine(dataDir string) (string, error) {
+	if !fileExist(getBlockStoreEngineFilePath(dataDir)) {
+		return BlockStoreFile, nil
+	}
+
+	engine, err := ioutil.ReadFile(getBlockStoreEngineFilePath(dataDir))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(engine)), nil
+}
@@ -0,0 +1,320 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Max size of a single block.db line, bufio.Scanner defaults to 64KB which isn't enough for blocks full of TXs.
+const maxBlockFsJsonSize = 32 * 1024 * 1024
+
+// fileBlockStore is the original newline-delimited JSON block.db.
+//
+// The file position of every block is cached by its hash and height (HashCache / HeightCache)
+// so single blocks and ranges can be read without scanning the whole file.
+type fileBlockStore struct {
+	dbFile *os.File
+
+	latest    BlockFS
+	hasLatest bool
+
+	hashCache   map[Hash]int64
+	heightCache map[uint64]int64
+
+	lock sync.RWMutex
+}
+
+func newFileBlockStore(path string) (*fileBlockStore, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &fileBlockStore{dbFile: f, hashCache: make(map[Hash]int64), heightCache: make(map[uint64]int64)}
+
+	tornTailPos := int64(-1)
+	err = scanFileBlockRecords(f, func(record fileBlockRecord) (bool, error) {
+		if record.isTorn {
+			tornTailPos = record.offset
+			return false, nil
+		}
+
+		if record.err != nil {
+			return false, fmt.Errorf("corrupted block record at byte offset %d of %s. %s. Run: tbb db repair", record.offset, path, record.err)
+		}
+
+		// set search caches
+		store.hashCache[record.blockFs.Key] = record.offset
+		store.heightCache[record.blockFs.Value.Header.Number] = record.offset
+
+		store.latest = record.blockFs
+		store.hasLatest = true
+
+		return true, nil
+	})
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	// A crash in the middle of appending a block leaves an unterminated last line behind
+	if tornTailPos >= 0 {
+		fmt.Printf("WARNING: truncating the incomplete last block record of %s at byte offset %d\n", path, tornTailPos)
+
+		err = truncateFileBlockRecords(f, tornTailPos)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+func (s *fileBlockStore) Put(blockFs BlockFS) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	blockFsJson, err := json.Marshal(blockFs)
+	if err != nil {
+		return err
+	}
+
+	// get file pos for cache
+	fs, err := s.dbFile.Stat()
+	if err != nil {
+		return err
+	}
+	filePos := fs.Size()
+
+	// The block is complete only once its line is terminated, a partial write is detected as a torn tail
+	_, err = s.dbFile.Write(append(blockFsJson, '\n'))
+	if err != nil {
+		return err
+	}
+
+	err = s.dbFile.Sync()
+	if err != nil {
+		return err
+	}
+
+	// set search caches
+	s.hashCache[blockFs.Key] = filePos
+	s.heightCache[blockFs.Value.Header.Number] = filePos
+	s.latest = blockFs
+	s.hasLatest = true
+
+	return nil
+}
+
+func (s *fileBlockStore) GetByHash(hash Hash) (BlockFS, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	filePos, ok := s.hashCache[hash]
+	if !ok {
+		return BlockFS{}, fmt.Errorf("invalid hash: '%x'", hash)
+	}
+
+	return s.readBlockAt(filePos)
+}
+
+func (s *fileBlockStore) GetByHeight(height uint64) (BlockFS, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	filePos, ok := s.heightCache[height]
+	if !ok {
+		return BlockFS{}, fmt.Errorf("invalid height: '%v'", height)
+	}
+
+	return s.readBlockAt(filePos)
+}
+
+func (s *fileBlockStore) Iterate(from, to uint64, fn func(blockFs BlockFS) (bool, error)) error {
+	s.lock.RLock()
+	filePos, ok := s.heightCache[from]
+	s.lock.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	scanner := newBlocksDbScanner(io.NewSectionReader(s.dbFile, filePos, 1<<62))
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			break
+		}
+
+		var blockFs BlockFS
+		err := json.Unmarshal(scanner.Bytes(), &blockFs)
+		if err != nil {
+			return err
+		}
+
+		if blockFs.Value.Header.Number > to {
+			break
+		}
+
+		next, err := fn(blockFs)
+		if err != nil {
+			return err
+		}
+
+		if !next {
+			break
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (s *fileBlockStore) Latest() (BlockFS, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.latest, s.hasLatest, nil
+}
+
+func (s *fileBlockStore) Truncate(fromHeight uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	filePos, ok := s.heightCache[fromHeight]
+	if !ok {
+		return nil
+	}
+
+	err := truncateFileBlockRecords(s.dbFile, filePos)
+	if err != nil {
+		return err
+	}
+
+	for hash, pos := range s.hashCache {
+		if pos >= filePos {
+			delete(s.hashCache, hash)
+		}
+	}
+
+	for height := range s.heightCache {
+		if height >= fromHeight {
+			delete(s.heightCache, height)
+		}
+	}
+
+	s.latest = BlockFS{}
+	s.hasLatest = false
+
+	if fromHeight > 0 {
+		latest, err := s.readBlockAt(s.heightCache[fromHeight-1])
+		if err != nil {
+			return err
+		}
+
+		s.latest = latest
+		s.hasLatest = true
+	}
+
+	return nil
+}
+
+func (s *fileBlockStore) Close() error {
+	return s.dbFile.Close()
+}
+
+func (s *fileBlockStore) readBlockAt(filePos int64) (BlockFS, error) {
+	var blockFs BlockFS
+
+	scanner := newBlocksDbScanner(io.NewSectionReader(s.dbFile, filePos, 1<<62))
+	if scanner.Scan() {
+		err := json.Unmarshal(scanner.Bytes(), &blockFs)
+		if err != nil {
+			return blockFs, err
+		}
+	}
+
+	return blockFs, scanner.Err()
+}
+
+// fileBlockRecord is a single block.db line.
+type fileBlockRecord struct {
+	offset  int64
+	blockFs BlockFS
+	// err is set when the record can't be decoded or its content doesn't match its hash
+	err error
+	// isTorn is set for an unterminated last line, the block was never completely written
+	isTorn bool
+}
+
+// scanFileBlockRecords reads block.db records one by one until fn returns false.
+func scanFileBlockRecords(r io.Reader, fn func(record fileBlockRecord) (bool, error)) error {
+	reader := bufio.NewReader(r)
+	offset := int64(0)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if len(line) == 0 || (len(line) == 1 && err == nil) {
+			return nil
+		}
+
+		record := fileBlockRecord{offset: offset}
+		if err == io.EOF {
+			record.isTorn = true
+		} else {
+			record.err = json.Unmarshal(line[:len(line)-1], &record.blockFs)
+			if record.err == nil {
+				record.err = verifyBlockRecord(record.blockFs)
+			}
+		}
+
+		next, fnErr := fn(record)
+		if fnErr != nil {
+			return fnErr
+		}
+
+		if !next || err == io.EOF {
+			return nil
+		}
+
+		offset += int64(len(line))
+	}
+}
+
+func truncateFileBlockRecords(f *os.File, size int64) error {
+	err := f.Truncate(size)
+	if err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+func newBlocksDbScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxBlockFsJsonSize)
+
+	return scanner
+}
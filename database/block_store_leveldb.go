@@ -0,0 +1,246 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// LevelDB keys:
+//
+//	"b" + block hash   => BlockFS JSON
+//	"n" + block height => block hash
+//	"latest"           => latest block hash
+var levelDBBlockPrefix = []byte("b")
+var levelDBHeightPrefix = []byte("n")
+var levelDBLatestKey = []byte("latest")
+
+// Writes are flushed to disk before returning so a crash never loses an acknowledged block
+var levelDBSyncWrite = &opt.WriteOptions{Sync: true}
+
+// levelDBBlockStore indexes blocks by hash and height in an embedded key-value DB
+// so opening it doesn't require reading the whole chain.
+type levelDBBlockStore struct {
+	db *leveldb.DB
+
+	latest    BlockFS
+	hasLatest bool
+
+	lock sync.RWMutex
+}
+
+func newLevelDBBlockStore(path string) (*levelDBBlockStore, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &levelDBBlockStore{db: db}
+
+	latestHash, err := db.Get(levelDBLatestKey, nil)
+	if err == leveldb.ErrNotFound {
+		return store, nil
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	var hash Hash
+	copy(hash[:], latestHash)
+
+	store.latest, err = store.GetByHash(hash)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	store.hasLatest = true
+
+	return store, nil
+}
+
+func (s *levelDBBlockStore) Put(blockFs BlockFS) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	blockFsJson, err := json.Marshal(blockFs)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(levelDBBlockKey(blockFs.Key), blockFsJson)
+	batch.Put(levelDBHeightKey(blockFs.Value.Header.Number), blockFs.Key[:])
+	batch.Put(levelDBLatestKey, blockFs.Key[:])
+
+	err = s.db.Write(batch, levelDBSyncWrite)
+	if err != nil {
+		return err
+	}
+
+	s.latest = blockFs
+	s.hasLatest = true
+
+	return nil
+}
+
+func (s *levelDBBlockStore) GetByHash(hash Hash) (BlockFS, error) {
+	var blockFs BlockFS
+
+	blockFsJson, err := s.db.Get(levelDBBlockKey(hash), nil)
+	if err == leveldb.ErrNotFound {
+		return blockFs, fmt.Errorf("invalid hash: '%x'", hash)
+	}
+	if err != nil {
+		return blockFs, err
+	}
+
+	err = json.Unmarshal(blockFsJson, &blockFs)
+	if err != nil {
+		return blockFs, err
+	}
+
+	return blockFs, nil
+}
+
+func (s *levelDBBlockStore) GetByHeight(height uint64) (BlockFS, error) {
+	hash, err := s.heightHash(height)
+	if err == leveldb.ErrNotFound {
+		return BlockFS{}, fmt.Errorf("invalid height: '%v'", height)
+	}
+	if err != nil {
+		return BlockFS{}, err
+	}
+
+	return s.GetByHash(hash)
+}
+
+// heightHash returns the hash of the main chain block at the height, leveldb.ErrNotFound above the latest block.
+func (s *levelDBBlockStore) heightHash(height uint64) (Hash, error) {
+	var hash Hash
+
+	hashBytes, err := s.db.Get(levelDBHeightKey(height), nil)
+	if err != nil {
+		return hash, err
+	}
+	copy(hash[:], hashBytes)
+
+	return hash, nil
+}
+
+func (s *levelDBBlockStore) Iterate(from, to uint64, fn func(blockFs BlockFS) (bool, error)) error {
+	for height := from; height <= to; height++ {
+		hash, err := s.heightHash(height)
+		if err == leveldb.ErrNotFound {
+			// Reached the top of the chain
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		blockFs, err := s.GetByHash(hash)
+		if err != nil {
+			return err
+		}
+
+		next, err := fn(blockFs)
+		if err != nil {
+			return err
+		}
+
+		if !next {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *levelDBBlockStore) Latest() (BlockFS, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.latest, s.hasLatest, nil
+}
+
+func (s *levelDBBlockStore) Truncate(fromHeight uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.hasLatest || fromHeight > s.latest.Value.Header.Number {
+		return nil
+	}
+
+	batch := new(leveldb.Batch)
+	for height := fromHeight; height <= s.latest.Value.Header.Number; height++ {
+		blockFs, err := s.GetByHeight(height)
+		if err != nil {
+			return err
+		}
+
+		batch.Delete(levelDBBlockKey(blockFs.Key))
+		batch.Delete(levelDBHeightKey(height))
+	}
+
+	latest := BlockFS{}
+	hasLatest := false
+
+	if fromHeight > 0 {
+		var err error
+		latest, err = s.GetByHeight(fromHeight - 1)
+		if err != nil {
+			return err
+		}
+		hasLatest = true
+
+		batch.Put(levelDBLatestKey, latest.Key[:])
+	} else {
+		batch.Delete(levelDBLatestKey)
+	}
+
+	err := s.db.Write(batch, levelDBSyncWrite)
+	if err != nil {
+		return err
+	}
+
+	s.latest = latest
+	s.hasLatest = hasLatest
+
+	return nil
+}
+
+func (s *levelDBBlockStore) Close() error {
+	return s.db.Close()
+}
+
+func levelDBBlockKey(hash Hash) []byte {
+	return append(append([]byte{}, levelDBBlockPrefix...), hash[:]...)
+}
+
+func levelDBHeightKey(height uint64) []byte {
+	key := make([]byte, len(levelDBHeightPrefix)+8)
+	copy(key, levelDBHeightPrefix)
+	binary.BigEndian.PutUint64(key[len(levelDBHeightPrefix):], height)
+
+	return key
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Iterating past the latest block stops without an error
+//   - Iterating a closed DB returns the DB error instead of stopping silently
+func TestLevelDBBlockStore_IterateErrors(t *testing.T) {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	store, err := newLevelDBBlockStore(filepath.Join(dataDir, "blocks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Put(BlockFS{Key: Hash{1}, Value: NewBlock(Hash{}, 0, 0, 0, NewAccount(testBabaYagaAccount), nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iterated := 0
+	err = store.Iterate(0, 5, func(blockFs BlockFS) (bool, error) {
+		iterated++
+		return true, nil
+	})
+	if err != nil || iterated != 1 {
+		t.Fatalf("iterating past the latest block should stop after 1 block without an error, got %d blocks and %v", iterated, err)
+	}
+
+	_ = store.Close()
+
+	err = store.Iterate(0, 5, func(blockFs BlockFS) (bool, error) {
+		return true, nil
+	})
+	if err == nil {
+		t.Error("iterating a closed DB should return its error")
+	}
+}
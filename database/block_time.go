@@ -0,0 +1,104 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Since the TIP7 fork a block time must be later than the median time of the previous blocks
+// and can't be too far ahead of the node clock.
+const medianTimeBlocks = 11
+const MaxBlockTimeDrift = 15 * time.Minute
+
+// ErrBlockTimeInFuture marks blocks which may become valid later, once the node clock catches up.
+var ErrBlockTimeInFuture = errors.New("block time is too far in the future")
+
+// SetClock replaces the clock validating the block times, time.Now by default.
+func (s *State) SetClock(clock func() time.Time) {
+	s.clock = clock
+}
+
+// MedianTimePast returns the median time of the latest blocks, the next block time must be later.
+func (s *State) MedianTimePast() uint64 {
+	if len(s.recentBlockTimes) == 0 {
+		return 0
+	}
+
+	times := append([]uint64{}, s.recentBlockTimes...)
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	return times[len(times)/2]
+}
+
+// verifyBlockTime checks the block time against the median time past.
+func (s *State) verifyBlockTime(b Block) error {
+	if !s.config.IsActive(ForkTIP7, b.Header.Number) {
+		return nil
+	}
+
+	medianTime := s.MedianTimePast()
+	if len(s.recentBlockTimes) > 0 && b.Header.Time <= medianTime {
+		return fmt.Errorf("invalid block time %d. must be later than %d, the median time of the last %d blocks", b.Header.Time, medianTime, len(s.recentBlockTimes))
+	}
+
+	return nil
+}
+
+// verifyBlockTimeDrift checks a new block time against the node clock.
+//
+// Only blocks being imported are checked, the stored blocks replayed later were valid when imported
+// and must stay valid with any node clock.
+func (s *State) verifyBlockTimeDrift(b Block) error {
+	if !s.config.IsActive(ForkTIP7, b.Header.Number) {
+		return nil
+	}
+
+	now := s.clock()
+	if time.Unix(int64(b.Header.Time), 0).After(now.Add(MaxBlockTimeDrift)) {
+		return fmt.Errorf("invalid block time %d. %w, the node clock is %d and the max drift is %s", b.Header.Time, ErrBlockTimeInFuture, now.Unix(), MaxBlockTimeDrift)
+	}
+
+	return nil
+}
+
+// recordBlockTime keeps the times of the latest blocks for the median time past.
+func (s *State) recordBlockTime(b Block) {
+	s.recentBlockTimes = append(s.recentBlockTimes, b.Header.Time)
+
+	if len(s.recentBlockTimes) > medianTimeBlocks {
+		s.recentBlockTimes = s.recentBlockTimes[len(s.recentBlockTimes)-medianTimeBlocks:]
+	}
+}
+
+// loadRecentBlockTimes reads the times of the latest main chain blocks up to, and including, the given height.
+func (s *State) loadRecentBlockTimes(height uint64) error {
+	from := uint64(0)
+	if height >= medianTimeBlocks {
+		from = height - medianTimeBlocks + 1
+	}
+
+	s.recentBlockTimes = make([]uint64, 0, medianTimeBlocks)
+
+	return s.store.Iterate(from, height, func(blockFs BlockFS) (bool, error) {
+		s.recordBlockTime(blockFs.Value)
+
+		return true, nil
+	})
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Andrej mines 3 blocks 10 seconds apart, the median time past is the second block time
+//   - A block not later than the median time past is rejected
+//   - A block too far ahead of the node clock is rejected until the clock catches up
+//   - The median time past is rebuilt when the state is reloaded from disk
+//   - The stored blocks replay with the node clock behind them
+func TestState_BlockTimeRules(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startTime := uint64(1600000000)
+	now := time.Unix(int64(startTime)+30, 0)
+	state.SetClock(func() time.Time { return now })
+
+	nonce := uint(0)
+	for i := uint64(0); i < 3; i++ {
+		nonce++
+		_, err := state.AddBlock(mineTestBlockAt(t, state, startTime+i*10, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, nonce)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if state.MedianTimePast() != startTime+10 {
+		t.Fatalf("median time past should be %d not %d", startTime+10, state.MedianTimePast())
+	}
+
+	nonce++
+	staleBlock := mineTestBlockAt(t, state, startTime+10, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, nonce))
+	if _, err := state.AddBlock(staleBlock); err == nil {
+		t.Fatal("block not later than the median time past should be rejected")
+	}
+
+	futureTime := uint64(now.Add(MaxBlockTimeDrift).Unix()) + 1
+	futureBlock := mineTestBlockAt(t, state, futureTime, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, nonce))
+	_, err = state.AddBlock(futureBlock)
+	if !errors.Is(err, ErrBlockTimeInFuture) {
+		t.Fatalf("block too far in the future should be rejected with '%s' not '%v'", ErrBlockTimeInFuture, err)
+	}
+
+	now = now.Add(time.Second)
+	if _, err := state.AddBlock(futureBlock); err != nil {
+		t.Fatalf("block should be valid once the node clock caught up: %s", err)
+	}
+	_ = state.Close()
+
+	reloadedState, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloadedState.Close()
+
+	if reloadedState.MedianTimePast() != startTime+20 {
+		t.Errorf("reloaded median time past should be %d not %d", startTime+20, reloadedState.MedianTimePast())
+	}
+
+	// The stored blocks replay with a node clock behind them, only imported blocks are checked against it
+	reloadedState.SetClock(func() time.Time { return time.Unix(int64(startTime), 0) })
+	if _, err := reloadedState.stateAt(int64(reloadedState.LatestBlock().Header.Number)); err != nil {
+		t.Errorf("stored blocks should replay regardless of the node clock: %s", err)
+	}
+}
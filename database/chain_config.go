@@ -0,0 +1,153 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import "math/big"
+
+// Fork is the name of a consensus rules change (TIP) activated at a block height configured in the genesis.
+type Fork string
+
+const (
+	// ForkTIP1 introduces gas, replacing the flat TX fee
+	ForkTIP1 Fork = "tip_1"
+	// ForkTIP2 commits the block TXs in a Merkle root in the block header
+	ForkTIP2 Fork = "tip_2"
+	// ForkTIP3 commits the accounts state in a sparse Merkle root in the block header
+	ForkTIP3 Fork = "tip_3"
+	// ForkTIP4 binds signed TXs to the genesis chain ID
+	ForkTIP4 Fork = "tip_4"
+	// ForkTIP5 retargets the mining difficulty from the block times, committed in the block header
+	ForkTIP5 Fork = "tip_5"
+	// ForkTIP6 replaces the zero bytes difficulty with a 256-bit target committed in the block header as Bits
+	ForkTIP6 Fork = "tip_6"
+	// ForkTIP7 requires block times later than the median time past and not too far in the future
+	ForkTIP7 Fork = "tip_7"
+	// ForkTIP8 caps the gas and the encoded TXs size of a block
+	ForkTIP8 Fork = "tip_8"
+	// ForkTIP9 migrates the balances to arbitrary-precision amounts of 10^-18 TBB and TXs to transfer an Amount
+	ForkTIP9 Fork = "tip_9"
+	// ForkTIP10 replaces the legacy JSON signed TXs with typed TXs signed over their canonical binary encoding
+	ForkTIP10 Fork = "tip_10"
+	// ForkTIP11 introduces M-of-N multisig accounts spending with the signatures of their signers
+	ForkTIP11 Fork = "tip_11"
+	// ForkTIP12 introduces locked transfers the recipient can't spend before a height and/or a time
+	ForkTIP12 Fork = "tip_12"
+	// ForkTIP13 introduces user-issued fungible tokens created, transferred and burned by token TXs
+	ForkTIP13 Fork = "tip_13"
+	// ForkTIP14 applies the block TXs sorted by time and by nonce on a tie, like miners sort them, instead of an unstable sort by time
+	ForkTIP14 Fork = "tip_14"
+)
+
+// KnownForks lists the forks this node implements, in activation order.
+var KnownForks = []Fork{ForkTIP1, ForkTIP2, ForkTIP3, ForkTIP4, ForkTIP5, ForkTIP6, ForkTIP7, ForkTIP8, ForkTIP9, ForkTIP10, ForkTIP11, ForkTIP12, ForkTIP13, ForkTIP14}
+
+// ChainConfig holds the consensus params of a chain, loaded from its genesis.
+type ChainConfig struct {
+	ChainID     string
+	BlockReward uint
+	// TxFee is the flat fee per TX before the TIP1 fork
+	TxFee uint
+	// MiningDifficulty is the difficulty of the first block since the TIP5 fork
+	MiningDifficulty uint
+	// TargetBlockTime is the number of seconds between blocks the difficulty retargeting aims for
+	TargetBlockTime uint64
+	// RetargetInterval is the number of blocks between difficulty retargets
+	RetargetInterval uint64
+	// BlockGasLimit and BlockMaxBytes cap the gas and the encoded size of the block TXs since the TIP8 fork
+	BlockGasLimit uint
+	BlockMaxBytes uint64
+	forks         map[Fork]uint64
+}
+
+// IsActive returns true if the fork rules apply to the block at the given height.
+//
+// Forks missing in the genesis fork table are never active.
+func (c ChainConfig) IsActive(fork Fork, height uint64) bool {
+	activation, ok := c.forks[fork]
+
+	return ok && height >= activation
+}
+
+// ForkHeight returns the block height the fork activates at.
+func (c ChainConfig) ForkHeight(fork Fork) (uint64, bool) {
+	activation, ok := c.forks[fork]
+
+	return activation, ok
+}
+
+// AmountUnit is the balance amount of one TBB at the given height: 10^AmountDecimals since the TIP9 fork, 1 before.
+func (c ChainConfig) AmountUnit(height uint64) Amount {
+	if c.IsActive(ForkTIP9, height) {
+		return Amount{tbbSubunits}
+	}
+
+	return NewAmount(1)
+}
+
+// MinerFee is the part of the TX cost paid to the miner: the gas cost since the TIP1 fork, or the flat TX fee before.
+//
+// The gas price is in whole TBB at any height, so the fees stay the same once the balances move to the smallest unit
+// at the TIP9 fork. The gas cost of two uints times the unit can't overflow.
+func (c ChainConfig) MinerFee(tx Tx, height uint64) Amount {
+	if c.IsActive(ForkTIP1, height) {
+		gasCost := new(big.Int).Mul(new(big.Int).SetUint64(uint64(tx.Gas)), new(big.Int).SetUint64(uint64(tx.GasPrice)))
+
+		return Amount{gasCost.Mul(gasCost, c.AmountUnit(height).big())}
+	}
+
+	return Amount{new(big.Int).Mul(new(big.Int).SetUint64(uint64(c.TxFee)), c.AmountUnit(height).big())}
+}
+
+// TxCost is the TX transferred amount plus the miner fee.
+func (c ChainConfig) TxCost(tx Tx, height uint64) (Amount, error) {
+	return tx.TransferredAmount().Add(c.MinerFee(tx, height))
+}
+
+// TxChainID is the chain ID the TXs of the block at the given height must be signed with, empty before the TIP4 fork.
+func (c ChainConfig) TxChainID(height uint64) string {
+	if c.IsActive(ForkTIP4, height) {
+		return c.ChainID
+	}
+
+	return ""
+}
+
+// minerReward is the block reward plus the fees paid by the block TXs.
+func (c ChainConfig) minerReward(b Block) (Amount, error) {
+	reward, err := NewAmount(uint64(c.BlockReward)).Mul(c.AmountUnit(b.Header.Number))
+	if err != nil {
+		return Amount{}, err
+	}
+
+	for _, tx := range b.TXs {
+		reward, err = reward.Add(c.MinerFee(tx.Tx, b.Header.Number))
+		if err != nil {
+			return Amount{}, err
+		}
+	}
+
+	return reward, nil
+}
+
+func isKnownFork(fork Fork) bool {
+	for _, known := range KnownForks {
+		if known == fork {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Since TIP4 only TXs signed for this chain are valid
+//   - A TX signed for another chain, or without a chain, is rejected
+//   - The chain ID is part of the signed payload so it can't be swapped after signing
+func TestValidateTx_ChainID(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if state.TxChainID() != testChainID {
+		t.Fatalf("TXs should be signed for chain '%s' not '%s'", testChainID, state.TxChainID())
+	}
+
+	tx := NewTransferTx(andrej, babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(1), 1, "")
+
+	for _, chainID := range []string{"", "tbb-other-chain"} {
+		signedTx, err := signTx(tx, chainID, andrejKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ValidateTx(signedTx, state); err == nil {
+			t.Errorf("TX signed for chain '%s' should be rejected", chainID)
+		}
+	}
+
+	signedTx, err := signTx(tx, testChainID, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateTx(signedTx, state); err != nil {
+		t.Fatalf("TX signed for this chain should be valid: %s", err)
+	}
+
+	replayedTx := signedTx
+	replayedTx.ChainID = "tbb-other-chain"
+	if ok, _ := replayedTx.IsAuthentic(); ok {
+		t.Fatal("changing the chain ID of a signed TX should invalidate its signature")
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Chain index LevelDB keys:
+//
+//	"t" + TX hash                                     => block height + TX position in the block
+//	"a" + address + block height + position in block  => how the address took part, see accountTxFlag
+//	"head"                                            => block height + block hash of the latest indexed block
+var chainIndexTxPrefix = []byte("t")
+var chainIndexAccountPrefix = []byte("a")
+var chainIndexHeadKey = []byte("head")
+
+// errCorruptChainIndex is returned for index values not decoding, catchUp rebuilds the index from the block store on it.
+var errCorruptChainIndex = errors.New("corrupt chain index")
+
+// The miner reward is indexed at a position after all block TXs
+const minerRewardPosition = ^uint32(0)
+
+type accountTxFlag byte
+
+const (
+	accountTxSent accountTxFlag = 1 << iota
+	accountTxReceived
+	accountTxMinerReward
+)
+
+// chainIndex looks up main chain data without scanning the block store.
+//
+// The index is derived from the block store only, it's caught up or rebuilt from it on start
+// so a crash between persisting a block and indexing it is harmless.
+type chainIndex struct {
+	db *leveldb.DB
+}
+
+// TxLocation is the position of a mined TX in the main chain.
+type TxLocation struct {
+	BlockHeight uint64
+	Index       uint32
+}
+
+func openChainIndex(dataDir string) (*chainIndex, error) {
+	db, err := leveldb.OpenFile(getChainIndexDirPath(dataDir), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chainIndex{db}, nil
+}
+
+// catchUp indexes the stored blocks the index is missing, or rebuilds the whole index if it diverged from the store
+// or doesn't decode.
+func (i *chainIndex) catchUp(store BlockStore) error {
+	latest, ok, err := store.Latest()
+	if err != nil {
+		return err
+	}
+
+	from := uint64(0)
+	headHeight, headHash, hasHead, err := i.head()
+	rebuild := errors.Is(err, errCorruptChainIndex)
+	if err != nil && !rebuild {
+		return err
+	}
+
+	if hasHead {
+		headBlock, err := store.GetByHeight(headHeight)
+		if err == nil && headBlock.Key == headHash {
+			from = headHeight + 1
+		} else {
+			rebuild = true
+		}
+	}
+
+	if rebuild {
+		fmt.Println("Rebuilding the chain index...")
+
+		err = i.clear()
+		if err != nil {
+			return err
+		}
+	}
+
+	if !ok || from > latest.Value.Header.Number {
+		return nil
+	}
+
+	return store.Iterate(from, latest.Value.Header.Number, func(blockFs BlockFS) (bool, error) {
+		return true, i.indexBlock(blockFs)
+	})
+}
+
+func (i *chainIndex) indexBlock(blockFs BlockFS) error {
+	batch := new(leveldb.Batch)
+	height := blockFs.Value.Header.Number
+
+	for index, tx := range blockFs.Value.TXs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return err
+		}
+
+		batch.Put(chainIndexTxKey(txHash), encodeTxLocation(TxLocation{height, uint32(index)}))
+
+		if tx.From == tx.To {
+			batch.Put(chainIndexAccountKey(tx.From, height, uint32(index)), []byte{byte(accountTxSent | accountTxReceived)})
+			continue
+		}
+
+		batch.Put(chainIndexAccountKey(tx.From, height, uint32(index)), []byte{byte(accountTxSent)})
+		batch.Put(chainIndexAccountKey(tx.To, height, uint32(index)), []byte{byte(accountTxReceived)})
+	}
+
+	batch.Put(chainIndexAccountKey(blockFs.Value.Header.Miner, height, minerRewardPosition), []byte{byte(accountTxMinerReward)})
+
+	batch.Put(chainIndexHeadKey, encodeChainIndexHead(blockFs.Value.Header.Number, blockFs.Key))
+
+	return i.db.Write(batch, levelDBSyncWrite)
+}
+
+// unindexBlocks removes the blocks abandoned by a chain reorganization, in ascending height order.
+func (i *chainIndex) unindexBlocks(blocks []BlockFS) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	batch := new(leveldb.Batch)
+
+	for _, blockFs := range blocks {
+		height := blockFs.Value.Header.Number
+
+		for index, tx := range blockFs.Value.TXs {
+			txHash, err := tx.Hash()
+			if err != nil {
+				return err
+			}
+
+			batch.Delete(chainIndexTxKey(txHash))
+			batch.Delete(chainIndexAccountKey(tx.From, height, uint32(index)))
+			batch.Delete(chainIndexAccountKey(tx.To, height, uint32(index)))
+		}
+
+		batch.Delete(chainIndexAccountKey(blockFs.Value.Header.Miner, height, minerRewardPosition))
+	}
+
+	first := blocks[0].Value
+	if first.Header.Number == 0 {
+		batch.Delete(chainIndexHeadKey)
+	} else {
+		batch.Put(chainIndexHeadKey, encodeChainIndexHead(first.Header.Number-1, first.Header.Parent))
+	}
+
+	return i.db.Write(batch, levelDBSyncWrite)
+}
+
+func (i *chainIndex) txLocation(txHash Hash) (TxLocation, bool, error) {
+	value, err := i.db.Get(chainIndexTxKey(txHash), nil)
+	if err == leveldb.ErrNotFound {
+		return TxLocation{}, false, nil
+	}
+	if err != nil {
+		return TxLocation{}, false, err
+	}
+
+	location, err := decodeTxLocation(value)
+	if err != nil {
+		return TxLocation{}, false, err
+	}
+
+	return location, true, nil
+}
+
+// accountTxEntry is a block TX, or the miner reward, the account took part in.
+type accountTxEntry struct {
+	blockHeight uint64
+	position    uint32
+	flag        accountTxFlag
+}
+
+// accountTxs returns up to limit account entries, newest first, preceding the `before` entry.
+// Starts from the newest entry if before is nil.
+func (i *chainIndex) accountTxs(account common.Address, before *accountTxEntry, limit int) ([]accountTxEntry, error) {
+	prefix := append(append([]byte{}, chainIndexAccountPrefix...), account[:]...)
+	keyRange := util.BytesPrefix(prefix)
+	if before != nil {
+		keyRange.Limit = chainIndexAccountKey(account, before.blockHeight, before.position)
+	}
+
+	entries := make([]accountTxEntry, 0)
+
+	iter := i.db.NewIterator(keyRange, nil)
+	for ok := iter.Last(); ok && len(entries) < limit; ok = iter.Prev() {
+		key := iter.Key()[len(prefix):]
+		if len(key) != 12 || len(iter.Value()) != 1 {
+			iter.Release()
+			return nil, fmt.Errorf("%w. Account '%s' entry has a %d bytes key and a %d bytes value", errCorruptChainIndex, account.String(), len(key), len(iter.Value()))
+		}
+
+		entries = append(entries, accountTxEntry{
+			blockHeight: binary.BigEndian.Uint64(key[:8]),
+			position:    binary.BigEndian.Uint32(key[8:]),
+			flag:        accountTxFlag(iter.Value()[0]),
+		})
+	}
+	iter.Release()
+
+	return entries, iter.Error()
+}
+
+func (i *chainIndex) head() (uint64, Hash, bool, error) {
+	value, err := i.db.Get(chainIndexHeadKey, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, Hash{}, false, nil
+	}
+	if err != nil {
+		return 0, Hash{}, false, err
+	}
+
+	height, hash, err := decodeChainIndexHead(value)
+	if err != nil {
+		return 0, Hash{}, false, err
+	}
+
+	return height, hash, true, nil
+}
+
+func (i *chainIndex) clear() error {
+	batch := new(leveldb.Batch)
+
+	iter := i.db.NewIterator(&util.Range{}, nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+
+	err := iter.Error()
+	if err != nil {
+		return err
+	}
+
+	return i.db.Write(batch, levelDBSyncWrite)
+}
+
+func (i *chainIndex) close() error {
+	return i.db.Close()
+}
+
+func chainIndexTxKey(txHash Hash) []byte {
+	return append(append([]byte{}, chainIndexTxPrefix...), txHash[:]...)
+}
+
+func chainIndexAccountKey(account common.Address, height uint64, position uint32) []byte {
+	prefixLen := len(chainIndexAccountPrefix) + len(account)
+
+	key := make([]byte, prefixLen+12)
+	copy(key, chainIndexAccountPrefix)
+	copy(key[len(chainIndexAccountPrefix):], account[:])
+	binary.BigEndian.PutUint64(key[prefixLen:], height)
+	binary.BigEndian.PutUint32(key[prefixLen+8:], position)
+
+	return key
+}
+
+func encodeTxLocation(location TxLocation) []byte {
+	value := make([]byte, 12)
+	binary.BigEndian.PutUint64(value[:8], location.BlockHeight)
+	binary.BigEndian.PutUint32(value[8:], location.Index)
+
+	return value
+}
+
+func decodeTxLocation(value []byte) (TxLocation, error) {
+	if len(value) != 12 {
+		return TxLocation{}, fmt.Errorf("%w. TX location has %d bytes, not 12", errCorruptChainIndex, len(value))
+	}
+
+	return TxLocation{binary.BigEndian.Uint64(value[:8]), binary.BigEndian.Uint32(value[8:])}, nil
+}
+
+func encodeChainIndexHead(height uint64, hash Hash) []byte {
+	value := make([]byte, 8+len(hash))
+	binary.BigEndian.PutUint64(value[:8], height)
+	copy(value[8:], hash[:])
+
+	return value
+}
+
+func decodeChainIndexHead(value []byte) (uint64, Hash, error) {
+	var hash Hash
+	if len(value) != 8+len(hash) {
+		return 0, Hash{}, fmt.Errorf("%w. Head has %d bytes, not %d", errCorruptChainIndex, len(value), 8+len(hash))
+	}
+
+	copy(hash[:], value[8:])
+
+	return binary.BigEndian.Uint64(value[:8]), hash, nil
+}
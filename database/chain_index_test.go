@@ -0,0 +1,98 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Andrej sends BabaYaga a TX, indexed with its block
+//   - The TX location and the index head get truncated on disk, decoding them errors instead of panicking
+//   - Reloading the state rebuilds the index from the block store and finds the TX again
+func TestChainIndex_CorruptValues(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := signTestTx(t, andrejKey, andrej, babaYaga, 10, 1)
+	txHash, err := tx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, andrej, tx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = state.Close()
+
+	index, err := openChainIndex(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = index.db.Put(chainIndexTxKey(txHash), []byte{1, 2, 3}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = index.db.Put(chainIndexHeadKey, []byte{1, 2, 3}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := index.txLocation(txHash); !errors.Is(err, errCorruptChainIndex) {
+		t.Errorf("truncated TX location should fail to decode, got: %v", err)
+	}
+
+	if _, _, _, err := index.head(); !errors.Is(err, errCorruptChainIndex) {
+		t.Errorf("truncated index head should fail to decode, got: %v", err)
+	}
+	_ = index.close()
+
+	state, err = NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatalf("the corrupt chain index should be rebuilt: %s", err)
+	}
+	defer state.Close()
+
+	minedTx, ok, err := GetMinedTx(state, txHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || minedTx.BlockHeight != 0 {
+		t.Errorf("TX should be found in block 0 after rebuilding the index, found: %t", ok)
+	}
+}
@@ -16,89 +16,266 @@
 package database
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
 	"os"
-	"reflect"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
-func GetBlocksAfter(blockHash Hash, dataDir string) ([]Block, error) {
-	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDONLY, 0600)
+// GetBlocksAfter returns the main chain blocks following the given block hash.
+//
+// An empty hash returns the whole chain, an unknown hash returns no blocks.
+func GetBlocksAfter(state *State, blockHash Hash) ([]Block, error) {
+	blocks := make([]Block, 0)
+
+	latest, ok, err := state.store.Latest()
+	if err != nil || !ok {
+		return blocks, err
+	}
+
+	from := uint64(0)
+	if !blockHash.IsEmpty() {
+		blockFs, err := state.store.GetByHash(blockHash)
+		if err != nil {
+			return blocks, nil
+		}
+
+		from = blockFs.Value.Header.Number + 1
+	}
+
+	err = state.store.Iterate(from, latest.Value.Header.Number, func(blockFs BlockFS) (bool, error) {
+		blocks = append(blocks, blockFs.Value)
+
+		return true, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	blocks := make([]Block, 0)
-	shouldStartCollecting := false
+	return blocks, nil
+}
+
+// GetBlockByHeightOrHash returns the requested block by hash or height.
+// It uses the State's block store indexes.
+func GetBlockByHeightOrHash(state *State, height uint64, hash string) (BlockFS, error) {
+	if hash != "" {
+		var blockHash Hash
+		err := blockHash.UnmarshalText([]byte(hash))
+		if err != nil {
+			return BlockFS{}, fmt.Errorf("invalid hash: '%v'", hash)
+		}
+
+		return state.store.GetByHash(blockHash)
+	}
+
+	return state.store.GetByHeight(height)
+}
 
-	if reflect.DeepEqual(blockHash, Hash{}) {
-		shouldStartCollecting = true
+// MinedTx is a main chain TX together with the block it was mined in.
+type MinedTx struct {
+	Tx          SignedTx `json:"tx"`
+	BlockHash   Hash     `json:"block_hash"`
+	BlockHeight uint64   `json:"block_height"`
+	Index       uint32   `json:"index"`
+}
+
+// GetMinedTx looks up a main chain TX by its hash using the State's chain index.
+func GetMinedTx(state *State, txHash Hash) (MinedTx, bool, error) {
+	blockFs, location, ok, err := getTxBlock(state, txHash)
+	if err != nil || !ok {
+		return MinedTx{}, false, err
 	}
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return nil, err
+	return MinedTx{blockFs.Value.TXs[location.Index], blockFs.Key, location.BlockHeight, location.Index}, true, nil
+}
+
+const AccountTxIn = "in"
+const AccountTxOut = "out"
+const AccountTxSelf = "self"
+const AccountTxMinerReward = "miner_reward"
+
+// AccountTx is a main chain TX sent or received by an account, or a block reward the account mined.
+type AccountTx struct {
+	Type        string    `json:"type"`
+	BlockHash   Hash      `json:"block_hash"`
+	BlockHeight uint64    `json:"block_height"`
+	Tx          *SignedTx `json:"tx,omitempty"`
+	// Reward is the block reward plus the block TXs fees for the miner reward type
+	Reward *Amount `json:"reward,omitempty"`
+}
+
+// AccountTxsPage is a page of account TXs, newest first.
+type AccountTxsPage struct {
+	TXs []AccountTx `json:"txs"`
+	// NextCursor continues the listing with older TXs, empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+// GetAccountTxs lists the account TXs, newest first, older than the cursor returned with a previous page.
+// An empty cursor starts from the latest block.
+func GetAccountTxs(state *State, account common.Address, cursor string, limit int) (AccountTxsPage, error) {
+	if state.index == nil {
+		return AccountTxsPage{}, fmt.Errorf("the chain index isn't open")
+	}
+
+	var before *accountTxEntry
+	if cursor != "" {
+		var entry accountTxEntry
+		_, err := fmt.Sscanf(cursor, "%d-%d", &entry.blockHeight, &entry.position)
+		if err != nil {
+			return AccountTxsPage{}, fmt.Errorf("invalid cursor: '%s'", cursor)
 		}
+		before = &entry
+	}
+
+	// Fetch one extra entry to tell if there is a next page
+	entries, err := state.index.accountTxs(account, before, limit+1)
+	if err != nil {
+		return AccountTxsPage{}, err
+	}
+
+	page := AccountTxsPage{TXs: make([]AccountTx, 0, limit)}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		last := entries[len(entries)-1]
+		page.NextCursor = fmt.Sprintf("%d-%d", last.blockHeight, last.position)
+	}
 
-		var blockFs BlockFS
-		err = json.Unmarshal(scanner.Bytes(), &blockFs)
+	for _, entry := range entries {
+		blockFs, err := state.store.GetByHeight(entry.blockHeight)
 		if err != nil {
-			return nil, err
+			return AccountTxsPage{}, err
 		}
 
-		if shouldStartCollecting {
-			blocks = append(blocks, blockFs.Value)
+		accountTx := AccountTx{BlockHash: blockFs.Key, BlockHeight: entry.blockHeight}
+
+		if entry.flag == accountTxMinerReward {
+			accountTx.Type = AccountTxMinerReward
+			reward, err := state.config.minerReward(blockFs.Value)
+			if err != nil {
+				return AccountTxsPage{}, err
+			}
+
+			accountTx.Reward = &reward
+			page.TXs = append(page.TXs, accountTx)
 			continue
 		}
 
-		if blockHash == blockFs.Key {
-			shouldStartCollecting = true
+		if int(entry.position) >= len(blockFs.Value.TXs) {
+			return AccountTxsPage{}, fmt.Errorf("chain index points account TX outside of block '%x'", blockFs.Key)
+		}
+
+		switch entry.flag {
+		case accountTxSent:
+			accountTx.Type = AccountTxOut
+		case accountTxReceived:
+			accountTx.Type = AccountTxIn
+		default:
+			accountTx.Type = AccountTxSelf
 		}
+
+		accountTx.Tx = &blockFs.Value.TXs[entry.position]
+		page.TXs = append(page.TXs, accountTx)
 	}
 
-	return blocks, nil
+	return page, nil
 }
 
-// GetBlockByHeightOrHash returns the requested block by hash or height.
-// It uses cached data in the State struct (HashCache / HeightCache)
-func GetBlockByHeightOrHash(state *State, height uint64, hash, dataDir string) (BlockFS, error) {
+// RebuildChainIndex drops the TX and account indexes of the data dir and rebuilds them from the stored blocks.
+func RebuildChainIndex(dataDir string) error {
+	store, err := OpenBlockStore(dataDir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
 
-	var block BlockFS
+	err = os.RemoveAll(getChainIndexDirPath(dataDir))
+	if err != nil {
+		return err
+	}
 
-	key, ok := state.HeightCache[height]
-	if hash != "" {
-		key, ok = state.HashCache[hash]
+	index, err := openChainIndex(dataDir)
+	if err != nil {
+		return err
+	}
+	defer index.close()
+
+	return index.catchUp(store)
+}
+
+// GetTxProof looks up the main chain block including the TX and returns the TX Merkle proof.
+//
+// Only blocks mined since the TIP2 fork have a TX root to prove against.
+func GetTxProof(state *State, txHash Hash) (TxProof, error) {
+	blockFs, location, ok, err := getTxBlock(state, txHash)
+	if err != nil {
+		return TxProof{}, err
 	}
 
 	if !ok {
-		if hash != "" {
-			return block, fmt.Errorf("invalid hash: '%v'", hash)
-		}
-		return block, fmt.Errorf("invalid height: '%v'", height)
+		return TxProof{}, fmt.Errorf("TX '%x' not found", txHash)
 	}
 
-	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDONLY, 0600)
+	if blockFs.Value.Header.TxRoot == nil {
+		return TxProof{}, fmt.Errorf("TX '%x' was mined in block '%x' before TIP2 fork and has no TX root", txHash, blockFs.Key)
+	}
+
+	branch, err := TxMerkleBranch(blockFs.Value.TXs, int(location.Index))
 	if err != nil {
-		return block, err
+		return TxProof{}, err
+	}
+
+	return TxProof{txHash, blockFs.Key, blockFs.Value.Header.Number, *blockFs.Value.Header.TxRoot, branch}, nil
+}
+
+func getTxBlock(state *State, txHash Hash) (BlockFS, TxLocation, bool, error) {
+	if state.index == nil {
+		return BlockFS{}, TxLocation{}, false, fmt.Errorf("the chain index isn't open")
 	}
-	defer f.Close()
 
-	_, err = f.Seek(key, 0)
+	location, ok, err := state.index.txLocation(txHash)
+	if err != nil || !ok {
+		return BlockFS{}, TxLocation{}, false, err
+	}
+
+	blockFs, err := state.store.GetByHeight(location.BlockHeight)
 	if err != nil {
-		return block, err
+		return BlockFS{}, TxLocation{}, false, err
 	}
-	scanner := bufio.NewScanner(f)
-	if scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return block, err
-		}
-		err = json.Unmarshal(scanner.Bytes(), &block)
+
+	if int(location.Index) >= len(blockFs.Value.TXs) {
+		return BlockFS{}, TxLocation{}, false, fmt.Errorf("chain index points TX '%x' outside of block '%x'", txHash, blockFs.Key)
+	}
+
+	return blockFs, location, true, nil
+}
+
+// GetAccountProof returns the account balance and nonce with a proof against the state root of the block
+// requested by hash or height.
+//
+// Only blocks mined since the TIP3 fork have a state root to prove against. The latest block is proven from
+// the current state, older blocks only at the state snapshot heights so a request never replays the chain.
+func GetAccountProof(state *State, account common.Address, height uint64, hash string) (AccountProof, error) {
+	blockFs, err := GetBlockByHeightOrHash(state, height, hash)
+	if err != nil {
+		return AccountProof{}, err
+	}
+
+	if blockFs.Value.Header.StateRoot == nil {
+		return AccountProof{}, fmt.Errorf("block '%x' was mined before TIP3 fork and has no state root", blockFs.Key)
+	}
+
+	blockState := state
+	if blockFs.Key != state.latestBlockHash {
+		blockState, err = state.snapshotStateAt(blockFs.Value.Header.Number)
 		if err != nil {
-			return block, err
+			return AccountProof{}, fmt.Errorf("block %d proofs are unavailable, only the latest block and the state snapshot heights are proven. %s", blockFs.Value.Header.Number, err)
 		}
 	}
 
-	return block, nil
+	proof := blockState.accountProof(account)
+	proof.BlockHash = blockFs.Key
+	proof.BlockNumber = blockFs.Value.Header.Number
+
+	return proof, nil
 }
@@ -0,0 +1,227 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// retargetWindow tracks the blocks mined since the last difficulty retarget.
+type retargetWindow struct {
+	Difficulty uint `json:"difficulty,omitempty"`
+	// Bits replace the difficulty since the TIP6 fork
+	Bits        uint32 `json:"bits,omitempty"`
+	StartHeight uint64 `json:"start_height"`
+	StartTime   uint64 `json:"start_time"`
+}
+
+// NextDifficulty returns the mining difficulty the next block must be mined at.
+//
+// Since the TIP5 fork the difficulty is retargeted every RetargetInterval blocks from the actual block times.
+// Before, the difficulty is static.
+func (s *State) NextDifficulty() uint {
+	next := s.NextBlockNumber()
+
+	if !s.config.IsActive(ForkTIP5, next) {
+		return s.miningDifficulty
+	}
+
+	// The first block since the fork starts at the genesis difficulty
+	if s.retarget.Difficulty == 0 {
+		return s.config.MiningDifficulty
+	}
+
+	if !s.isRetargetDue() {
+		return s.retarget.Difficulty
+	}
+
+	return s.config.retargetDifficulty(s.retarget.Difficulty, s.retargetTimespan(), s.latestBlock.Header.Number-s.retarget.StartHeight)
+}
+
+// NextBits returns the compact target the next block must be mined at since the TIP6 fork.
+//
+// The first block since the fork continues at the target equivalent to the mining difficulty before the fork.
+func (s *State) NextBits() uint32 {
+	if s.retarget.Bits == 0 {
+		// Only a static difficulty overridden past the max can exceed it, the hardest target applies then
+		difficulty := s.NextDifficulty()
+		if difficulty > MaxMiningDifficulty {
+			difficulty = MaxMiningDifficulty
+		}
+
+		target, _ := DifficultyToTarget(difficulty)
+
+		return TargetToBits(target)
+	}
+
+	if !s.isRetargetDue() {
+		return s.retarget.Bits
+	}
+
+	return s.config.retargetBits(s.retarget.Bits, s.retargetTimespan(), s.latestBlock.Header.Number-s.retarget.StartHeight)
+}
+
+// isRetargetDue returns true if the next block starts a new retarget window.
+func (s *State) isRetargetDue() bool {
+	return s.NextBlockNumber()%s.config.RetargetInterval == 0 && s.latestBlock.Header.Number > s.retarget.StartHeight
+}
+
+// retargetTimespan returns the seconds between the first and the latest block of the retarget window.
+func (s *State) retargetTimespan() uint64 {
+	if s.latestBlock.Header.Time > s.retarget.StartTime {
+		return s.latestBlock.Header.Time - s.retarget.StartTime
+	}
+
+	return 0
+}
+
+// retargetDifficulty moves the difficulty one step towards the target block time.
+//
+// A difficulty step multiplies the mining work by 256 so the difficulty only changes
+// when the blocks were mined more than twice faster, or slower, than targeted. It can't exceed MaxMiningDifficulty.
+func (c ChainConfig) retargetDifficulty(difficulty uint, timespan uint64, blocks uint64) uint {
+	expected := blocks * c.TargetBlockTime
+
+	if timespan < expected/2 && difficulty < MaxMiningDifficulty {
+		return difficulty + 1
+	}
+
+	if timespan > expected*2 && difficulty > 1 {
+		return difficulty - 1
+	}
+
+	return difficulty
+}
+
+// retargetBits scales the target by the ratio of the actual and the targeted block times.
+//
+// The adjustment is limited to 4x in both directions and the target can't get easier than the difficulty 1.
+func (c ChainConfig) retargetBits(bits uint32, timespan uint64, blocks uint64) uint32 {
+	expected := blocks * c.TargetBlockTime
+
+	if timespan < expected/4 {
+		timespan = expected / 4
+	}
+
+	if timespan > expected*4 {
+		timespan = expected * 4
+	}
+
+	target := BitsToTarget(bits)
+	target.Mul(target, new(big.Int).SetUint64(timespan))
+	target.Div(target, new(big.Int).SetUint64(expected))
+
+	if target.Cmp(maxTarget) > 0 {
+		target = maxTarget
+	}
+
+	if target.Sign() == 0 {
+		target = big.NewInt(1)
+	}
+
+	return TargetToBits(target)
+}
+
+// verifyBlockDifficulty checks the block commits to the difficulty, or target, required by the fork schedule and satisfies it.
+func (s *State) verifyBlockDifficulty(hash Hash, b Block) error {
+	switch {
+	case s.config.IsActive(ForkTIP6, b.Header.Number):
+		bits := s.NextBits()
+		if b.Header.Bits == nil || *b.Header.Bits != bits {
+			return fmt.Errorf("invalid block bits. expected: %08x", bits)
+		}
+
+		if b.Header.Difficulty != nil {
+			return fmt.Errorf("invalid block. `Difficulty` is replaced by `Bits` since TIP6 fork")
+		}
+	case s.config.IsActive(ForkTIP5, b.Header.Number):
+		difficulty := s.NextDifficulty()
+		if b.Header.Difficulty == nil || *b.Header.Difficulty != difficulty {
+			return fmt.Errorf("invalid block difficulty. expected: %d", difficulty)
+		}
+
+		if b.Header.Bits != nil {
+			return fmt.Errorf("invalid block. `Bits` can't be populated before TIP6 fork is active")
+		}
+	default:
+		if b.Header.Difficulty != nil {
+			return fmt.Errorf("invalid block. `Difficulty` can't be populated before TIP5 fork is active")
+		}
+
+		if b.Header.Bits != nil {
+			return fmt.Errorf("invalid block. `Bits` can't be populated before TIP6 fork is active")
+		}
+	}
+
+	return s.verifyBlockPoW(hash, b)
+}
+
+// verifyBlockPoW checks the block hash satisfies the target, or difficulty, claimed in the block header.
+func (s *State) verifyBlockPoW(hash Hash, b Block) error {
+	if b.Header.Bits != nil {
+		if !IsBlockHashBelowTarget(hash, BitsToTarget(*b.Header.Bits)) {
+			return fmt.Errorf("invalid block hash %x. exceeds the block target", hash)
+		}
+
+		return nil
+	}
+
+	if !IsBlockHashValid(hash, s.blockDifficulty(b)) {
+		return fmt.Errorf("invalid block hash %x", hash)
+	}
+
+	return nil
+}
+
+// blockWork returns the expected number of hash attempts needed to mine the block.
+func (s *State) blockWork(b Block) *big.Int {
+	if b.Header.Bits != nil {
+		return TargetWork(BitsToTarget(*b.Header.Bits))
+	}
+
+	return BlockWork(s.blockDifficulty(b))
+}
+
+// blockDifficulty returns the difficulty the block claims to be mined at.
+func (s *State) blockDifficulty(b Block) uint {
+	if b.Header.Difficulty != nil {
+		return *b.Header.Difficulty
+	}
+
+	return s.miningDifficulty
+}
+
+// updateRetargetWindow starts a new retarget window with the first block mined at a retargeted difficulty, or target.
+func (s *State) updateRetargetWindow(b Block) {
+	s.retarget = s.config.nextRetargetWindow(s.retarget, b)
+}
+
+// nextRetargetWindow returns the retarget window after the block, a new one if the block starts it.
+func (c ChainConfig) nextRetargetWindow(window retargetWindow, b Block) retargetWindow {
+	switch {
+	case b.Header.Bits != nil:
+		if window.Bits == 0 || b.Header.Number%c.RetargetInterval == 0 {
+			return retargetWindow{Bits: *b.Header.Bits, StartHeight: b.Header.Number, StartTime: b.Header.Time}
+		}
+	case b.Header.Difficulty != nil:
+		if window.Difficulty == 0 || b.Header.Number%c.RetargetInterval == 0 {
+			return retargetWindow{Difficulty: *b.Header.Difficulty, StartHeight: b.Header.Number, StartTime: b.Header.Time}
+		}
+	}
+
+	return window
+}
@@ -0,0 +1,231 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - The chain retargets the difficulty every 3 blocks aiming for a block every minute
+//   - Andrej mines blocks 0-2 one second apart, the difficulty of block 3 goes up
+//   - A block 3 keeping the old difficulty is rejected
+//   - Andrej mines blocks 3-5 with long pauses, the difficulty of block 6 goes back down
+func TestState_RetargetDifficulty(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	forks := map[Fork]uint64{
+		ForkTIP1: 0,
+		ForkTIP2: 0,
+		ForkTIP3: 0,
+		ForkTIP4: 0,
+		ForkTIP5: 0,
+	}
+
+	genesisJson, err := json.Marshal(Genesis{
+		ChainID:          testChainID,
+		Balances:         map[common.Address]uint{andrej: 1000},
+		MiningDifficulty: GenesisParam(1),
+		TargetBlockTime:  60,
+		RetargetInterval: 3,
+		Forks:            forks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = InitDataDirIfNotExists(dataDir, genesisJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	blockTime := uint64(1600000000)
+	nonce := uint(0)
+	addBlock := func(blockTime uint64) {
+		nonce++
+
+		_, err := state.AddBlock(mineTestBlockAt(t, state, blockTime, andrej, signTestValueTx(t, andrejKey, andrej, babaYaga, 1, nonce)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := uint64(0); i < 3; i++ {
+		addBlock(blockTime + i)
+	}
+
+	if state.NextDifficulty() != 2 {
+		t.Fatalf("difficulty of block 3 should go up to 2 not %d", state.NextDifficulty())
+	}
+
+	staleBlock := newTestBlockAt(t, state, blockTime+3, andrej, signTestValueTx(t, andrejKey, andrej, babaYaga, 1, nonce+1))
+	staleDifficulty := uint(1)
+	staleBlock.Header.Difficulty = &staleDifficulty
+	minedStaleBlock := powTestBlock(t, staleBlock)
+
+	_, err = state.AddBlock(minedStaleBlock)
+	if err == nil {
+		t.Fatal("block 3 mined at the old difficulty should be rejected")
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		addBlock(blockTime + i*1000)
+	}
+
+	if *state.LatestBlock().Header.Difficulty != 2 {
+		t.Fatalf("block 5 should be mined at difficulty 2 not %d", *state.LatestBlock().Header.Difficulty)
+	}
+
+	if state.NextDifficulty() != 1 {
+		t.Fatalf("difficulty of block 6 should go down to 1 not %d", state.NextDifficulty())
+	}
+}
+
+// The test logic summary:
+//   - Since TIP6 the chain retargets a 256-bit target every 3 blocks aiming for a block every minute
+//   - The first target is equivalent to the genesis difficulty
+//   - Andrej mines blocks 0-2 one second apart, the target of block 3 gets 4 times harder, the max adjustment
+//   - A block 3 keeping the old target is rejected
+//   - Andrej mines blocks 3-5 with long pauses, the target of block 6 gets easier again
+func TestState_RetargetBits(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	forks := make(map[Fork]uint64)
+	for _, fork := range KnownForks {
+		forks[fork] = 0
+	}
+
+	genesisJson, err := json.Marshal(Genesis{
+		ChainID:          testChainID,
+		Balances:         map[common.Address]uint{andrej: 1000},
+		MiningDifficulty: GenesisParam(1),
+		TargetBlockTime:  60,
+		RetargetInterval: 3,
+		Forks:            forks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = InitDataDirIfNotExists(dataDir, genesisJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	initialBits := TargetToBits(maxTarget)
+	if state.NextBits() != initialBits {
+		t.Fatalf("bits of block 0 should be %08x not %08x", initialBits, state.NextBits())
+	}
+
+	blockTime := uint64(1600000000)
+	nonce := uint(0)
+	addBlock := func(blockTime uint64) {
+		nonce++
+
+		_, err := state.AddBlock(mineTestBlockAt(t, state, blockTime, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, nonce)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := uint64(0); i < 3; i++ {
+		addBlock(blockTime + i)
+	}
+
+	harderTarget := new(big.Int).Div(BitsToTarget(initialBits), big.NewInt(4))
+	if state.NextBits() != TargetToBits(harderTarget) {
+		t.Fatalf("bits of block 3 should be %08x not %08x", TargetToBits(harderTarget), state.NextBits())
+	}
+
+	staleBlock := newTestBlockAt(t, state, blockTime+3, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, nonce+1))
+	staleBlock.Header.Bits = &initialBits
+	minedStaleBlock := powTestBlock(t, staleBlock)
+
+	_, err = state.AddBlock(minedStaleBlock)
+	if err == nil {
+		t.Fatal("block 3 mined at the old target should be rejected")
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		addBlock(blockTime + i*1000)
+	}
+
+	if BitsToTarget(state.NextBits()).Cmp(harderTarget) <= 0 {
+		t.Fatalf("target of block 6 should be easier than %x, got %x", harderTarget, BitsToTarget(state.NextBits()))
+	}
+}
+
+// The test logic summary:
+//   - Difficulties past the 32 bytes of a hash have no target instead of shifting past 256 bits
+//   - The retargeted difficulty stops at the max however fast the blocks are mined
+//   - A genesis past the max difficulty is rejected
+func TestMaxMiningDifficulty(t *testing.T) {
+	if _, err := DifficultyToTarget(MaxMiningDifficulty + 1); err == nil {
+		t.Errorf("difficulty %d should have no target", MaxMiningDifficulty+1)
+	}
+
+	target, err := DifficultyToTarget(MaxMiningDifficulty)
+	if err != nil || target.Sign() != 0 {
+		t.Errorf("max difficulty target should be 0, got %v, %v", target, err)
+	}
+
+	config := DefaultGenesis().ChainConfig()
+	if difficulty := config.retargetDifficulty(MaxMiningDifficulty, 0, 100); difficulty != MaxMiningDifficulty {
+		t.Errorf("retargeted difficulty should stop at %d not %d", MaxMiningDifficulty, difficulty)
+	}
+
+	genesis := Genesis{ChainID: testChainID, MiningDifficulty: GenesisParam(MaxMiningDifficulty + 1)}
+	if err := genesis.validate(); err == nil {
+		t.Errorf("genesis difficulty %d should be rejected", MaxMiningDifficulty+1)
+	}
+}
@@ -0,0 +1,562 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrStateOutOfSync is returned when a failed chain reorganization left the block store in a state
+// the state can't be rebuilt from, the node must be restarted to reload it from disk.
+var ErrStateOutOfSync = errors.New("state is out of sync with the block store")
+
+// Blocks this many blocks older than the latest block can no longer be forked from and are forgotten.
+const sideBlocksMaxDepth = 100
+
+// At most this many side branch blocks are kept in memory, new ones are rejected until old ones get pruned.
+const sideBlocksMax = 1000
+
+type blockMeta struct {
+	number    uint64
+	totalWork *big.Int
+	// The block time and the retarget window after the block tell the difficulty of the blocks extending it
+	time     uint64
+	retarget retargetWindow
+}
+
+// ImportBlock adds the block to the blockchain following the heaviest chain fork-choice rule.
+//
+// A block extending the latest block is applied straight away. A block extending any other known block is kept
+// on a side branch and once its branch accumulates more work than the main chain, the state is rolled back
+// to the common ancestor and the side branch is re-applied as the new main chain.
+//
+// TXs from the abandoned main chain blocks, not included in the new main chain, are returned
+// so they can be re-added to the mempool.
+func (s *State) ImportBlock(b Block) (Hash, []SignedTx, error) {
+	s.blocksLock.Lock()
+	defer s.blocksLock.Unlock()
+
+	blockHash, err := b.Hash()
+	if err != nil {
+		return Hash{}, nil, err
+	}
+
+	if s.isKnownBlock(blockHash) {
+		return Hash{}, nil, fmt.Errorf("block '%x' is already known", blockHash)
+	}
+
+	err = s.verifyBlockTimeDrift(b)
+	if err != nil {
+		return Hash{}, nil, err
+	}
+
+	if s.extendsLatestBlock(b) {
+		blockHash, err := s.addLatestBlock(b)
+		if err != nil {
+			return Hash{}, nil, err
+		}
+
+		s.pruneKnownBlocks()
+
+		return blockHash, nil, nil
+	}
+
+	parent, err := s.parentMeta(b)
+	if err != nil {
+		return Hash{}, nil, err
+	}
+
+	if len(s.sideBlocks) >= sideBlocksMax {
+		return Hash{}, nil, fmt.Errorf("too many side branch blocks, at most %d are kept", sideBlocksMax)
+	}
+
+	parentState := s.parentState(b.Header.Parent, parent)
+
+	err = parentState.verifyBlockDifficulty(blockHash, b)
+	if err != nil {
+		return Hash{}, nil, err
+	}
+
+	err = parentState.verifyBlockTime(b)
+	if err != nil {
+		return Hash{}, nil, err
+	}
+
+	meta := s.childMeta(parent, b)
+	s.sideBlocks[blockHash] = b
+	s.knownBlocks[blockHash] = meta
+
+	if meta.totalWork.Cmp(s.totalWork()) <= 0 {
+		fmt.Printf("\nKeeping Block '%x' on a side branch at height %d\n", blockHash, b.Header.Number)
+
+		return blockHash, nil, nil
+	}
+
+	orphanedTXs, err := s.reorg(blockHash)
+	if err != nil {
+		delete(s.sideBlocks, blockHash)
+		delete(s.knownBlocks, blockHash)
+
+		return Hash{}, nil, err
+	}
+
+	s.pruneKnownBlocks()
+
+	return blockHash, orphanedTXs, nil
+}
+
+// TotalWork returns the cumulative work of the main chain.
+func (s *State) TotalWork() *big.Int {
+	s.blocksLock.RLock()
+	defer s.blocksLock.RUnlock()
+
+	return s.totalWork()
+}
+
+func (s *State) totalWork() *big.Int {
+	meta, ok := s.knownBlocks[s.latestBlockHash]
+	if !s.hasGenesisBlock || !ok {
+		return big.NewInt(0)
+	}
+
+	return new(big.Int).Set(meta.totalWork)
+}
+
+// IsKnownBlock returns true if the block is part of the main chain or of one of the tracked side branches.
+func (s *State) IsKnownBlock(hash Hash) bool {
+	s.blocksLock.RLock()
+	defer s.blocksLock.RUnlock()
+
+	return s.isKnownBlock(hash)
+}
+
+func (s *State) isKnownBlock(hash Hash) bool {
+	if _, ok := s.knownBlocks[hash]; ok {
+		return true
+	}
+
+	if s.store == nil {
+		return false
+	}
+
+	_, err := s.store.GetByHash(hash)
+
+	return err == nil
+}
+
+func (s *State) isMainChainBlock(hash Hash) bool {
+	_, isSideBlock := s.sideBlocks[hash]
+
+	return s.isKnownBlock(hash) && !isSideBlock
+}
+
+func (s *State) extendsLatestBlock(b Block) bool {
+	if !s.hasGenesisBlock || b.Header.Parent == s.latestBlockHash {
+		return true
+	}
+
+	// The block right after the genesis block was historically accepted without checking its parent
+	return s.latestBlock.Header.Number == 0 && b.Header.Number == 1 && !s.isKnownBlock(b.Header.Parent)
+}
+
+func (s *State) parentMeta(b Block) (blockMeta, error) {
+	if b.Header.Parent.IsEmpty() {
+		if b.Header.Number != 0 {
+			return blockMeta{}, fmt.Errorf("block without a parent must be '0' not '%d'", b.Header.Number)
+		}
+
+		return blockMeta{totalWork: big.NewInt(0)}, nil
+	}
+
+	parent, ok := s.knownBlocks[b.Header.Parent]
+	if !ok {
+		if s.isKnownBlock(b.Header.Parent) {
+			return blockMeta{}, fmt.Errorf("block parent '%x' is too old to be forked from", b.Header.Parent)
+		}
+
+		return blockMeta{}, fmt.Errorf("unknown block parent '%x'", b.Header.Parent)
+	}
+
+	if b.Header.Number != parent.number+1 {
+		return blockMeta{}, fmt.Errorf("next expected block must be '%d' not '%d'", parent.number+1, b.Header.Number)
+	}
+
+	return parent, nil
+}
+
+// nextBlockMeta calculates the height and the cumulative work of the block extending the main chain.
+func (s *State) nextBlockMeta(b Block) blockMeta {
+	parent, ok := s.knownBlocks[b.Header.Parent]
+	if !ok {
+		parent = blockMeta{totalWork: big.NewInt(0)}
+		if s.hasGenesisBlock {
+			parent = blockMeta{totalWork: s.totalWork(), retarget: s.retarget}
+		}
+	}
+
+	return s.childMeta(parent, b)
+}
+
+// childMeta calculates the meta of the block extending the parent block.
+func (s *State) childMeta(parent blockMeta, b Block) blockMeta {
+	return blockMeta{
+		number:    b.Header.Number,
+		totalWork: new(big.Int).Add(parent.totalWork, s.blockWork(b)),
+		time:      b.Header.Time,
+		retarget:  s.config.nextRetargetWindow(parent.retarget, b),
+	}
+}
+
+// parentState returns a state knowing only the parent block meta and the times of its latest ancestors,
+// enough to verify the difficulty and the time of a block extending it.
+func (s *State) parentState(parentHash Hash, parent blockMeta) *State {
+	return &State{
+		config:           s.config,
+		miningDifficulty: s.miningDifficulty,
+		retarget:         parent.retarget,
+		latestBlock:      Block{Header: BlockHeader{Number: parent.number, Time: parent.time}},
+		hasGenesisBlock:  !parentHash.IsEmpty(),
+		recentBlockTimes: s.branchBlockTimes(parentHash),
+	}
+}
+
+// branchBlockTimes returns the times of the block and its latest ancestors, oldest first, following side branches.
+func (s *State) branchBlockTimes(hash Hash) []uint64 {
+	times := make([]uint64, medianTimeBlocks)
+	i := medianTimeBlocks
+
+	for ; i > 0 && !hash.IsEmpty(); i-- {
+		b, isSideBlock := s.sideBlocks[hash]
+		if !isSideBlock {
+			blockFs, err := s.store.GetByHash(hash)
+			if err != nil {
+				break
+			}
+			b = blockFs.Value
+		}
+
+		times[i-1] = b.Header.Time
+		hash = b.Header.Parent
+	}
+
+	return times[i:]
+}
+
+// dropSideBranch forgets the invalid side block and every side block extending it.
+func (s *State) dropSideBranch(invalid Hash) {
+	dropped := map[Hash]bool{invalid: true}
+
+	for dropping := true; dropping; {
+		dropping = false
+
+		for hash, b := range s.sideBlocks {
+			if !dropped[hash] && dropped[b.Header.Parent] {
+				dropped[hash] = true
+				dropping = true
+			}
+		}
+	}
+
+	for hash := range dropped {
+		delete(s.sideBlocks, hash)
+		delete(s.knownBlocks, hash)
+	}
+}
+
+// reorg switches the main chain to the side branch ending with the newTip block.
+func (s *State) reorg(newTip Hash) ([]SignedTx, error) {
+	branch, err := s.sideBranch(newTip)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestorHeight := int64(branch[0].Value.Header.Number) - 1
+
+	newState, err := s.stateAt(ancestorHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, blockFs := range branch {
+		err = applyBlock(blockFs.Value, newState)
+		if err != nil {
+			// The blocks extending an invalid one would fail the same replay again
+			s.dropSideBranch(blockFs.Key)
+
+			return nil, fmt.Errorf("invalid side branch Block '%x'. %s", blockFs.Key, err.Error())
+		}
+
+		newState.latestBlock = blockFs.Value
+		newState.latestBlockHash = blockFs.Key
+		newState.hasGenesisBlock = true
+	}
+
+	abandoned, err := s.mainBlocksAfter(ancestorHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("\nChain reorganization to Block '%x' at height %d\n", newTip, newState.latestBlock.Header.Number)
+	fmt.Printf("\t%d Blocks abandoned, %d Blocks applied\n", len(abandoned), len(branch))
+
+	err = s.switchMainChain(ancestorHeight, abandoned, branch)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, blockFs := range abandoned {
+		s.sideBlocks[blockFs.Key] = blockFs.Value
+	}
+
+	for _, blockFs := range branch {
+		delete(s.sideBlocks, blockFs.Key)
+	}
+
+	s.adoptChainState(newState)
+
+	s.snapshotIfDue()
+
+	return orphanedTXs(abandoned, branch), nil
+}
+
+// switchMainChain replaces the stored main chain blocks after the common ancestor with the side branch blocks.
+//
+// A failure midway puts the abandoned blocks back. If that fails too, the state is reloaded from the blocks
+// left in the store, so the state never disagrees with the store.
+func (s *State) switchMainChain(ancestorHeight int64, abandoned []BlockFS, branch []BlockFS) error {
+	err := s.replaceMainBlocks(ancestorHeight, abandoned, branch)
+	if err == nil {
+		return nil
+	}
+
+	restoreErr := s.replaceMainBlocks(ancestorHeight, branch, abandoned)
+	if restoreErr == nil {
+		return fmt.Errorf("chain reorganization failed, the main chain was restored. %s", err.Error())
+	}
+
+	reloadErr := s.reloadFromStore()
+	if reloadErr != nil {
+		return fmt.Errorf("%w. Chain reorganization failed: %s. Restoring the main chain failed: %s. Reloading the state failed: %s", ErrStateOutOfSync, err.Error(), restoreErr.Error(), reloadErr.Error())
+	}
+
+	return fmt.Errorf("chain reorganization failed, the state was reloaded from the store. %s", err.Error())
+}
+
+// replaceMainBlocks rolls back the stored main chain to the common ancestor and persists the added blocks on top of it.
+func (s *State) replaceMainBlocks(ancestorHeight int64, removed []BlockFS, added []BlockFS) error {
+	err := s.store.Truncate(uint64(ancestorHeight + 1))
+	if err != nil {
+		return err
+	}
+
+	err = s.removeSnapshotsAfter(ancestorHeight)
+	if err != nil {
+		return err
+	}
+
+	if s.index != nil {
+		err = s.index.unindexBlocks(removed)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, blockFs := range added {
+		err = s.persistBlock(blockFs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reloadFromStore rebuilds the state of the latest stored block, forgetting the side branches.
+func (s *State) reloadFromStore() error {
+	if s.index != nil {
+		err := s.index.catchUp(s.store)
+		if err != nil {
+			return err
+		}
+	}
+
+	latestHeight := int64(-1)
+	latest, ok, err := s.store.Latest()
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		latestHeight = int64(latest.Value.Header.Number)
+	}
+
+	state, err := s.stateAt(latestHeight)
+	if err != nil {
+		return err
+	}
+
+	s.adoptChainState(state)
+	s.knownBlocks = state.knownBlocks
+	s.sideBlocks = make(map[Hash]Block)
+
+	return nil
+}
+
+// adoptChainState switches the state to the accounts and the latest block of the given state.
+func (s *State) adoptChainState(state *State) {
+	s.Balances = state.Balances
+	s.Account2Nonce = state.Account2Nonce
+	s.multisigs = state.multisigs
+	s.locks = state.locks
+	s.tokens = state.tokens
+	s.tokenBalances = state.tokenBalances
+	s.latestBlockHash = state.latestBlockHash
+	s.latestBlock = state.latestBlock
+	s.hasGenesisBlock = state.hasGenesisBlock
+	s.retarget = state.retarget
+	s.recentBlockTimes = state.recentBlockTimes
+}
+
+// sideBranch collects the side branch blocks from the first one after the main chain up to the tip.
+func (s *State) sideBranch(tip Hash) ([]BlockFS, error) {
+	branch := make([]BlockFS, 0)
+
+	for hash := tip; ; {
+		b, isSideBlock := s.sideBlocks[hash]
+		if !isSideBlock {
+			return nil, fmt.Errorf("block '%x' is not part of a side branch", hash)
+		}
+
+		branch = append([]BlockFS{{hash, b}}, branch...)
+
+		if s.isMainChainBlock(b.Header.Parent) || b.Header.Parent.IsEmpty() {
+			return branch, nil
+		}
+
+		hash = b.Header.Parent
+	}
+}
+
+// stateAt rebuilds the state of the main chain up to, and including, the block at the given height.
+//
+// The replay starts from the newest valid snapshot below the height, or from genesis.
+// A negative height returns the genesis state without any blocks.
+func (s *State) stateAt(height int64) (*State, error) {
+	state := s.genesisState()
+
+	if height < 0 {
+		return state, nil
+	}
+
+	from := uint64(0)
+	for _, snapshot := range s.loadSnapshots(uint64(height)) {
+		snapshotState := s.genesisState()
+
+		err := snapshotState.restoreSnapshot(snapshot)
+		if err != nil {
+			fmt.Printf("WARNING: ignoring state snapshot at height %d. %s\n", snapshot.Height, err)
+			continue
+		}
+
+		state = snapshotState
+		from = snapshot.Height + 1
+		break
+	}
+
+	err := s.store.Iterate(from, uint64(height), func(blockFs BlockFS) (bool, error) {
+		err := applyBlock(blockFs.Value, state)
+		if err != nil {
+			return false, err
+		}
+
+		state.knownBlocks[blockFs.Key] = state.nextBlockMeta(blockFs.Value)
+		state.latestBlock = blockFs.Value
+		state.latestBlockHash = blockFs.Key
+		state.hasGenesisBlock = true
+		state.pruneKnownBlocks()
+
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// genesisState returns the state before the first block, reading the blocks from the same store.
+func (s *State) genesisState() *State {
+	state := newStateFromGenesis(s.genesis, s.miningDifficulty)
+	state.store = s.store
+	state.dataDir = s.dataDir
+	state.clock = s.clock
+
+	return state
+}
+
+// mainBlocksAfter reads the persisted main chain blocks higher than the given height.
+func (s *State) mainBlocksAfter(height int64) ([]BlockFS, error) {
+	blocks := make([]BlockFS, 0)
+
+	if !s.hasGenesisBlock || int64(s.latestBlock.Header.Number) <= height {
+		return blocks, nil
+	}
+
+	err := s.store.Iterate(uint64(height+1), s.latestBlock.Header.Number, func(blockFs BlockFS) (bool, error) {
+		blocks = append(blocks, blockFs)
+
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// pruneKnownBlocks forgets blocks too old to be forked from, the main chain ones remain in the block store.
+func (s *State) pruneKnownBlocks() {
+	for hash, meta := range s.knownBlocks {
+		if meta.number+sideBlocksMaxDepth < s.latestBlock.Header.Number {
+			delete(s.sideBlocks, hash)
+			delete(s.knownBlocks, hash)
+		}
+	}
+}
+
+func orphanedTXs(abandoned []BlockFS, branch []BlockFS) []SignedTx {
+	included := make(map[Hash]bool)
+	for _, blockFs := range branch {
+		for _, tx := range blockFs.Value.TXs {
+			txHash, _ := tx.Hash()
+			included[txHash] = true
+		}
+	}
+
+	orphaned := make([]SignedTx, 0)
+	for _, blockFs := range abandoned {
+		for _, tx := range blockFs.Value.TXs {
+			txHash, _ := tx.Hash()
+			if !included[txHash] {
+				orphaned = append(orphaned, tx)
+			}
+		}
+	}
+
+	return orphaned
+}
@@ -0,0 +1,661 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Block 0 is mined by Andrej
+//   - Andrej and BabaYaga mine competing blocks at height 1, Andrej's block arrives first and stays on the main chain
+//   - BabaYaga mines block 2 on top of her block 1, her branch becomes heavier
+//   - The state rolls back to block 0 and applies BabaYaga's branch, Andrej's block 1 TX gets orphaned
+func TestState_ReorgToHeavierSideBranch(t *testing.T) {
+	for _, blockStore := range []string{BlockStoreFile, BlockStoreLevelDB} {
+		t.Run(blockStore, func(t *testing.T) {
+			testStateReorgToHeavierSideBranch(t, blockStore)
+		})
+	}
+}
+
+func testStateReorgToHeavierSideBranch(t *testing.T, blockStore string) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	err = MigrateBlockStore(dataDir, blockStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	// BabaYaga's node follows her own branch to mine blocks on top of it
+	babaYagaDataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(babaYagaDataDir)
+
+	babaYagaState, err := NewStateFromDisk(babaYagaDataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer babaYagaState.Close()
+
+	block0 := mineTestBlock(t, state, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, 1))
+	block0Hash, err := state.AddBlock(block0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = babaYagaState.AddBlock(block0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	andrejTx := signTestTx(t, andrejKey, andrej, babaYaga, 10, 2)
+	block1a := mineTestBlock(t, state, andrej, andrejTx)
+	block1aHash, err := state.AddBlock(block1a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block1b := mineTestBlock(t, babaYagaState, babaYaga, signTestTx(t, andrejKey, andrej, babaYaga, 20, 2))
+	if block1b.Header.Parent != block0Hash {
+		t.Fatalf("BabaYaga's block 1 should be mined on top of block 0")
+	}
+
+	_, err = babaYagaState.AddBlock(block1b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = state.ImportBlock(block1b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.LatestBlockHash() != block1aHash {
+		t.Fatalf("competing block with the same work must not replace the latest block")
+	}
+
+	block2b := mineTestBlock(t, babaYagaState, babaYaga, signTestTx(t, andrejKey, andrej, babaYaga, 30, 3))
+	block2bHash, orphanedTXs, err := state.ImportBlock(block2b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.LatestBlockHash() != block2bHash {
+		t.Fatalf("heavier side branch should become the main chain. Latest block: %x", state.LatestBlockHash())
+	}
+
+	if len(orphanedTXs) != 1 || orphanedTXs[0].Value != andrejTx.Value {
+		t.Fatalf("Andrej's block 1 TX should be orphaned, got %d orphaned TXs", len(orphanedTXs))
+	}
+
+	expectedBabaYagaBalance := AmountFromTBB(1 + 20 + 30 + 2*BlockReward + 2*TxGas*TxGasPriceDefault)
+	if state.Balances[babaYaga].Cmp(expectedBabaYagaBalance) != 0 {
+		t.Errorf("BabaYaga balance is incorrect. Expected: %s. Got: %s", expectedBabaYagaBalance, state.Balances[babaYaga])
+	}
+
+	if state.Account2Nonce[andrej] != 3 {
+		t.Errorf("Andrej nonce is incorrect. Expected: 3. Got: %d", state.Account2Nonce[andrej])
+	}
+
+	andrejTxHash, err := andrejTx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, isMined, _ := GetMinedTx(state, andrejTxHash); isMined {
+		t.Errorf("orphaned TX %x must be removed from the chain index", andrejTxHash)
+	}
+
+	block1, err := GetBlockByHeightOrHash(state, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if block1.Key != block2b.Header.Parent {
+		t.Errorf("block at height 1 should be %x not %x", block2b.Header.Parent, block1.Key)
+	}
+
+	// The reorganized chain must be persisted
+	_ = state.Close()
+
+	reloadedState, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloadedState.Close()
+
+	if reloadedState.LatestBlockHash() != block2bHash {
+		t.Errorf("reloaded latest block should be %x not %x", block2bHash, reloadedState.LatestBlockHash())
+	}
+
+	if reloadedState.Balances[babaYaga].Cmp(state.Balances[babaYaga]) != 0 {
+		t.Errorf("reloaded BabaYaga balance should be %s not %s", state.Balances[babaYaga], reloadedState.Balances[babaYaga])
+	}
+}
+
+// The test logic summary:
+//   - Andrej mines blocks 0 and 1, BabaYaga mines a heavier branch of blocks 1 and 2 on top of block 0
+//   - Persisting BabaYaga's block 2 fails midway through the chain reorganization
+//   - Andrej's block 1 is restored in the store and the state stays on it, the chain index included
+func TestState_ReorgFailureRestoresMainChain(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	babaYagaDataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(babaYagaDataDir)
+
+	babaYagaState, err := NewStateFromDisk(babaYagaDataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer babaYagaState.Close()
+
+	block0 := mineTestBlock(t, state, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, 1))
+	for _, s := range []*State{state, babaYagaState} {
+		_, err = s.AddBlock(block0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	andrejTx := signTestTx(t, andrejKey, andrej, babaYaga, 10, 2)
+	block1aHash, err := state.AddBlock(mineTestBlock(t, state, andrej, andrejTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block1b := mineTestBlock(t, babaYagaState, babaYaga, signTestTx(t, andrejKey, andrej, babaYaga, 20, 2))
+	_, err = babaYagaState.AddBlock(block1b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = state.ImportBlock(block1b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block2b := mineTestBlock(t, babaYagaState, babaYaga, signTestTx(t, andrejKey, andrej, babaYaga, 30, 3))
+	block2bHash, err := block2b.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	balances := state.Copy().Balances
+	state.store = &failingBlockStore{state.store, block2bHash}
+
+	_, _, err = state.ImportBlock(block2b)
+	if err == nil {
+		t.Fatal("chain reorganization should fail when the side branch can't be persisted")
+	}
+
+	if state.LatestBlockHash() != block1aHash {
+		t.Fatalf("latest block should stay %x not %x", block1aHash, state.LatestBlockHash())
+	}
+
+	if state.Balances[babaYaga].Cmp(balances[babaYaga]) != 0 {
+		t.Errorf("BabaYaga balance should stay %s not %s", balances[babaYaga], state.Balances[babaYaga])
+	}
+
+	latest, _, err := state.store.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if latest.Key != block1aHash {
+		t.Errorf("stored latest block should be restored to %x not %x", block1aHash, latest.Key)
+	}
+
+	andrejTxHash, err := andrejTx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, isMined, _ := GetMinedTx(state, andrejTxHash); !isMined {
+		t.Errorf("TX %x of the restored block should be indexed again", andrejTxHash)
+	}
+}
+
+// The test logic summary:
+//   - Andrej mines blocks 0 and 1
+//   - BabaYaga mines a competing block 1 claiming an easier target than block 0 requires, it's rejected
+//   - Her competing block 1 mined at the required target is kept on a side branch
+func TestState_SideBlockDifficulty(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	_, err = state.AddBlock(mineTestBlock(t, state, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block0State := state.Copy()
+	sideTx := signTestTx(t, andrejKey, andrej, babaYaga, 20, 2)
+
+	_, err = state.AddBlock(mineTestBlock(t, state, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 10, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	easyBits := TargetToBits(maxTarget)
+	easyBlock := newTestBlockAt(t, &block0State, uint64(time.Now().Unix()), babaYaga, sideTx)
+	easyBlock.Header.Bits = &easyBits
+	easyBlock = powTestBlock(t, easyBlock)
+
+	_, _, err = state.ImportBlock(easyBlock)
+	if err == nil {
+		t.Fatal("side block claiming an easier target than required should be rejected")
+	}
+
+	sideBlockHash, _, err := state.ImportBlock(mineTestBlock(t, &block0State, babaYaga, sideTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, isSideBlock := state.sideBlocks[sideBlockHash]; !isSideBlock {
+		t.Errorf("block mined at the required target should be kept on a side branch")
+	}
+}
+
+// The test logic summary:
+//   - Andrej mines blocks 0 and 1, BabaYaga competes with a block 1 not later than the median time past, it's rejected
+//   - BabaYaga's block 1 committing a wrong state root is kept on a side branch, only its difficulty and time are known valid
+//   - Her block 2 on top of it triggers the reorganization which fails on block 1, the whole branch is dropped
+//   - A block 3 extending the dropped branch is rejected without replaying the chain again
+func TestState_InvalidSideBranch(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	block0Time := uint64(time.Now().Unix())
+	_, err = state.AddBlock(mineTestBlockAt(t, state, block0Time, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block0State := state.Copy()
+	sideTx := signTestTx(t, andrejKey, andrej, babaYaga, 20, 2)
+
+	_, err = state.AddBlock(mineTestBlockAt(t, state, block0Time+1, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 10, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := state.ImportBlock(mineTestBlockAt(t, &block0State, block0Time, babaYaga, sideTx)); err == nil {
+		t.Fatal("side block not later than the median time past should be rejected")
+	}
+
+	block1b := newTestBlockAt(t, &block0State, block0Time+1, babaYaga, sideTx)
+	block1b.Header.StateRoot = &Hash{1}
+	block1b = powTestBlock(t, block1b)
+	block1bHash, _, err := state.ImportBlock(block1b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block2b := NewBlock(block1bHash, 2, 0, block0Time+2, babaYaga, nil)
+	block2b.Header.Bits = block1b.Header.Bits
+	block2b = powTestBlock(t, block2b)
+	block2bHash, err := block2b.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := state.ImportBlock(block2b); err == nil {
+		t.Fatal("side branch with an invalid block should not become the main chain")
+	}
+
+	for _, hash := range []Hash{block1bHash, block2bHash} {
+		if state.IsKnownBlock(hash) {
+			t.Errorf("block %x of the invalid side branch should be dropped", hash)
+		}
+	}
+
+	block3b := NewBlock(block2bHash, 3, 0, block0Time+3, babaYaga, nil)
+	block3b.Header.Bits = block1b.Header.Bits
+	block3b = powTestBlock(t, block3b)
+	if _, _, err := state.ImportBlock(block3b); err == nil {
+		t.Error("block extending the dropped side branch should be rejected")
+	}
+}
+
+// The test logic summary:
+//   - Andrej mines blocks while another goroutine polls the chain work and the known blocks, as the node HTTP status does
+//   - The reads are guarded against the block imports, run with -race to detect unguarded ones
+func TestState_ConcurrentBlockReads(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	done := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				state.TotalWork()
+				state.IsKnownBlock(Hash{})
+			}
+		}
+	}()
+
+	for nonce := uint(1); nonce <= 3; nonce++ {
+		_, err := state.AddBlock(mineTestBlock(t, state, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, nonce)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	close(done)
+	<-polled
+
+	if state.TotalWork().Sign() <= 0 {
+		t.Error("chain work should be positive after mining 3 blocks")
+	}
+}
+
+// failingBlockStore fails to persist one block, to interrupt a chain reorganization midway
+type failingBlockStore struct {
+	BlockStore
+	failingBlock Hash
+}
+
+func (s *failingBlockStore) Put(blockFs BlockFS) error {
+	if blockFs.Key == s.failingBlock {
+		return errors.New("disk full")
+	}
+
+	return s.BlockStore.Put(blockFs)
+}
+
+// signTestTx signs a typed transfer TX of whole TBB on the test chains having all forks active
+func signTestTx(t *testing.T, privKey *ecdsa.PrivateKey, from, to common.Address, value, nonce uint) SignedTx {
+	tx := NewTransferTx(from, to, TxGas, TxGasPriceDefault, AmountFromTBB(uint64(value)), nonce, "")
+
+	signedTx, err := signTx(tx, testChainID, privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signedTx
+}
+
+// signTestValueTx signs a TX transferring a whole TBB Value on test chains predating the TIP9 fork
+func signTestValueTx(t *testing.T, privKey *ecdsa.PrivateKey, from, to common.Address, value, nonce uint) SignedTx {
+	signedTx, err := signTx(NewBaseTx(from, to, value, nonce, ""), testChainID, privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signedTx
+}
+
+// signTx signs the TX for the given chain the way the wallet does
+func signTx(tx Tx, chainID string, privKey *ecdsa.PrivateKey) (SignedTx, error) {
+	tx.ChainID = chainID
+
+	sig, err := signTestHash(tx, privKey)
+	if err != nil {
+		return SignedTx{}, err
+	}
+
+	return NewSignedTx(tx, sig), nil
+}
+
+// cosignTx adds the signer signature to the multisig spend TX the way the wallet does
+func cosignTx(tx SignedTx, privKey *ecdsa.PrivateKey) (SignedTx, error) {
+	sig, err := signTestHash(tx.Tx, privKey)
+	if err != nil {
+		return SignedTx{}, err
+	}
+
+	tx.Sigs = append(tx.Sigs, sig)
+
+	return tx, nil
+}
+
+func signTestHash(tx Tx, privKey *ecdsa.PrivateKey) ([]byte, error) {
+	rawTx, err := tx.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	txHash := sha256.Sum256(rawTx)
+
+	return crypto.Sign(txHash[:], privKey)
+}
+
+// mineTestBlock mines the TXs in a block on top of the state latest block, timed like the node miner does
+func mineTestBlock(t *testing.T, state *State, miner common.Address, txs ...SignedTx) Block {
+	blockTime := uint64(time.Now().Unix())
+	if state.IsForkActive(ForkTIP7) && blockTime <= state.MedianTimePast() {
+		blockTime = state.MedianTimePast() + 1
+	}
+
+	return mineTestBlockAt(t, state, blockTime, miner, txs...)
+}
+
+// mineTestBlockAt mines the TXs in a block with the given time on top of the state latest block
+func mineTestBlockAt(t *testing.T, state *State, blockTime uint64, miner common.Address, txs ...SignedTx) Block {
+	return powTestBlock(t, newTestBlockAt(t, state, blockTime, miner, txs...))
+}
+
+// newTestBlockAt builds the block of the TXs on top of the state latest block committing its roots and difficulty,
+// like the node miner does, ready to be mined
+func newTestBlockAt(t *testing.T, state *State, blockTime uint64, miner common.Address, txs ...SignedTx) Block {
+	b := NewBlock(state.LatestBlockHash(), state.NextBlockNumber(), 0, blockTime, miner, txs)
+
+	txRoot, err := TxRoot(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Header.TxRoot = &txRoot
+
+	stateRoot, err := state.NextStateRoot(miner, txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Header.StateRoot = &stateRoot
+
+	if state.IsForkActive(ForkTIP6) {
+		bits := state.NextBits()
+		b.Header.Bits = &bits
+	} else if state.IsForkActive(ForkTIP5) {
+		difficulty := state.NextDifficulty()
+		b.Header.Difficulty = &difficulty
+	}
+
+	return b
+}
+
+// powTestBlock searches the block nonce satisfying its header target or difficulty, the test difficulty without
+func powTestBlock(t *testing.T, b Block) Block {
+	isHashValid := func(hash Hash) bool {
+		return IsBlockHashValid(hash, defaultTestMiningDifficulty)
+	}
+
+	if b.Header.Difficulty != nil {
+		isHashValid = func(hash Hash) bool {
+			return IsBlockHashValid(hash, *b.Header.Difficulty)
+		}
+	}
+
+	if b.Header.Bits != nil {
+		target := BitsToTarget(*b.Header.Bits)
+		isHashValid = func(hash Hash) bool {
+			return IsBlockHashBelowTarget(hash, target)
+		}
+	}
+
+	for nonce := rand.Uint32(); ; nonce++ {
+		b.Header.Nonce = nonce
+
+		hash, err := b.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if isHashValid(hash) {
+			return b
+		}
+	}
+}
+
+const testChainID = "tbb-test"
+const testBabaYagaAccount = "0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8"
+const defaultTestMiningDifficulty = 2
+
+// setupTestGenesisDir creates a data directory with all forks active from the start
+//
+// Remember to remove the dir once test finishes: defer fs.RemoveDir(dataDir)
+func setupTestGenesisDir(balances map[common.Address]uint) (string, error) {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		return "", err
+	}
+
+	forks := make(map[Fork]uint64)
+	for _, fork := range KnownForks {
+		forks[fork] = 0
+	}
+
+	genesisJson, err := json.Marshal(Genesis{
+		ChainID:          testChainID,
+		Balances:         balances,
+		MiningDifficulty: GenesisParam(defaultTestMiningDifficulty),
+		Forks:            forks,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = InitDataDirIfNotExists(dataDir, genesisJson)
+	if err != nil {
+		return "", err
+	}
+
+	return dataDir, nil
+}
+
+// Creates dir like: "/tmp/tbb_test945924586"
+func getTestDataDirPath() (string, error) {
+	return ioutil.TempDir(os.TempDir(), "tbb_test")
+}
+
+func generateKey() (*ecdsa.PrivateKey, ecdsa.PublicKey, common.Address, error) {
+	privKey, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, ecdsa.PublicKey{}, common.Address{}, err
+	}
+
+	return privKey, privKey.PublicKey, crypto.PubkeyToAddress(privKey.PublicKey), nil
+}
@@ -16,6 +16,7 @@
 package database
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -53,6 +54,31 @@ func getBlocksDbFilePath(dataDir string) string {
 	return filepath.Join(getDatabaseDirPath(dataDir), "block.db")
 }
 
+func getBlockStoreEngineFilePath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "block_store")
+}
+
+func getLevelDBBlockStoreDirPath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "blocks")
+}
+
+func getChainIndexDirPath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "index")
+}
+
+func getSnapshotsDirPath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "snapshots")
+}
+
+func getSnapshotFilePath(dataDir string, height uint64) string {
+	return filepath.Join(getSnapshotsDirPath(dataDir), fmt.Sprintf("%d.json", height))
+}
+
+// GetMempoolJournalFilePath is the node pending TXs journal, next to the database dir as the node owns it.
+func GetMempoolJournalFilePath(dataDir string) string {
+	return filepath.Join(dataDir, "mempool.journal")
+}
+
 func fileExist(filePath string) bool {
 	_, err := os.Stat(filePath)
 	if err != nil && os.IsNotExist(err) {
@@ -77,3 +103,25 @@ func dirExists(path string) (bool, error) {
 func writeEmptyBlocksDbToDisk(path string) error {
 	return ioutil.WriteFile(path, []byte(""), os.ModePerm)
 }
+
+// writeFileSynced writes the file and flushes it to disk before returning.
+func writeFileSynced(path string, content []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(content)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -17,6 +17,7 @@ package database
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -29,14 +30,184 @@ var genesisJson = `{
   "balances": {
     "0x09eE50f2F37FcBA1845dE6FE5C762E83E65E755c": 1000000
   },
-  "fork_tip_1": 35
+  "mining_difficulty": 3,
+  "block_reward": 100,
+  "tx_fee": 50,
+  "forks": {
+    "tip_1": 35
+  }
 }`
 
+// Chain params of genesis files not configuring them
+const DefaultMiningDifficulty = 3
+const DefaultBlockReward = BlockReward
+const DefaultTxFee = TxFee
+const DefaultTargetBlockTime = 60
+const DefaultRetargetInterval = 100
+const DefaultBlockGasLimit = 1000 * TxGas
+const DefaultBlockMaxBytes = 512 * 1024
+
+// Genesis configures the chain: initial balances and the consensus params every node must agree on.
 type Genesis struct {
-	Balances map[common.Address]uint `json:"balances"`
+	Time     string                  `json:"genesis_time"`
+	ChainID  string                  `json:"chain_id"`
 	Symbol   string                  `json:"symbol"`
+	Balances map[common.Address]uint `json:"balances"`
+	// Vesting allocates locked tranches of whole TBB on top of the balances, each spendable once it vests
+	Vesting map[common.Address][]GenesisVesting `json:"vesting,omitempty"`
+
+	// Number of zeroes a block hash must start with. The chain params are pointers to tell a 0 from a missing param.
+	MiningDifficulty *uint `json:"mining_difficulty,omitempty"`
+	BlockReward      *uint `json:"block_reward,omitempty"`
+	// TxFee is the flat fee per TX paid to the miner before the TIP1 fork introduced gas
+	TxFee *uint `json:"tx_fee,omitempty"`
+	// Seconds between blocks and number of blocks between difficulty retargets since the TIP5 fork
+	TargetBlockTime  uint64 `json:"target_block_time,omitempty"`
+	RetargetInterval uint64 `json:"retarget_interval,omitempty"`
+	// Gas and encoded size of the block TXs since the TIP8 fork
+	BlockGasLimit uint   `json:"block_gas_limit,omitempty"`
+	BlockMaxBytes uint64 `json:"block_max_bytes,omitempty"`
+
+	// Forks maps the fork names to the block heights they activate at
+	Forks map[Fork]uint64 `json:"forks,omitempty"`
+	// ForkTIP1 is the TIP1 height of genesis files predating the fork table.
+	// TIP1 is active from the start when neither configures it.
+	ForkTIP1 uint64 `json:"fork_tip_1,omitempty"`
+}
+
+// GenesisParam returns the chain param value to set in the genesis, 0 included.
+func GenesisParam(value uint) *uint {
+	return &value
+}
+
+// DefaultGenesis returns the genesis of the public TBB network.
+func DefaultGenesis() Genesis {
+	var gen Genesis
+
+	// The embedded genesis is always valid
+	_ = json.Unmarshal([]byte(genesisJson), &gen)
+
+	return gen.withDefaults()
+}
+
+// InitGenesis writes the genesis into a new data dir. An already initialized data dir is left untouched.
+func InitGenesis(dataDir string, genesis Genesis) error {
+	if fileExist(getGenesisJsonFilePath(dataDir)) {
+		return fmt.Errorf("data dir %s is already initialized with a genesis", dataDir)
+	}
+
+	if genesis.ChainID == "" {
+		return fmt.Errorf("genesis chain_id is required")
+	}
 
-	ForkTIP1 uint64 `json:"fork_tip_1"`
+	err := genesis.validate()
+	if err != nil {
+		return err
+	}
+
+	genesisJson, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return InitDataDirIfNotExists(dataDir, genesisJson)
+}
+
+// LoadGenesis reads a genesis file, chain params missing in the file get their default values.
+func LoadGenesis(path string) (Genesis, error) {
+	return loadGenesis(path)
+}
+
+// ChainConfig returns the consensus params and fork schedule of the chain.
+func (g Genesis) ChainConfig() ChainConfig {
+	g = g.withDefaults()
+
+	forks := make(map[Fork]uint64)
+	forks[ForkTIP1] = g.ForkTIP1
+
+	for fork, height := range g.Forks {
+		forks[fork] = height
+	}
+
+	return ChainConfig{
+		ChainID:          g.ChainID,
+		BlockReward:      *g.BlockReward,
+		TxFee:            *g.TxFee,
+		MiningDifficulty: *g.MiningDifficulty,
+		TargetBlockTime:  g.TargetBlockTime,
+		RetargetInterval: g.RetargetInterval,
+		BlockGasLimit:    g.BlockGasLimit,
+		BlockMaxBytes:    g.BlockMaxBytes,
+		forks:            forks,
+	}
+}
+
+func (g Genesis) validate() error {
+	for fork := range g.Forks {
+		if !isKnownFork(fork) {
+			return fmt.Errorf("unknown genesis fork '%s'. Known forks: %v", fork, KnownForks)
+		}
+	}
+
+	if _, ok := g.Forks[ForkTIP4]; ok && g.ChainID == "" {
+		return fmt.Errorf("genesis chain_id is required by the %s fork", ForkTIP4)
+	}
+
+	if g.MiningDifficulty != nil && (*g.MiningDifficulty == 0 || *g.MiningDifficulty > MaxMiningDifficulty) {
+		return fmt.Errorf("invalid genesis mining_difficulty %d. must be between 1 and %d", *g.MiningDifficulty, MaxMiningDifficulty)
+	}
+
+	for account, vestings := range g.Vesting {
+		if len(vestings) > MaxLocksPerAccount {
+			return fmt.Errorf("invalid genesis vesting of account '%s'. %d tranches exceed the max %d", account.String(), len(vestings), MaxLocksPerAccount)
+		}
+
+		for _, vesting := range vestings {
+			if vesting.Amount == 0 {
+				return fmt.Errorf("invalid genesis vesting of account '%s'. `amount` is required", account.String())
+			}
+
+			err := vesting.TimeLock.validate()
+			if err != nil {
+				return fmt.Errorf("invalid genesis vesting of account '%s'. %s", account.String(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// withDefaults fills in the chain params the genesis doesn't configure.
+func (g Genesis) withDefaults() Genesis {
+	if g.MiningDifficulty == nil {
+		g.MiningDifficulty = GenesisParam(DefaultMiningDifficulty)
+	}
+
+	if g.BlockReward == nil {
+		g.BlockReward = GenesisParam(DefaultBlockReward)
+	}
+
+	if g.TxFee == nil {
+		g.TxFee = GenesisParam(DefaultTxFee)
+	}
+
+	if g.TargetBlockTime == 0 {
+		g.TargetBlockTime = DefaultTargetBlockTime
+	}
+
+	if g.RetargetInterval == 0 {
+		g.RetargetInterval = DefaultRetargetInterval
+	}
+
+	if g.BlockGasLimit == 0 {
+		g.BlockGasLimit = DefaultBlockGasLimit
+	}
+
+	if g.BlockMaxBytes == 0 {
+		g.BlockMaxBytes = DefaultBlockMaxBytes
+	}
+
+	return g
 }
 
 func loadGenesis(path string) (Genesis, error) {
@@ -51,7 +222,12 @@ func loadGenesis(path string) (Genesis, error) {
 		return Genesis{}, err
 	}
 
-	return loadedGenesis, nil
+	err = loadedGenesis.validate()
+	if err != nil {
+		return Genesis{}, err
+	}
+
+	return loadedGenesis.withDefaults(), nil
 }
 
 func writeGenesisToDisk(path string, genesis []byte) error {
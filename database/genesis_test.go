@@ -0,0 +1,127 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - A new chain is initialized with its own difficulty, block reward and TX fee
+//   - The state takes the difficulty and the fork schedule from the genesis
+//   - BabaYaga mines Andrej's TX before the TIP1 fork and is rewarded with the genesis reward and fee
+//   - Initializing the data dir again fails
+//   - A chain configured without block reward nor TX fee keeps them at 0, a 0 mining difficulty is rejected
+func TestState_GenesisChainParams(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	genesis := Genesis{
+		ChainID:          "tbb-test-chain",
+		Symbol:           "TST",
+		Balances:         map[common.Address]uint{andrej: 1000},
+		MiningDifficulty: GenesisParam(defaultTestMiningDifficulty),
+		BlockReward:      GenesisParam(7),
+		TxFee:            GenesisParam(3),
+		Forks:            map[Fork]uint64{ForkTIP1: 2, ForkTIP2: 0, ForkTIP3: 0},
+	}
+
+	err = InitGenesis(dataDir, genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if state.MiningDifficulty() != defaultTestMiningDifficulty {
+		t.Fatalf("mining difficulty should be %d from the genesis not %d", defaultTestMiningDifficulty, state.MiningDifficulty())
+	}
+
+	config := state.ChainConfig()
+	if config.IsActive(ForkTIP1, 1) || !config.IsActive(ForkTIP1, 2) {
+		t.Fatal("TIP1 fork should activate at block 2")
+	}
+
+	if config.IsActive(ForkTIP4, 1000) {
+		t.Fatal("TIP4 fork missing in the genesis should never activate")
+	}
+
+	tx, err := signTx(NewTx(andrej, babaYaga, 0, 0, 1, 1, ""), "", andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, babaYaga, tx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Balances[andrej].Cmp(NewAmount(1000-1-3)) != 0 {
+		t.Errorf("Andrej balance should be %d not %s", 1000-1-3, state.Balances[andrej])
+	}
+
+	if state.Balances[babaYaga].Cmp(NewAmount(1+7+3)) != 0 {
+		t.Errorf("BabaYaga balance should be %d not %s", 1+7+3, state.Balances[babaYaga])
+	}
+
+	err = InitGenesis(dataDir, genesis)
+	if err == nil {
+		t.Fatal("an initialized data dir must not be initialized again")
+	}
+
+	zeroDataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(zeroDataDir)
+
+	genesis.BlockReward = GenesisParam(0)
+	genesis.TxFee = GenesisParam(0)
+	err = InitGenesis(zeroDataDir, genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zeroGenesis, err := LoadGenesis(getGenesisJsonFilePath(zeroDataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if zeroGenesis.ChainConfig().BlockReward != 0 || zeroGenesis.ChainConfig().TxFee != 0 {
+		t.Errorf("block reward and TX fee configured as 0 should stay 0, got %d and %d", zeroGenesis.ChainConfig().BlockReward, zeroGenesis.ChainConfig().TxFee)
+	}
+
+	genesis.MiningDifficulty = GenesisParam(0)
+	if err := genesis.validate(); err == nil {
+		t.Error("genesis with a 0 mining difficulty should be rejected")
+	}
+}
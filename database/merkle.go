@@ -0,0 +1,147 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// Prefixes separating leaves from inner nodes so an inner node can never be passed off as a TX.
+const merkleLeafPrefix = 0x00
+const merkleNodePrefix = 0x01
+
+// MerkleProofStep is a sibling hash on the path from a TX to the TX root.
+type MerkleProofStep struct {
+	Hash Hash `json:"hash"`
+	// IsLeft is true if the sibling is hashed on the left side of the current node
+	IsLeft bool `json:"is_left"`
+}
+
+// TxProof proves a TX was included in a block without shipping the whole block.
+type TxProof struct {
+	TxHash      Hash              `json:"tx_hash"`
+	BlockHash   Hash              `json:"block_hash"`
+	BlockNumber uint64            `json:"block_number"`
+	TxRoot      Hash              `json:"tx_root"`
+	Branch      []MerkleProofStep `json:"branch"`
+}
+
+// TxRoot returns the Merkle root of the block TXs hashes, in the block order.
+//
+// An odd node at the end of a level is promoted to the next level as is.
+func TxRoot(txs []SignedTx) (Hash, error) {
+	level, err := merkleLeaves(txs)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	if len(level) == 0 {
+		return Hash{}, nil
+	}
+
+	for len(level) > 1 {
+		level = merkleNextLevel(level)
+	}
+
+	return level[0], nil
+}
+
+// TxMerkleBranch returns the sibling hashes needed to recompute the TX root from the TX at the given index.
+func TxMerkleBranch(txs []SignedTx, index int) ([]MerkleProofStep, error) {
+	if index < 0 || index >= len(txs) {
+		return nil, fmt.Errorf("TX index %d out of range, the block has %d TXs", index, len(txs))
+	}
+
+	level, err := merkleLeaves(txs)
+	if err != nil {
+		return nil, err
+	}
+
+	branch := make([]MerkleProofStep, 0)
+	for len(level) > 1 {
+		if index%2 == 1 {
+			branch = append(branch, MerkleProofStep{level[index-1], true})
+		} else if index+1 < len(level) {
+			branch = append(branch, MerkleProofStep{level[index+1], false})
+		}
+
+		level = merkleNextLevel(level)
+		index /= 2
+	}
+
+	return branch, nil
+}
+
+// VerifyTxProof checks the proof branch leads from the TX hash to the TX root.
+//
+// Light clients must also check the root belongs to a block header they trust.
+func VerifyTxProof(proof TxProof) bool {
+	node := merkleLeaf(proof.TxHash)
+
+	for _, step := range proof.Branch {
+		if step.IsLeft {
+			node = merkleNode(step.Hash, node)
+		} else {
+			node = merkleNode(node, step.Hash)
+		}
+	}
+
+	return node == proof.TxRoot
+}
+
+func merkleLeaves(txs []SignedTx) ([]Hash, error) {
+	leaves := make([]Hash, len(txs))
+
+	for i, tx := range txs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			return nil, err
+		}
+
+		leaves[i] = merkleLeaf(txHash)
+	}
+
+	return leaves, nil
+}
+
+func merkleNextLevel(level []Hash) []Hash {
+	next := make([]Hash, 0, (len(level)+1)/2)
+
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+			continue
+		}
+
+		next = append(next, merkleNode(level[i], level[i+1]))
+	}
+
+	return next
+}
+
+func merkleLeaf(txHash Hash) Hash {
+	return sha256.Sum256(append([]byte{merkleLeafPrefix}, txHash[:]...))
+}
+
+func merkleNode(left, right Hash) Hash {
+	data := make([]byte, 0, 1+2*len(left))
+	data = append(data, merkleNodePrefix)
+	data = append(data, left[:]...)
+	data = append(data, right[:]...)
+
+	return sha256.Sum256(data)
+}
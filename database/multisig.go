@@ -0,0 +1,179 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// MaxMultisigSigners caps the signer set of a multisig account, every signature costs a public key recovery.
+const MaxMultisigSigners = 16
+
+// Multisig is the M-of-N config of a multisig account: spending requires Threshold signatures of distinct Signers.
+type Multisig struct {
+	Threshold uint `json:"threshold"`
+	// Signers are sorted by address to derive the same multisig address from the same signer set
+	Signers []common.Address `json:"signers"`
+}
+
+// NewMultisig creates the config of a threshold-of-signers account.
+func NewMultisig(threshold uint, signers []common.Address) Multisig {
+	sorted := make([]common.Address, len(signers))
+	copy(sorted, signers)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i][:], sorted[j][:]) < 0
+	})
+
+	return Multisig{threshold, sorted}
+}
+
+// Address derives the multisig account address from its config. Nobody holds a key of the address.
+func (m Multisig) Address() common.Address {
+	data := []byte("tbb-multisig")
+
+	var threshold [8]byte
+	binary.BigEndian.PutUint64(threshold[:], uint64(m.Threshold))
+	data = append(data, threshold[:]...)
+
+	for _, signer := range m.Signers {
+		data = append(data, signer[:]...)
+	}
+
+	return common.BytesToAddress(crypto.Keccak256(data)[12:])
+}
+
+func (m Multisig) hasSigner(account common.Address) bool {
+	i := sort.Search(len(m.Signers), func(i int) bool { return bytes.Compare(m.Signers[i][:], account[:]) >= 0 })
+
+	return i < len(m.Signers) && m.Signers[i] == account
+}
+
+func (m Multisig) validate() error {
+	if len(m.Signers) == 0 || len(m.Signers) > MaxMultisigSigners {
+		return fmt.Errorf("invalid multisig. It requires between 1 and %d signers, not %d", MaxMultisigSigners, len(m.Signers))
+	}
+
+	if m.Threshold == 0 || m.Threshold > uint(len(m.Signers)) {
+		return fmt.Errorf("invalid multisig. The threshold must be between 1 and %d signers, not %d", len(m.Signers), m.Threshold)
+	}
+
+	for i := 1; i < len(m.Signers); i++ {
+		if bytes.Compare(m.Signers[i-1][:], m.Signers[i][:]) >= 0 {
+			return fmt.Errorf("invalid multisig. Signers must be unique and sorted by address")
+		}
+	}
+
+	return nil
+}
+
+// NewMultisigRegisterTx creates a TX registering the multisig account and funding it with the amount.
+func NewMultisigRegisterTx(from common.Address, multisig Multisig, gas uint, gasPrice uint, amount Amount, nonce uint, data string) Tx {
+	tx := NewTransferTx(from, multisig.Address(), gas, gasPrice, amount, nonce, data)
+	tx.Type = TxTypeMultisigRegister
+	tx.Multisig = &multisig
+
+	return tx
+}
+
+// NewMultisigSpendTx creates a TX spending from the multisig account, to be co-signed by its signers.
+func NewMultisigSpendTx(multisig, to common.Address, gas uint, gasPrice uint, amount Amount, nonce uint, data string) Tx {
+	tx := NewTransferTx(multisig, to, gas, gasPrice, amount, nonce, data)
+	tx.Type = TxTypeMultisigSpend
+
+	return tx
+}
+
+// Multisig returns the config of a registered multisig account.
+func (s *State) Multisig(account common.Address) (Multisig, bool) {
+	multisig, ok := s.multisigs[account]
+
+	return multisig, ok
+}
+
+// verifyMultisigSignatures checks the spend TX carries the signatures of enough distinct signers of the sending multisig.
+func (s *State) verifyMultisigSignatures(tx SignedTx) error {
+	multisig, ok := s.multisigs[tx.From]
+	if !ok {
+		return fmt.Errorf("wrong TX. Sender '%s' isn't a registered multisig account", tx.From.String())
+	}
+
+	if len(tx.Sig) != 0 {
+		return fmt.Errorf("invalid TX. Multisig spend TXs carry the signers `signatures` only")
+	}
+
+	cosigners, err := tx.Cosigners()
+	if err != nil {
+		return err
+	}
+
+	signed := make(map[common.Address]bool)
+	for _, cosigner := range cosigners {
+		if !multisig.hasSigner(cosigner) {
+			return fmt.Errorf("wrong TX. '%s' isn't a signer of the multisig account '%s'", cosigner.String(), tx.From.String())
+		}
+
+		if signed[cosigner] {
+			return fmt.Errorf("wrong TX. '%s' signed the multisig TX more than once", cosigner.String())
+		}
+		signed[cosigner] = true
+	}
+
+	if uint(len(signed)) < multisig.Threshold {
+		return fmt.Errorf("wrong TX. Multisig account '%s' requires %d signatures, got %d", tx.From.String(), multisig.Threshold, len(signed))
+	}
+
+	return nil
+}
+
+// validateMultisigRegisterTx checks the multisig config and its address, then the funding transfer.
+func validateMultisigRegisterTx(tx SignedTx, s *State) error {
+	if tx.Multisig == nil {
+		return fmt.Errorf("invalid TX. `Multisig` is required to register a multisig account")
+	}
+
+	err := tx.Multisig.validate()
+	if err != nil {
+		return err
+	}
+
+	if tx.To != tx.Multisig.Address() {
+		return fmt.Errorf("invalid TX. The multisig account address is '%s' not '%s'", tx.Multisig.Address().String(), tx.To.String())
+	}
+
+	if _, ok := s.multisigs[tx.To]; ok {
+		return fmt.Errorf("wrong TX. Multisig account '%s' is already registered", tx.To.String())
+	}
+
+	return validateTransferTx(tx, s)
+}
+
+func applyMultisigRegisterTx(tx SignedTx, s *State) error {
+	err := applyTransferTx(tx, s)
+	if err != nil {
+		return err
+	}
+
+	s.multisigs[tx.To] = *tx.Multisig
+
+	return nil
+}
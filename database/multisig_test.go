@@ -0,0 +1,149 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Andrej registers a 2-of-3 multisig account funded with 100 TBB, committed in the state root
+//   - A spend TX co-signed by one signer, or by a non-signer, is rejected
+//   - The spend TX co-signed by 2 signers transfers 10 TBB to BabaYaga
+//   - The multisig account is known again after reloading the state from disk
+func TestState_MultisigAccount(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	signerKey1, _, signer1, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signerKey2, _, signer2, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, signer3, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	multisig := NewMultisig(2, []common.Address{signer1, signer2, signer3})
+	registerTx, err := signTx(NewMultisigRegisterTx(andrej, multisig, TxGas, TxGasPriceDefault, AmountFromTBB(100), 1, ""), testChainID, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, andrej, registerTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := state.Multisig(multisig.Address()); !ok {
+		t.Fatalf("multisig account %s should be registered", multisig.Address().Hex())
+	}
+
+	// The block state root commits the multisig config, a node with another signer set disagrees on it
+	tamperedState := state.Copy()
+	tamperedState.multisigs[multisig.Address()] = NewMultisig(1, []common.Address{signer1, signer2, signer3})
+	if tamperedState.StateRoot() == *state.LatestBlock().Header.StateRoot {
+		t.Error("state root should commit the multisig account threshold")
+	}
+
+	if state.Balances[multisig.Address()].Cmp(AmountFromTBB(100)) != 0 {
+		t.Fatalf("multisig account should be funded with 100 TBB not %s", state.FormatAmount(state.Balances[multisig.Address()]))
+	}
+
+	reregisterTx, err := signTx(NewMultisigRegisterTx(andrej, multisig, TxGas, TxGasPriceDefault, AmountFromTBB(1), 2, ""), testChainID, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateTx(reregisterTx, state); err == nil {
+		t.Error("registering the same multisig account twice should be rejected")
+	}
+
+	spendTx := SignedTx{Tx: NewMultisigSpendTx(multisig.Address(), babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(10), 1, "")}
+	spendTx.ChainID = testChainID
+
+	partiallySignedTx, err := cosignTx(spendTx, signerKey1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateTx(partiallySignedTx, state); err == nil {
+		t.Error("multisig TX signed by 1 of the 2 required signers should be rejected")
+	}
+
+	outsiderSignedTx, err := cosignTx(partiallySignedTx, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateTx(outsiderSignedTx, state); err == nil {
+		t.Error("multisig TX signed by a non-signer should be rejected")
+	}
+
+	signedTx, err := cosignTx(partiallySignedTx, signerKey2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, andrej, signedTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Balances[babaYaga].Cmp(AmountFromTBB(10)) != 0 {
+		t.Errorf("BabaYaga should receive 10 TBB from the multisig account not %s", state.FormatAmount(state.Balances[babaYaga]))
+	}
+
+	if state.GetNextAccountNonce(multisig.Address()) != 2 {
+		t.Errorf("multisig account next nonce should be 2 not %d", state.GetNextAccountNonce(multisig.Address()))
+	}
+
+	_ = state.Close()
+
+	reloadedState, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloadedState.Close()
+
+	if _, ok := reloadedState.Multisig(multisig.Address()); !ok {
+		t.Error("multisig account should be registered after reloading the state")
+	}
+}
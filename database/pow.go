@@ -0,0 +1,87 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Since the TIP6 fork a block hash, read as a 256-bit big-endian number, must not exceed the block target.
+//
+// The target is committed in the block header as Bits, the compact encoding used by Bitcoin:
+// the highest byte is the target length in bytes, the lower 3 bytes are its most significant bytes.
+
+// MaxMiningDifficulty is the hardest mining difficulty, a hash can't start with more zero bytes than its 32 bytes.
+const MaxMiningDifficulty = 32
+
+// maxTarget is the easiest allowed target, equivalent to the mining difficulty 1.
+var maxTarget, _ = DifficultyToTarget(1)
+
+// DifficultyToTarget returns the target of hashes starting with the given number of zero bytes.
+func DifficultyToTarget(miningDifficulty uint) (*big.Int, error) {
+	if miningDifficulty > MaxMiningDifficulty {
+		return nil, fmt.Errorf("mining difficulty %d exceeds the max %d", miningDifficulty, MaxMiningDifficulty)
+	}
+
+	target := new(big.Int).Lsh(big.NewInt(1), 256-8*miningDifficulty)
+
+	return target.Sub(target, big.NewInt(1)), nil
+}
+
+// BitsToTarget decodes the compact target representation.
+func BitsToTarget(bits uint32) *big.Int {
+	size := uint(bits >> 24)
+	target := big.NewInt(int64(bits & 0x007fffff))
+
+	if size <= 3 {
+		return target.Rsh(target, 8*(3-size))
+	}
+
+	return target.Lsh(target, 8*(size-3))
+}
+
+// TargetToBits encodes the target in its compact representation, only its 3 most significant bytes are kept.
+func TargetToBits(target *big.Int) uint32 {
+	size := uint((target.BitLen() + 7) / 8)
+
+	var mantissa uint64
+	if size <= 3 {
+		mantissa = target.Uint64() << (8 * (3 - size))
+	} else {
+		mantissa = new(big.Int).Rsh(target, 8*(size-3)).Uint64()
+	}
+
+	// The 0x00800000 bit is the sign of the mantissa, targets are positive
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+
+	return uint32(size<<24) | uint32(mantissa)
+}
+
+// IsBlockHashBelowTarget returns true if the hash doesn't exceed the target.
+func IsBlockHashBelowTarget(hash Hash, target *big.Int) bool {
+	return new(big.Int).SetBytes(hash[:]).Cmp(target) <= 0
+}
+
+// TargetWork returns the expected number of hash attempts needed to mine a block with the given target.
+func TargetWork(target *big.Int) *big.Int {
+	space := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	return space.Div(space, new(big.Int).Add(target, big.NewInt(1)))
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// CorruptedRecord describes a stored block failing verification.
+type CorruptedRecord struct {
+	Location string `json:"location"`
+	Reason   string `json:"reason"`
+}
+
+// RepairReport summarizes what RepairBlockStore found and removed.
+type RepairReport struct {
+	BlockStore  string            `json:"block_store"`
+	ValidBlocks uint64            `json:"valid_blocks"`
+	Corrupted   []CorruptedRecord `json:"corrupted"`
+	// Blocks stored after the first corrupted record are removed as well, the node syncs them again from its peers
+	RemovedBlocks uint64 `json:"removed_blocks"`
+}
+
+// RepairBlockStore verifies every stored block and truncates the chain right before the first corrupted one.
+func RepairBlockStore(dataDir string) (RepairReport, error) {
+	engine, err := readBlockStoreEngine(dataDir)
+	if err != nil {
+		return RepairReport{}, err
+	}
+
+	switch engine {
+	case BlockStoreFile:
+		return repairFileBlockStore(getBlocksDbFilePath(dataDir))
+	case BlockStoreLevelDB:
+		return repairLevelDBBlockStore(getLevelDBBlockStoreDirPath(dataDir))
+	default:
+		return RepairReport{}, fmt.Errorf("unknown block store '%s'. Supported: %s, %s", engine, BlockStoreFile, BlockStoreLevelDB)
+	}
+}
+
+// verifyBlockRecord checks the stored block content still hashes to its stored hash.
+func verifyBlockRecord(blockFs BlockFS) error {
+	hash, err := blockFs.Value.Hash()
+	if err != nil {
+		return err
+	}
+
+	if hash != blockFs.Key {
+		return fmt.Errorf("block content hashes to '%x' instead of '%x'", hash, blockFs.Key)
+	}
+
+	return nil
+}
+
+func repairFileBlockStore(path string) (RepairReport, error) {
+	report := RepairReport{BlockStore: BlockStoreFile, Corrupted: make([]CorruptedRecord, 0)}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return report, err
+	}
+	defer f.Close()
+
+	truncatePos := int64(-1)
+	err = scanFileBlockRecords(f, func(record fileBlockRecord) (bool, error) {
+		location := fmt.Sprintf("byte offset %d", record.offset)
+
+		var reason string
+		switch {
+		case record.isTorn:
+			reason = "incomplete record"
+		case record.err != nil:
+			reason = record.err.Error()
+		case truncatePos < 0 && record.blockFs.Value.Header.Number != report.ValidBlocks:
+			reason = fmt.Sprintf("expected block height %d not %d", report.ValidBlocks, record.blockFs.Value.Header.Number)
+		}
+
+		if reason != "" {
+			report.Corrupted = append(report.Corrupted, CorruptedRecord{location, reason})
+			if truncatePos < 0 {
+				truncatePos = record.offset
+			}
+			return true, nil
+		}
+
+		if truncatePos >= 0 {
+			report.RemovedBlocks++
+		} else {
+			report.ValidBlocks++
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if truncatePos >= 0 {
+		err = truncateFileBlockRecords(f, truncatePos)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+func repairLevelDBBlockStore(path string) (RepairReport, error) {
+	report := RepairReport{BlockStore: BlockStoreLevelDB, Corrupted: make([]CorruptedRecord, 0)}
+
+	// Rebuilds the LevelDB manifest from its journal and tables in case the DB itself can't be opened
+	db, err := leveldb.RecoverFile(path, nil)
+	if err != nil {
+		return report, err
+	}
+	defer db.Close()
+
+	batch := new(leveldb.Batch)
+	var latest Hash
+	isCorrupted := false
+
+	iter := db.NewIterator(util.BytesPrefix(levelDBHeightPrefix), nil)
+	for iter.Next() {
+		height := binary.BigEndian.Uint64(iter.Key()[len(levelDBHeightPrefix):])
+		var hash Hash
+		copy(hash[:], iter.Value())
+
+		if isCorrupted {
+			batch.Delete(levelDBHeightKey(height))
+			batch.Delete(levelDBBlockKey(hash))
+			report.RemovedBlocks++
+			continue
+		}
+
+		reason := ""
+		if height != report.ValidBlocks {
+			reason = fmt.Sprintf("missing block at height %d", report.ValidBlocks)
+		} else {
+			reason = verifyLevelDBBlock(db, hash, height)
+		}
+
+		if reason != "" {
+			report.Corrupted = append(report.Corrupted, CorruptedRecord{fmt.Sprintf("height %d", height), reason})
+			batch.Delete(levelDBHeightKey(height))
+			batch.Delete(levelDBBlockKey(hash))
+			isCorrupted = true
+			continue
+		}
+
+		latest = hash
+		report.ValidBlocks++
+	}
+	iter.Release()
+
+	err = iter.Error()
+	if err != nil {
+		return report, err
+	}
+
+	if report.ValidBlocks > 0 {
+		batch.Put(levelDBLatestKey, latest[:])
+	} else {
+		batch.Delete(levelDBLatestKey)
+	}
+
+	return report, db.Write(batch, levelDBSyncWrite)
+}
+
+func verifyLevelDBBlock(db *leveldb.DB, hash Hash, height uint64) string {
+	blockFsJson, err := db.Get(levelDBBlockKey(hash), nil)
+	if err != nil {
+		return err.Error()
+	}
+
+	var blockFs BlockFS
+	err = json.Unmarshal(blockFsJson, &blockFs)
+	if err != nil {
+		return err.Error()
+	}
+
+	if blockFs.Key != hash || blockFs.Value.Header.Number != height {
+		return fmt.Sprintf("indexed block '%x' at height %d doesn't match stored block '%x' at height %d", hash, height, blockFs.Key, blockFs.Value.Header.Number)
+	}
+
+	err = verifyBlockRecord(blockFs)
+	if err != nil {
+		return err.Error()
+	}
+
+	return ""
+}
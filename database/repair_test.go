@@ -0,0 +1,121 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Andrej mines 3 blocks
+//   - A crash while appending a 4th block leaves a torn last line, the state loads without it
+//   - A corrupted 2nd block makes loading fail until the block store is repaired down to the 1st block
+func TestState_RepairBlockStore(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := make([]Hash, 3)
+	for i := range hashes {
+		hashes[i], err = state.AddBlock(mineTestBlock(t, state, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, uint(i+1))))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = state.Close()
+
+	blockDbPath := filepath.Join(dataDir, "database", "block.db")
+	blockDb, err := ioutil.ReadFile(blockDbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(blockDbPath, append(blockDb, []byte(`{"hash":"0000a1b2","block":{"hea`)...), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatalf("torn last block record should be truncated automatically. %s", err)
+	}
+	_ = state.Close()
+
+	if state.LatestBlockHash() != hashes[2] {
+		t.Errorf("latest block should be %x not %x", hashes[2], state.LatestBlockHash())
+	}
+
+	truncatedBlockDb, err := ioutil.ReadFile(blockDbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(truncatedBlockDb, blockDb) {
+		t.Fatalf("torn last block record should be removed from block.db")
+	}
+
+	// Alter the 2nd block TX amount without updating its hash
+	lines := bytes.SplitAfter(blockDb, []byte("\n"))
+	lines[1] = bytes.Replace(lines[1], []byte(`"amount":"1`), []byte(`"amount":"9`), 1)
+	err = ioutil.WriteFile(blockDbPath, bytes.Join(lines, nil), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err == nil {
+		t.Fatalf("loading a corrupted block should fail")
+	}
+
+	report, err := RepairBlockStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.ValidBlocks != 1 || len(report.Corrupted) != 1 || report.RemovedBlocks != 1 {
+		t.Errorf("repair should keep 1 valid block and remove 1 corrupted and 1 following block. Got: %+v", report)
+	}
+
+	state, err = NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if state.LatestBlockHash() != hashes[0] {
+		t.Errorf("latest block after repair should be %x not %x", hashes[0], state.LatestBlockHash())
+	}
+}
@@ -0,0 +1,349 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SnapshotInterval configures every how many blocks the state is snapshotted to disk.
+//
+// Loading the state replays only the blocks after the newest valid snapshot instead of the whole chain.
+var SnapshotInterval = uint64(500)
+
+// Only the newest snapshots are kept, older ones are deleted
+const snapshotsKept = 3
+
+type stateSnapshot struct {
+	Height        uint64                               `json:"height"`
+	BlockHash     Hash                                 `json:"block_hash"`
+	Balances      map[common.Address]Amount            `json:"balances"`
+	Account2Nonce map[common.Address]uint              `json:"account_2_nonce"`
+	Retarget      *retargetWindow                      `json:"retarget,omitempty"`
+	Multisigs     map[common.Address]Multisig          `json:"multisigs,omitempty"`
+	Locks         map[common.Address][]LockedAmount    `json:"locks,omitempty"`
+	Tokens        map[string]Token                     `json:"tokens,omitempty"`
+	TokenBalances map[string]map[common.Address]Amount `json:"token_balances,omitempty"`
+
+	// The main chain blocks recent enough to be forked from, see sideBlocksMaxDepth
+	RecentBlocks []snapshotBlock `json:"recent_blocks"`
+}
+
+type snapshotBlock struct {
+	Hash      Hash     `json:"hash"`
+	Number    uint64   `json:"number"`
+	TotalWork *big.Int `json:"total_work"`
+	Time      uint64   `json:"time,omitempty"`
+	// Retarget is missing in snapshots taken before the side branch blocks difficulty got verified
+	Retarget *retargetWindow `json:"retarget,omitempty"`
+}
+
+// snapshotFile wraps the snapshot with its checksum to detect partially written or corrupted files.
+type snapshotFile struct {
+	Checksum Hash            `json:"checksum"`
+	Snapshot json.RawMessage `json:"snapshot"`
+}
+
+// snapshotIfDue writes a snapshot of the state every SnapshotInterval blocks.
+func (s *State) snapshotIfDue() {
+	if SnapshotInterval == 0 || !s.hasGenesisBlock || s.latestBlock.Header.Number == 0 {
+		return
+	}
+
+	if s.latestBlock.Header.Number%SnapshotInterval != 0 {
+		return
+	}
+
+	err := s.writeSnapshot()
+	if err != nil {
+		fmt.Printf("WARNING: unable to snapshot the state at height %d. %s\n", s.latestBlock.Header.Number, err)
+	}
+}
+
+func (s *State) writeSnapshot() error {
+	snapshot := stateSnapshot{
+		Height:        s.latestBlock.Header.Number,
+		BlockHash:     s.latestBlockHash,
+		Balances:      s.Balances,
+		Account2Nonce: s.Account2Nonce,
+		Retarget:      &s.retarget,
+		Multisigs:     s.multisigs,
+		Locks:         s.locks,
+		Tokens:        s.tokens,
+		TokenBalances: s.tokenBalances,
+		RecentBlocks:  make([]snapshotBlock, 0),
+	}
+
+	for hash, meta := range s.knownBlocks {
+		if s.isMainChainBlock(hash) {
+			retarget := meta.retarget
+			snapshot.RecentBlocks = append(snapshot.RecentBlocks, snapshotBlock{hash, meta.number, meta.totalWork, meta.time, &retarget})
+		}
+	}
+
+	snapshotJson, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	fileJson, err := json.Marshal(snapshotFile{sha256.Sum256(snapshotJson), snapshotJson})
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(getSnapshotsDirPath(s.dataDir), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// Write into a temporary file first so a crash never leaves a half-written snapshot behind
+	path := getSnapshotFilePath(s.dataDir, snapshot.Height)
+	err = writeFileSynced(path+".tmp", fileJson)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nState snapshot written at height %d\n", snapshot.Height)
+
+	heights, err := s.snapshotHeights()
+	if err != nil {
+		return err
+	}
+
+	for i := snapshotsKept; i < len(heights); i++ {
+		err = os.Remove(getSnapshotFilePath(s.dataDir, heights[i]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadSnapshots returns the snapshots not higher than maxHeight which match the stored chain, newest first.
+func (s *State) loadSnapshots(maxHeight uint64) []stateSnapshot {
+	snapshots := make([]stateSnapshot, 0)
+
+	heights, err := s.snapshotHeights()
+	if err != nil {
+		return snapshots
+	}
+
+	for _, height := range heights {
+		if height > maxHeight {
+			continue
+		}
+
+		snapshot, err := s.readSnapshot(height)
+		if err != nil {
+			fmt.Printf("WARNING: ignoring state snapshot at height %d. %s\n", height, err)
+			continue
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots
+}
+
+func (s *State) readSnapshot(height uint64) (stateSnapshot, error) {
+	var snapshot stateSnapshot
+
+	fileJson, err := ioutil.ReadFile(getSnapshotFilePath(s.dataDir, height))
+	if err != nil {
+		return snapshot, err
+	}
+
+	var file snapshotFile
+	err = json.Unmarshal(fileJson, &file)
+	if err != nil {
+		return snapshot, err
+	}
+
+	if sha256.Sum256(file.Snapshot) != file.Checksum {
+		return snapshot, fmt.Errorf("checksum mismatch")
+	}
+
+	err = json.Unmarshal(file.Snapshot, &snapshot)
+	if err != nil {
+		return snapshot, err
+	}
+
+	if snapshot.Height != height {
+		return snapshot, fmt.Errorf("snapshot claims height %d", snapshot.Height)
+	}
+
+	if snapshot.Retarget == nil && s.config.IsActive(ForkTIP5, height) {
+		return snapshot, fmt.Errorf("snapshot predates the difficulty retargeting")
+	}
+
+	blockFs, err := s.store.GetByHeight(height)
+	if err != nil {
+		return snapshot, err
+	}
+
+	if blockFs.Key != snapshot.BlockHash {
+		return snapshot, fmt.Errorf("snapshot block '%x' doesn't match the chain block '%x'", snapshot.BlockHash, blockFs.Key)
+	}
+
+	return snapshot, nil
+}
+
+// restoreSnapshot replaces the genesis state with the snapshotted one.
+//
+// Since the TIP3 fork the restored state must match the state root of the snapshot block.
+func (s *State) restoreSnapshot(snapshot stateSnapshot) error {
+	blockFs, err := s.store.GetByHash(snapshot.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	s.Balances = snapshot.Balances
+	s.Account2Nonce = snapshot.Account2Nonce
+	if snapshot.Retarget != nil {
+		s.retarget = *snapshot.Retarget
+	}
+	if snapshot.Multisigs != nil {
+		s.multisigs = snapshot.Multisigs
+	}
+	// The genesis vestings may all be released by the snapshot height
+	s.locks = make(map[common.Address][]LockedAmount)
+	if snapshot.Locks != nil {
+		s.locks = snapshot.Locks
+	}
+	if snapshot.Tokens != nil {
+		s.tokens = snapshot.Tokens
+	}
+	if snapshot.TokenBalances != nil {
+		s.tokenBalances = snapshot.TokenBalances
+	}
+	s.latestBlock = blockFs.Value
+	s.latestBlockHash = blockFs.Key
+	s.hasGenesisBlock = true
+
+	for _, b := range snapshot.RecentBlocks {
+		meta := blockMeta{number: b.Number, totalWork: b.TotalWork, time: b.Time}
+		switch {
+		case b.Retarget != nil:
+			meta.retarget = *b.Retarget
+		case b.Hash == blockFs.Key:
+			meta.time = blockFs.Value.Header.Time
+			meta.retarget = s.retarget
+		default:
+			// Without its retarget window the difficulty of the blocks forking from it can't be verified
+			continue
+		}
+
+		s.knownBlocks[b.Hash] = meta
+	}
+
+	// The TIP9 balances migration runs after the state root check of the block before the fork,
+	// the root of its snapshot doesn't commit the migrated balances
+	tip9Height, ok := s.config.ForkHeight(ForkTIP9)
+	isMigrationBlock := ok && tip9Height == snapshot.Height+1
+
+	if blockFs.Value.Header.StateRoot != nil && !isMigrationBlock {
+		stateRoot := s.StateRoot()
+		if *blockFs.Value.Header.StateRoot != stateRoot {
+			return fmt.Errorf("snapshot state root %x doesn't match the block state root %x", stateRoot, *blockFs.Value.Header.StateRoot)
+		}
+	}
+
+	return s.loadRecentBlockTimes(snapshot.Height)
+}
+
+// snapshotStateAt restores the state of the snapshot at the given height, without replaying any blocks.
+func (s *State) snapshotStateAt(height uint64) (*State, error) {
+	snapshot, err := s.readSnapshot(height)
+	if err != nil {
+		return nil, err
+	}
+
+	state := s.genesisState()
+
+	err = state.restoreSnapshot(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// removeSnapshotsAfter deletes snapshots of main chain blocks abandoned by a reorganization.
+func (s *State) removeSnapshotsAfter(height int64) error {
+	heights, err := s.snapshotHeights()
+	if err != nil {
+		return err
+	}
+
+	for _, h := range heights {
+		if int64(h) > height {
+			err = os.Remove(getSnapshotFilePath(s.dataDir, h))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// snapshotHeights lists heights of the snapshots on disk, newest first.
+func (s *State) snapshotHeights() ([]uint64, error) {
+	files, err := ioutil.ReadDir(getSnapshotsDirPath(s.dataDir))
+	if os.IsNotExist(err) {
+		return []uint64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	heights := make([]uint64, 0)
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+
+		height, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		heights = append(heights, height)
+	}
+
+	sort.Slice(heights, func(i, j int) bool {
+		return heights[i] > heights[j]
+	})
+
+	return heights, nil
+}
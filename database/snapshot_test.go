@@ -0,0 +1,139 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Andrej mines 5 blocks with a snapshot taken every 2 blocks
+//   - The reloaded state must match the state built block by block
+//   - A corrupted newest snapshot is ignored and the state is rebuilt from the older one
+//   - A tampered older snapshot not matching its block state root is ignored and the state is rebuilt from genesis
+func TestState_LoadFromSnapshot(t *testing.T) {
+	defaultSnapshotInterval := SnapshotInterval
+	SnapshotInterval = 2
+	defer func() { SnapshotInterval = defaultSnapshotInterval }()
+
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := Hash{}
+	for i := uint64(0); i < 5; i++ {
+		block := mineTestBlock(t, state, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, uint(i+1)))
+		parent, err = state.AddBlock(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = state.Close()
+
+	for _, height := range []string{"2", "4"} {
+		if _, err := ioutil.ReadFile(filepath.Join(dataDir, "database", "snapshots", height+".json")); err != nil {
+			t.Fatalf("snapshot at height %s should exist: %s", height, err)
+		}
+	}
+
+	assertReloadedState := func() {
+		reloadedState, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reloadedState.Close()
+
+		if reloadedState.LatestBlockHash() != parent {
+			t.Errorf("reloaded latest block should be %x not %x", parent, reloadedState.LatestBlockHash())
+		}
+
+		if reloadedState.Balances[babaYaga].Cmp(state.Balances[babaYaga]) != 0 {
+			t.Errorf("reloaded BabaYaga balance should be %s not %s", state.Balances[babaYaga], reloadedState.Balances[babaYaga])
+		}
+
+		if reloadedState.Account2Nonce[andrej] != 5 {
+			t.Errorf("reloaded Andrej nonce should be 5 not %d", reloadedState.Account2Nonce[andrej])
+		}
+
+		if !reloadedState.IsKnownBlock(parent) {
+			t.Errorf("latest block %x should be known", parent)
+		}
+	}
+
+	assertReloadedState()
+
+	err = ioutil.WriteFile(filepath.Join(dataDir, "database", "snapshots", "4.json"), []byte(`{"checksum":"00","snapshot":{"height":4}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertReloadedState()
+
+	// A snapshot with a valid checksum but a state not matching its block state root is ignored too
+	snapshotPath := filepath.Join(dataDir, "database", "snapshots", "2.json")
+	fileJson, err := ioutil.ReadFile(snapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file snapshotFile
+	var snapshot stateSnapshot
+	if err := json.Unmarshal(fileJson, &file); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(file.Snapshot, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot.Balances[babaYaga] = AmountFromTBB(1000000)
+	file.Snapshot, err = json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Checksum = sha256.Sum256(file.Snapshot)
+
+	fileJson, err = json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(snapshotPath, fileJson, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertReloadedState()
+}
@@ -16,12 +16,12 @@
 package database
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
-	"os"
 	"reflect"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -31,10 +31,21 @@ const TxGasPriceDefault = 1
 const TxFee = uint(50)
 
 type State struct {
-	Balances      map[common.Address]uint
+	// Balances are in whole TBB before the TIP9 fork and in the smallest unit since, see ChainConfig.AmountUnit
+	Balances      map[common.Address]Amount
 	Account2Nonce map[common.Address]uint
-
-	dbFile *os.File
+	// Multisig accounts registered since the TIP11 fork
+	multisigs map[common.Address]Multisig
+	// Locked amounts of the balances credited by locked transfers since the TIP12 fork and genesis vestings
+	locks map[common.Address][]LockedAmount
+	// User-issued tokens by symbol and their holders balances since the TIP13 fork
+	tokens        map[string]Token
+	tokenBalances map[string]map[common.Address]Amount
+
+	store   BlockStore
+	index   *chainIndex
+	dataDir string
+	genesis Genesis
 
 	latestBlock     Block
 	latestBlockHash Hash
@@ -42,12 +53,24 @@ type State struct {
 
 	miningDifficulty uint
 
-	forkTIP1 uint64
-
-	HashCache   map[string]int64
-	HeightCache map[uint64]int64
+	config ChainConfig
+	// Retargeted mining difficulty since the TIP5 fork
+	retarget retargetWindow
+	// Times of the latest blocks and the clock validating new block times since the TIP7 fork
+	recentBlockTimes []uint64
+	clock            func() time.Time
+
+	// knownBlocks holds the height and the cumulative work of every main chain and side branch block
+	knownBlocks map[Hash]blockMeta
+	// sideBlocks are valid blocks not part of the main chain, kept in case their branch overtakes it
+	sideBlocks map[Hash]Block
+	// blocksLock guards the known and side blocks, read by the node HTTP and sync goroutines during block imports
+	blocksLock *sync.RWMutex
 }
 
+// NewStateFromDisk loads the state of the latest stored block.
+//
+// The mining difficulty overrides the genesis one unless it's 0.
 func NewStateFromDisk(dataDir string, miningDifficulty uint) (*State, error) {
 	err := InitDataDirIfNotExists(dataDir, []byte(genesisJson))
 	if err != nil {
@@ -59,59 +82,118 @@ func NewStateFromDisk(dataDir string, miningDifficulty uint) (*State, error) {
 		return nil, err
 	}
 
-	balances := make(map[common.Address]uint)
-	for account, balance := range gen.Balances {
-		balances[account] = balance
+	store, err := OpenBlockStore(dataDir)
+	if err != nil {
+		return nil, err
 	}
 
-	account2nonce := make(map[common.Address]uint)
+	index, err := openChainIndex(dataDir)
+	if err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+
+	state := newStateFromGenesis(gen, miningDifficulty)
+	state.store = store
+	state.index = index
+	state.dataDir = dataDir
 
-	dbFilepath := getBlocksDbFilePath(dataDir)
-	f, err := os.OpenFile(dbFilepath, os.O_APPEND|os.O_RDWR, 0600)
+	loadedState, err := state.loadLatest()
 	if err != nil {
+		_ = state.Close()
 		return nil, err
 	}
 
-	scanner := bufio.NewScanner(f)
+	return loadedState, nil
+}
 
-	state := &State{balances, account2nonce, f, Block{}, Hash{}, false, miningDifficulty, gen.ForkTIP1, map[string]int64{}, map[uint64]int64{}}
+// loadLatest rebuilds the state of the latest stored block and catches up the chain index and snapshots.
+func (s *State) loadLatest() (*State, error) {
+	err := s.index.catchUp(s.store)
+	if err != nil {
+		return nil, err
+	}
 
-	// set file position
-	filePos := int64(0)
+	latest, ok, err := s.store.Latest()
+	if err != nil {
+		return nil, err
+	}
 
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return nil, err
-		}
+	if !ok {
+		return s, nil
+	}
 
-		blockFsJson := scanner.Bytes()
+	state, err := s.stateAt(int64(latest.Value.Header.Number))
+	if err != nil {
+		return nil, err
+	}
+	state.index = s.index
 
-		if len(blockFsJson) == 0 {
-			break
-		}
+	// Spare the next start from replaying the same blocks again
+	heights, err := state.snapshotHeights()
+	if err != nil {
+		return nil, err
+	}
 
-		var blockFs BlockFS
-		err = json.Unmarshal(blockFsJson, &blockFs)
-		if err != nil {
-			return nil, err
-		}
+	newestSnapshot := uint64(0)
+	if len(heights) > 0 {
+		newestSnapshot = heights[0]
+	}
 
-		err = applyBlock(blockFs.Value, state)
+	if SnapshotInterval > 0 && latest.Value.Header.Number-newestSnapshot >= SnapshotInterval {
+		err = state.writeSnapshot()
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		// set search caches
-		state.HashCache[blockFs.Key.Hex()] = filePos
-		state.HeightCache[blockFs.Value.Header.Number] = filePos
-		filePos += int64(len(blockFsJson)) + 1
+	return state, nil
+}
 
-		state.latestBlock = blockFs.Value
-		state.latestBlockHash = blockFs.Key
-		state.hasGenesisBlock = true
+// newStateFromGenesis creates the state before the first block. A non-zero mining difficulty overrides the genesis one.
+func newStateFromGenesis(gen Genesis, miningDifficulty uint) *State {
+	config := gen.ChainConfig()
+	if miningDifficulty == 0 {
+		miningDifficulty = config.MiningDifficulty
 	}
 
-	return state, nil
+	balances := make(map[common.Address]Amount)
+	for account, balance := range gen.Balances {
+		balances[account] = NewAmount(uint64(balance))
+	}
+
+	// Vested tranches add up to the account balance, locked until they vest
+	locks := make(map[common.Address][]LockedAmount)
+	for account, vestings := range gen.Vesting {
+		for _, vesting := range vestings {
+			amount := NewAmount(uint64(vesting.Amount))
+			balances[account], _ = balances[account].Add(amount)
+			locks[account] = append(locks[account], LockedAmount{amount, vesting.TimeLock})
+		}
+	}
+
+	state := &State{
+		Balances:         balances,
+		Account2Nonce:    make(map[common.Address]uint),
+		multisigs:        make(map[common.Address]Multisig),
+		locks:            locks,
+		tokens:           make(map[string]Token),
+		tokenBalances:    make(map[string]map[common.Address]Amount),
+		genesis:          gen,
+		miningDifficulty: miningDifficulty,
+		config:           config,
+		recentBlockTimes: make([]uint64, 0, medianTimeBlocks),
+		clock:            time.Now,
+		knownBlocks:      make(map[Hash]blockMeta),
+		sideBlocks:       make(map[Hash]Block),
+		blocksLock:       &sync.RWMutex{},
+	}
+
+	// The genesis allocations are whole TBB, a chain starting with TIP9 converts them right away.
+	// Multiplying uint balances by 10^18 can't overflow 256 bits.
+	_ = state.migrateBalancesIfDue(0)
+
+	return state
 }
 
 func (s *State) AddBlocks(blocks []Block) error {
@@ -125,7 +207,15 @@ func (s *State) AddBlocks(blocks []Block) error {
 	return nil
 }
 
+// AddBlock imports the block following the heaviest chain fork-choice rule, see ImportBlock.
 func (s *State) AddBlock(b Block) (Hash, error) {
+	blockHash, _, err := s.ImportBlock(b)
+
+	return blockHash, err
+}
+
+// addLatestBlock validates the block extending the latest block and persists it.
+func (s *State) addLatestBlock(b Block) (Hash, error) {
 	pendingState := s.Copy()
 
 	err := applyBlock(b, &pendingState)
@@ -138,37 +228,56 @@ func (s *State) AddBlock(b Block) (Hash, error) {
 		return Hash{}, err
 	}
 
-	blockFs := BlockFS{blockHash, b}
+	err = s.persistBlock(BlockFS{blockHash, b})
+	if err != nil {
+		return Hash{}, err
+	}
+
+	s.Balances = pendingState.Balances
+	s.Account2Nonce = pendingState.Account2Nonce
+	s.multisigs = pendingState.multisigs
+	s.locks = pendingState.locks
+	s.tokens = pendingState.tokens
+	s.tokenBalances = pendingState.tokenBalances
+	s.latestBlockHash = blockHash
+	s.latestBlock = b
+	s.hasGenesisBlock = true
+	s.miningDifficulty = pendingState.miningDifficulty
+	s.retarget = pendingState.retarget
+	s.recentBlockTimes = pendingState.recentBlockTimes
+
+	s.snapshotIfDue()
+
+	return blockHash, nil
+}
 
+// persistBlock appends the block to the main chain in the block store.
+func (s *State) persistBlock(blockFs BlockFS) error {
 	blockFsJson, err := json.Marshal(blockFs)
 	if err != nil {
-		return Hash{}, err
+		return err
 	}
 
 	fmt.Printf("\nPersisting new Block to disk:\n")
 	fmt.Printf("\t%s\n", blockFsJson)
 
-	// get file pos for cache
-	fs, _ := s.dbFile.Stat()
-	filePos := fs.Size() + 1
-
-	_, err = s.dbFile.Write(append(blockFsJson, '\n'))
+	err = s.store.Put(blockFs)
 	if err != nil {
-		return Hash{}, err
+		return err
 	}
 
-	// set search caches
-	s.HashCache[blockFs.Key.Hex()] = filePos
-	s.HeightCache[blockFs.Value.Header.Number] = filePos
+	if s.index != nil {
+		err = s.index.indexBlock(blockFs)
+		if err != nil {
+			return err
+		}
+	}
 
-	s.Balances = pendingState.Balances
-	s.Account2Nonce = pendingState.Account2Nonce
-	s.latestBlockHash = blockHash
-	s.latestBlock = b
-	s.hasGenesisBlock = true
-	s.miningDifficulty = pendingState.miningDifficulty
+	if _, isKnown := s.knownBlocks[blockFs.Key]; !isKnown {
+		s.knownBlocks[blockFs.Key] = s.nextBlockMeta(blockFs.Value)
+	}
 
-	return blockHash, nil
+	return nil
 }
 
 func (s *State) NextBlockNumber() uint64 {
@@ -191,12 +300,41 @@ func (s *State) GetNextAccountNonce(account common.Address) uint {
 	return s.Account2Nonce[account] + 1
 }
 
+func (s *State) MiningDifficulty() uint {
+	return s.miningDifficulty
+}
+
+// Genesis returns the chain params the state was created with.
+func (s *State) Genesis() Genesis {
+	return s.genesis
+}
+
 func (s *State) ChangeMiningDifficulty(newDifficulty uint) {
 	s.miningDifficulty = newDifficulty
 }
 
-func (s *State) IsTIP1Fork() bool {
-	return s.NextBlockNumber() >= s.forkTIP1
+// ChainConfig returns the consensus params and fork schedule of the chain.
+func (s *State) ChainConfig() ChainConfig {
+	return s.config
+}
+
+// IsForkActive returns true if the fork rules apply to the next block.
+func (s *State) IsForkActive(fork Fork) bool {
+	return s.config.IsActive(fork, s.NextBlockNumber())
+}
+
+// FormatAmount formats a balance amount of the next block in decimal TBB.
+func (s *State) FormatAmount(amount Amount) string {
+	if s.IsForkActive(ForkTIP9) {
+		return amount.FormatTBB()
+	}
+
+	return amount.String()
+}
+
+// TxChainID is the chain ID the TXs of the next block must be signed with, empty before the TIP4 fork.
+func (s *State) TxChainID() string {
+	return s.config.TxChainID(s.NextBlockNumber())
 }
 
 func (s *State) Copy() State {
@@ -204,10 +342,19 @@ func (s *State) Copy() State {
 	c.hasGenesisBlock = s.hasGenesisBlock
 	c.latestBlock = s.latestBlock
 	c.latestBlockHash = s.latestBlockHash
-	c.Balances = make(map[common.Address]uint)
+	c.Balances = make(map[common.Address]Amount)
 	c.Account2Nonce = make(map[common.Address]uint)
+	c.multisigs = make(map[common.Address]Multisig)
+	c.locks = make(map[common.Address][]LockedAmount)
+	c.tokens = make(map[string]Token)
+	c.tokenBalances = make(map[string]map[common.Address]Amount)
+	c.genesis = s.genesis
 	c.miningDifficulty = s.miningDifficulty
-	c.forkTIP1 = s.forkTIP1
+	c.config = s.config
+	c.retarget = s.retarget
+	c.recentBlockTimes = append(make([]uint64, 0, medianTimeBlocks), s.recentBlockTimes...)
+	c.clock = s.clock
+	c.blocksLock = &sync.RWMutex{}
 
 	for acc, balance := range s.Balances {
 		c.Balances[acc] = balance
@@ -217,11 +364,34 @@ func (s *State) Copy() State {
 		c.Account2Nonce[acc] = nonce
 	}
 
+	for acc, multisig := range s.multisigs {
+		c.multisigs[acc] = multisig
+	}
+
+	for acc, locks := range s.locks {
+		c.locks[acc] = append(make([]LockedAmount, 0, len(locks)), locks...)
+	}
+
+	for symbol, token := range s.tokens {
+		c.tokens[symbol] = token
+	}
+
+	for symbol, balances := range s.tokenBalances {
+		c.tokenBalances[symbol] = make(map[common.Address]Amount)
+		for acc, balance := range balances {
+			c.tokenBalances[symbol][acc] = balance
+		}
+	}
+
 	return c
 }
 
 func (s *State) Close() error {
-	return s.dbFile.Close()
+	if s.index != nil {
+		_ = s.index.close()
+	}
+
+	return s.store.Close()
 }
 
 // applyBlock verifies if block can be added to the blockchain.
@@ -243,31 +413,128 @@ func applyBlock(b Block, s *State) error {
 		return err
 	}
 
-	if !IsBlockHashValid(hash, s.miningDifficulty) {
-		return fmt.Errorf("invalid block hash %x", hash)
+	err = s.verifyBlockDifficulty(hash, b)
+	if err != nil {
+		return err
+	}
+
+	err = s.verifyBlockTime(b)
+	if err != nil {
+		return err
 	}
 
-	err = applyTXs(b.TXs, s)
+	err = s.config.verifyBlockLimits(b)
 	if err != nil {
 		return err
 	}
 
-	s.Balances[b.Header.Miner] += BlockReward
-	if s.IsTIP1Fork() {
-		s.Balances[b.Header.Miner] += b.GasReward()
-	} else {
-		s.Balances[b.Header.Miner] += uint(len(b.TXs)) * TxFee
+	if s.config.IsActive(ForkTIP2, b.Header.Number) {
+		txRoot, err := TxRoot(b.TXs)
+		if err != nil {
+			return err
+		}
+
+		if b.Header.TxRoot == nil || *b.Header.TxRoot != txRoot {
+			return fmt.Errorf("invalid block TX root. expected: %x", txRoot)
+		}
+	} else if b.Header.TxRoot != nil {
+		return fmt.Errorf("invalid block. `TxRoot` can't be populated before TIP2 fork is active")
+	}
+
+	if s.config.IsActive(ForkTIP3, b.Header.Number) {
+		if b.Header.StateRoot == nil {
+			return fmt.Errorf("invalid block. `StateRoot` is required since TIP3 fork")
+		}
+	} else if b.Header.StateRoot != nil {
+		return fmt.Errorf("invalid block. `StateRoot` can't be populated before TIP3 fork is active")
+	}
+
+	err = applyBlockPayload(b, s)
+	if err != nil {
+		return err
+	}
+
+	if b.Header.StateRoot != nil {
+		stateRoot := s.stateRootAt(b.Header.Number)
+		if *b.Header.StateRoot != stateRoot {
+			return fmt.Errorf("invalid block state root %x. expected: %x", *b.Header.StateRoot, stateRoot)
+		}
+	}
+
+	s.updateRetargetWindow(b)
+	s.recordBlockTime(b)
+
+	return s.migrateBalancesIfDue(b.Header.Number + 1)
+}
+
+// migrateBalancesIfDue converts the whole TBB balances to the smallest unit before the TIP9 fork block gets applied.
+func (s *State) migrateBalancesIfDue(nextBlockNumber uint64) error {
+	height, ok := s.config.ForkHeight(ForkTIP9)
+	if !ok || height != nextBlockNumber {
+		return nil
+	}
+
+	for account, balance := range s.Balances {
+		migrated, err := balance.Mul(s.config.AmountUnit(height))
+		if err != nil {
+			return fmt.Errorf("unable to migrate account '%s' balance to TIP9 amounts: %w", account.String(), err)
+		}
+
+		s.Balances[account] = migrated
+	}
+
+	for account, locks := range s.locks {
+		for i, lock := range locks {
+			migrated, err := lock.Amount.Mul(s.config.AmountUnit(height))
+			if err != nil {
+				return fmt.Errorf("unable to migrate account '%s' locked amount to TIP9 amounts: %w", account.String(), err)
+			}
+
+			locks[i].Amount = migrated
+		}
 	}
 
 	return nil
 }
 
-func applyTXs(txs []SignedTx, s *State) error {
-	sort.Slice(txs, func(i, j int) bool {
-		return txs[i].Time < txs[j].Time
-	})
+// applyBlockPayload applies the block TXs and rewards the miner.
+func applyBlockPayload(b Block, s *State) error {
+	s.releaseUnlocked(b.Header.Number)
+
+	err := applyTXs(b.TXs, b.Header.Number, s)
+	if err != nil {
+		return err
+	}
+
+	reward, err := s.config.minerReward(b)
+	if err != nil {
+		return err
+	}
+
+	minerBalance, err := s.Balances[b.Header.Miner].Add(reward)
+	if err != nil {
+		return fmt.Errorf("invalid block. Miner '%s' balance %s", b.Header.Miner.String(), err)
+	}
+
+	s.Balances[b.Header.Miner] = minerBalance
+
+	return nil
+}
 
-	for _, tx := range txs {
+func applyTXs(txs []SignedTx, height uint64, s *State) error {
+	// Sort a copy to keep the block TXs, and therefore the block hash, intact
+	sortedTXs := make([]SignedTx, len(txs))
+	copy(sortedTXs, txs)
+
+	if s.config.IsActive(ForkTIP14, height) {
+		SortBlockTXs(sortedTXs)
+	} else {
+		sort.Slice(sortedTXs, func(i, j int) bool {
+			return sortedTXs[i].Time < sortedTXs[j].Time
+		})
+	}
+
+	for _, tx := range sortedTXs {
 		err := ApplyTx(tx, s)
 		if err != nil {
 			return err
@@ -277,28 +544,70 @@ func applyTXs(txs []SignedTx, s *State) error {
 	return nil
 }
 
+// SortBlockTXs sorts the TXs in the order blocks apply them since the TIP14 fork: by time, by nonce on a tie, and stable otherwise.
+func SortBlockTXs(txs []SignedTx) {
+	sort.SliceStable(txs, func(i, j int) bool {
+		if txs[i].Time == txs[j].Time {
+			return txs[i].Nonce < txs[j].Nonce
+		}
+
+		return txs[i].Time < txs[j].Time
+	})
+}
+
 func ApplyTx(tx SignedTx, s *State) error {
 	err := ValidateTx(tx, s)
 	if err != nil {
 		return err
 	}
 
-	s.Balances[tx.From] -= tx.Cost(s.IsTIP1Fork())
-	s.Balances[tx.To] += tx.Value
+	switch tx.Type {
+	case TxTypeLegacy, TxTypeTransfer, TxTypeMultisigSpend:
+		err = applyTransferTx(tx, s)
+	case TxTypeMultisigRegister:
+		err = applyMultisigRegisterTx(tx, s)
+	case TxTypeLockedTransfer:
+		err = applyLockedTransferTx(tx, s)
+	case TxTypeTokenCreate, TxTypeTokenTransfer, TxTypeTokenBurn:
+		err = applyTokenTx(tx, s)
+	default:
+		err = fmt.Errorf("invalid TX. Unknown TX type %d", tx.Type)
+	}
+
+	if err != nil {
+		return err
+	}
 
 	s.Account2Nonce[tx.From] = tx.Nonce
 
 	return nil
 }
 
+// ValidateTx checks the rules common to all TXs, then the rules of the TX type.
 func ValidateTx(tx SignedTx, s *State) error {
-	ok, err := tx.IsAuthentic()
+	err := s.validateTxType(tx)
 	if err != nil {
 		return err
 	}
 
-	if !ok {
-		return fmt.Errorf("wrong TX. Sender '%s' is forged", tx.From.String())
+	if tx.Type == TxTypeMultisigSpend {
+		err = s.verifyMultisigSignatures(tx)
+		if err != nil {
+			return err
+		}
+	} else {
+		ok, err := tx.IsAuthentic()
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return fmt.Errorf("wrong TX. Sender '%s' is forged", tx.From.String())
+		}
+
+		if len(tx.Sigs) != 0 {
+			return fmt.Errorf("invalid TX. Only multisig spend TXs carry `signatures`")
+		}
 	}
 
 	expectedNonce := s.GetNextAccountNonce(tx.From)
@@ -306,7 +615,7 @@ func ValidateTx(tx SignedTx, s *State) error {
 		return fmt.Errorf("wrong TX. Sender '%s' next nonce must be '%d', not '%d'", tx.From.String(), expectedNonce, tx.Nonce)
 	}
 
-	if s.IsTIP1Fork() {
+	if s.IsForkActive(ForkTIP1) {
 		// For now we only have one type, transfer TXs, so all TXs must pay 21 gas like on Ethereum (21 000)
 		if tx.Gas != TxGas {
 			return fmt.Errorf("insufficient TX gas %v. required: %v", tx.Gas, TxGas)
@@ -325,9 +634,141 @@ func ValidateTx(tx SignedTx, s *State) error {
 		}
 	}
 
-	if tx.Cost(s.IsTIP1Fork()) > s.Balances[tx.From] {
-		return fmt.Errorf("wrong TX. Sender '%s' balance is %d TBB. Tx cost is %d TBB", tx.From.String(), s.Balances[tx.From], tx.Cost(s.IsTIP1Fork()))
+	if s.IsForkActive(ForkTIP4) {
+		// Prevents replaying TXs signed for another chain sharing the same accounts, e.g. a private testnet
+		if tx.ChainID != s.config.ChainID {
+			return fmt.Errorf("wrong TX. Chain ID '%s' doesn't match this chain '%s'", tx.ChainID, s.config.ChainID)
+		}
+	} else if tx.ChainID != "" {
+		return fmt.Errorf("invalid TX. `ChainID` can't be populated before TIP4 fork is active")
+	}
+
+	if s.IsForkActive(ForkTIP8) {
+		// A TX exceeding the block limits on its own could never be mined
+		err := s.config.verifyTxFitsBlock(tx, s.NextBlockNumber())
+		if err != nil {
+			return err
+		}
+	}
+
+	if tx.Multisig != nil && tx.Type != TxTypeMultisigRegister {
+		return fmt.Errorf("invalid TX. Only multisig register TXs populate `Multisig`")
+	}
+
+	if tx.Lock != nil && tx.Type != TxTypeLockedTransfer {
+		return fmt.Errorf("invalid TX. Only locked transfer TXs populate `Lock`")
+	}
+
+	if tx.Token != nil && !isTokenTxType(tx.Type) {
+		return fmt.Errorf("invalid TX. Only token TXs populate `Token`")
+	}
+
+	switch tx.Type {
+	case TxTypeLegacy, TxTypeTransfer, TxTypeMultisigSpend:
+		return validateTransferTx(tx, s)
+	case TxTypeMultisigRegister:
+		return validateMultisigRegisterTx(tx, s)
+	case TxTypeLockedTransfer:
+		return validateLockedTransferTx(tx, s)
+	case TxTypeTokenCreate, TxTypeTokenTransfer, TxTypeTokenBurn:
+		return validateTokenTx(tx, s)
+	default:
+		return fmt.Errorf("invalid TX. Unknown TX type %d", tx.Type)
+	}
+}
+
+// validateTxType checks the TX type is known and activated by its fork.
+func (s *State) validateTxType(tx SignedTx) error {
+	if s.IsForkActive(ForkTIP10) {
+		if tx.Type == TxTypeLegacy {
+			return fmt.Errorf("invalid TX. Legacy TXs are replaced by typed TXs since TIP10 fork")
+		}
+	} else if tx.Type != TxTypeLegacy {
+		return fmt.Errorf("invalid TX. `Type` can't be populated before TIP10 fork is active")
+	}
+
+	switch tx.Type {
+	case TxTypeLegacy, TxTypeTransfer:
+		return nil
+	case TxTypeMultisigRegister, TxTypeMultisigSpend:
+		if !s.IsForkActive(ForkTIP11) {
+			return fmt.Errorf("invalid TX. Multisig TXs require TIP11 fork to be active")
+		}
+
+		return nil
+	case TxTypeLockedTransfer:
+		if !s.IsForkActive(ForkTIP12) {
+			return fmt.Errorf("invalid TX. Locked transfer TXs require TIP12 fork to be active")
+		}
+
+		return nil
+	case TxTypeTokenCreate, TxTypeTokenTransfer, TxTypeTokenBurn:
+		if !s.IsForkActive(ForkTIP13) {
+			return fmt.Errorf("invalid TX. Token TXs require TIP13 fork to be active")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("invalid TX. Unknown TX type %d", tx.Type)
 	}
+}
+
+// validateTransferTx checks the transferred amount fields and the sender spendable balance covers the TX cost.
+func validateTransferTx(tx SignedTx, s *State) error {
+	if s.IsForkActive(ForkTIP9) {
+		if tx.Amount == nil {
+			return fmt.Errorf("invalid TX. `Amount` is required since TIP9 fork")
+		}
+
+		if tx.Value != 0 {
+			return fmt.Errorf("invalid TX. `Value` is replaced by `Amount` since TIP9 fork")
+		}
+	} else if tx.Amount != nil {
+		return fmt.Errorf("invalid TX. `Amount` can't be populated before TIP9 fork is active")
+	}
+
+	cost, err := s.config.TxCost(tx.Tx, s.NextBlockNumber())
+	if err != nil {
+		return fmt.Errorf("wrong TX. Cost %s", err)
+	}
+
+	if cost.Cmp(s.Balances[tx.From]) > 0 {
+		return fmt.Errorf("wrong TX. Sender '%s' balance is %s %s. Tx cost is %s %s", tx.From.String(), s.FormatAmount(s.Balances[tx.From]), s.genesis.Symbol, s.FormatAmount(cost), s.genesis.Symbol)
+	}
+
+	// Locked amounts are part of the balance but the sender can't spend them before they unlock
+	spendable := s.SpendableBalance(tx.From)
+	if cost.Cmp(spendable) > 0 {
+		return fmt.Errorf("wrong TX. Sender '%s' spendable balance is %s %s, %s %s is locked. Tx cost is %s %s", tx.From.String(), s.FormatAmount(spendable), s.genesis.Symbol, s.FormatAmount(s.LockedBalance(tx.From)), s.genesis.Symbol, s.FormatAmount(cost), s.genesis.Symbol)
+	}
+
+	return nil
+}
+
+// applyTransferTx charges the sender the TX cost and credits the recipient the transferred amount.
+func applyTransferTx(tx SignedTx, s *State) error {
+	cost, err := s.config.TxCost(tx.Tx, s.NextBlockNumber())
+	if err != nil {
+		return err
+	}
+
+	senderBalance, err := s.Balances[tx.From].Sub(cost)
+	if err != nil {
+		return err
+	}
+
+	recipientBalance := s.Balances[tx.To]
+	if tx.To == tx.From {
+		recipientBalance = senderBalance
+	}
+
+	recipientBalance, err = recipientBalance.Add(tx.TransferredAmount())
+	if err != nil {
+		return fmt.Errorf("wrong TX. Recipient '%s' balance %s", tx.To.String(), err)
+	}
+
+	s.Balances[tx.From] = senderBalance
+	s.Balances[tx.To] = recipientBalance
 
 	return nil
 }
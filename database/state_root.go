@@ -0,0 +1,319 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The state is a sparse Merkle tree with one leaf per possible address, the address bits are the path from the root.
+const stateTreeDepth = common.AddressLength * 8
+
+// emptyStateSubtrees[h] is the root of a subtree of height h without any accounts.
+var emptyStateSubtrees = func() [stateTreeDepth + 1]Hash {
+	var empty [stateTreeDepth + 1]Hash
+
+	for h := 1; h <= stateTreeDepth; h++ {
+		empty[h] = merkleNode(empty[h-1], empty[h-1])
+	}
+
+	return empty
+}()
+
+// StateProofSibling is a non-empty sibling subtree on the path from an account leaf to the state root.
+type StateProofSibling struct {
+	// Depth of the sibling in the tree, the root children are at depth 1
+	Depth int  `json:"depth"`
+	Hash  Hash `json:"hash"`
+}
+
+// Sections of the account extension committed in the account leaf, in their encoding order.
+const (
+	// stateExtensionMultisig commits the multisig account config since the TIP11 fork
+	stateExtensionMultisig byte = 1
+	// stateExtensionLocks commits the amounts locked in the account balance and their release conditions since the TIP12 fork
+	stateExtensionLocks byte = 2
+	// stateExtensionToken commits the symbols and supplies of the tokens issued by the account since the TIP13 fork
+	stateExtensionToken byte = 3
+	// stateExtensionTokenBalance commits the token balances held by the account since the TIP13 fork
+	stateExtensionTokenBalance byte = 4
+)
+
+// AccountProof proves the balance and nonce of an account against a block state root.
+//
+// An account without balance and nonce is proven absent the same way.
+type AccountProof struct {
+	Account common.Address `json:"account"`
+	Balance Amount         `json:"balance"`
+	Nonce   uint           `json:"nonce"`
+	// Extension is the hash of the account state beyond its balance and nonce, e.g. its multisig config, locks or tokens, zero without
+	Extension   Hash                `json:"extension"`
+	BlockHash   Hash                `json:"block_hash"`
+	BlockNumber uint64              `json:"block_number"`
+	StateRoot   Hash                `json:"state_root"`
+	Siblings    []StateProofSibling `json:"siblings"`
+}
+
+// StateRoot returns the root of the sparse Merkle tree of all accounts, as committed by the latest block.
+func (s *State) StateRoot() Hash {
+	return s.stateRootAt(s.latestBlock.Header.Number)
+}
+
+// stateRootAt returns the state root committed by the block at the given height, the forks active at the height
+// decide which account extensions the accounts leaves commit.
+func (s *State) stateRootAt(height uint64) Hash {
+	return stateSubtreeRoot(s.stateLeaves(height), 0)
+}
+
+// NextStateRoot returns the state root after the next block mined by the miner with the given TXs.
+func (s *State) NextStateRoot(miner common.Address, txs []SignedTx) (Hash, error) {
+	next := s.Copy()
+
+	err := applyBlockPayload(Block{Header: BlockHeader{Number: s.NextBlockNumber(), Miner: miner}, TXs: txs}, &next)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return next.stateRootAt(s.NextBlockNumber()), nil
+}
+
+// accountProof returns the proof of the account leaf against the state root of the latest block.
+func (s *State) accountProof(account common.Address) AccountProof {
+	leaves := s.stateLeaves(s.latestBlock.Header.Number)
+	extension := Hash{}
+	for _, leaf := range leaves {
+		if leaf.account == account {
+			extension = leaf.extension
+		}
+	}
+
+	siblings := make([]StateProofSibling, 0)
+
+	for depth := 1; depth <= stateTreeDepth; depth++ {
+		var sibling []stateLeaf
+
+		// Split the accounts sharing the path so far by the next address bit
+		i := sort.Search(len(leaves), func(i int) bool { return addressBit(leaves[i].account, depth-1) == 1 })
+		if addressBit(account, depth-1) == 1 {
+			sibling, leaves = leaves[:i], leaves[i:]
+		} else {
+			leaves, sibling = leaves[:i], leaves[i:]
+		}
+
+		if len(sibling) > 0 {
+			siblings = append(siblings, StateProofSibling{depth, stateSubtreeRoot(sibling, depth)})
+		}
+	}
+
+	return AccountProof{
+		Account:   account,
+		Balance:   s.Balances[account],
+		Nonce:     s.Account2Nonce[account],
+		Extension: extension,
+		StateRoot: s.StateRoot(),
+		Siblings:  siblings,
+	}
+}
+
+// VerifyAccountProof checks the account balance and nonce lead to the proof state root.
+//
+// Light clients must also check the root belongs to a block header they trust.
+func VerifyAccountProof(proof AccountProof) bool {
+	siblings := make(map[int]Hash)
+	for _, sibling := range proof.Siblings {
+		if sibling.Depth < 1 || sibling.Depth > stateTreeDepth {
+			return false
+		}
+
+		siblings[sibling.Depth] = sibling.Hash
+	}
+
+	if len(siblings) != len(proof.Siblings) {
+		return false
+	}
+
+	node := stateLeafHash(stateLeaf{proof.Account, proof.Balance, proof.Nonce, proof.Extension})
+	for depth := stateTreeDepth; depth >= 1; depth-- {
+		sibling, ok := siblings[depth]
+		if !ok {
+			sibling = emptyStateSubtrees[stateTreeDepth-depth]
+		}
+
+		if addressBit(proof.Account, depth-1) == 1 {
+			node = merkleNode(sibling, node)
+		} else {
+			node = merkleNode(node, sibling)
+		}
+	}
+
+	return node == proof.StateRoot
+}
+
+type stateLeaf struct {
+	account   common.Address
+	balance   Amount
+	nonce     uint
+	extension Hash
+}
+
+// stateLeaves returns the non-empty accounts of the state committed by the block at the given height, sorted by address.
+func (s *State) stateLeaves(height uint64) []stateLeaf {
+	extensions := s.accountExtensions(height)
+
+	accounts := make(map[common.Address]struct{}, len(s.Balances))
+	for account := range s.Balances {
+		accounts[account] = struct{}{}
+	}
+
+	for account := range s.Account2Nonce {
+		accounts[account] = struct{}{}
+	}
+
+	for account := range extensions {
+		accounts[account] = struct{}{}
+	}
+
+	leaves := make([]stateLeaf, 0, len(accounts))
+	for account := range accounts {
+		leaf := stateLeaf{account, s.Balances[account], s.Account2Nonce[account], extensions[account]}
+		if !leaf.isEmpty() {
+			leaves = append(leaves, leaf)
+		}
+	}
+
+	sort.Slice(leaves, func(i, j int) bool {
+		return bytes.Compare(leaves[i].account[:], leaves[j].account[:]) < 0
+	})
+
+	return leaves
+}
+
+// accountExtensions hashes the accounts state beyond their balances and nonces, each section once its fork is active.
+func (s *State) accountExtensions(height uint64) map[common.Address]Hash {
+	encoders := make(map[common.Address]*canonicalEncoder)
+	encoder := func(account common.Address) *canonicalEncoder {
+		if _, ok := encoders[account]; !ok {
+			encoders[account] = &canonicalEncoder{}
+		}
+
+		return encoders[account]
+	}
+
+	if s.config.IsActive(ForkTIP11, height) {
+		for account, multisig := range s.multisigs {
+			e := encoder(account)
+			e.buf.WriteByte(stateExtensionMultisig)
+			e.writeMultisig(multisig)
+		}
+	}
+
+	if s.config.IsActive(ForkTIP12, height) {
+		for account, locks := range s.locks {
+			e := encoder(account)
+			e.buf.WriteByte(stateExtensionLocks)
+			e.writeUint64(uint64(len(locks)))
+
+			for _, lock := range locks {
+				e.writeAmount(&lock.Amount)
+				e.writeTimeLock(lock.TimeLock)
+			}
+		}
+	}
+
+	if s.config.IsActive(ForkTIP13, height) {
+		tokens := s.Tokens()
+		for _, token := range tokens {
+			e := encoder(token.Issuer)
+			e.buf.WriteByte(stateExtensionToken)
+			e.writeTokenAmount(TokenAmount{token.Symbol, token.Supply})
+		}
+
+		for _, token := range tokens {
+			for account, balance := range s.tokenBalances[token.Symbol] {
+				e := encoder(account)
+				e.buf.WriteByte(stateExtensionTokenBalance)
+				e.writeTokenAmount(TokenAmount{token.Symbol, balance})
+			}
+		}
+	}
+
+	extensions := make(map[common.Address]Hash, len(encoders))
+	for account, e := range encoders {
+		extensions[account] = sha256.Sum256(e.buf.Bytes())
+	}
+
+	return extensions
+}
+
+func (l stateLeaf) isEmpty() bool {
+	return l.balance.IsZero() && l.nonce == 0 && l.extension.IsEmpty()
+}
+
+// stateSubtreeRoot hashes the subtree at the given depth containing the sorted leaves.
+func stateSubtreeRoot(leaves []stateLeaf, depth int) Hash {
+	if len(leaves) == 0 {
+		return emptyStateSubtrees[stateTreeDepth-depth]
+	}
+
+	if depth == stateTreeDepth {
+		return stateLeafHash(leaves[0])
+	}
+
+	i := sort.Search(len(leaves), func(i int) bool { return addressBit(leaves[i].account, depth) == 1 })
+
+	return merkleNode(stateSubtreeRoot(leaves[:i], depth+1), stateSubtreeRoot(leaves[i:], depth+1))
+}
+
+// stateLeafHash returns the empty hash for empty accounts, they are indistinguishable from unused addresses.
+//
+// Balances fitting 8 bytes keep the leaf encoding predating the TIP9 fork, larger ones take 32 bytes.
+// Accounts with an extension append its hash. The leaf length tells the encodings apart.
+func stateLeafHash(leaf stateLeaf) Hash {
+	if leaf.isEmpty() {
+		return Hash{}
+	}
+
+	balanceLength := 8
+	if !leaf.balance.IsUint64() {
+		balanceLength = MaxAmountBits / 8
+	}
+
+	extensionLength := 0
+	if !leaf.extension.IsEmpty() {
+		extensionLength = len(leaf.extension)
+	}
+
+	data := make([]byte, 1+common.AddressLength+balanceLength+8+extensionLength)
+	data[0] = merkleLeafPrefix
+	copy(data[1:], leaf.account[:])
+	balance := leaf.balance.Bytes()
+	copy(data[1+common.AddressLength+balanceLength-len(balance):], balance)
+	binary.BigEndian.PutUint64(data[1+common.AddressLength+balanceLength:], uint64(leaf.nonce))
+	if extensionLength > 0 {
+		copy(data[1+common.AddressLength+balanceLength+8:], leaf.extension[:])
+	}
+
+	return sha256.Sum256(data)
+}
+
+func addressBit(account common.Address, i int) byte {
+	return (account[i/8] >> (7 - uint(i%8))) & 1
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - The TIP14 fork activates at block 1, after the first block
+//   - Andrej signs 2 TXs of the same time, the block lists his next nonce first
+//   - Before the fork the block applies them in the listed order and the nonce check rejects it
+//   - Since the fork the block applies them by nonce, the order the miner sorts them in
+func TestState_BlockTxOrder(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	_, _, miner, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	forks := make(map[Fork]uint64)
+	for _, fork := range KnownForks {
+		forks[fork] = 0
+	}
+	forks[ForkTIP14] = 1
+
+	err = InitGenesis(dataDir, Genesis{
+		ChainID:          testChainID,
+		Symbol:           "TBB",
+		Balances:         map[common.Address]uint{andrej: 100},
+		MiningDifficulty: GenesisParam(defaultTestMiningDifficulty),
+		Forks:            forks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	txTime := uint64(time.Now().Unix())
+	sign := func(privKey *ecdsa.PrivateKey, from common.Address, nonce uint) SignedTx {
+		tx := NewTransferTx(from, babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(1), nonce, "")
+		tx.Time = txTime
+
+		signedTx, err := signTx(tx, testChainID, privKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return signedTx
+	}
+
+	_, err = state.NextStateRoot(miner, []SignedTx{sign(andrejKey, andrej, 2), sign(andrejKey, andrej, 1)})
+	if err == nil {
+		t.Error("TXs of the same time should apply in the listed order before the TIP14 fork")
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, miner, sign(andrejKey, andrej, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txs := []SignedTx{sign(andrejKey, andrej, 3), sign(andrejKey, andrej, 2)}
+	_, err = state.AddBlock(mineTestBlock(t, state, miner, txs...))
+	if err != nil {
+		t.Fatalf("TXs of the same time should apply by nonce since the TIP14 fork: %s", err)
+	}
+
+	if state.Balances[babaYaga].Cmp(AmountFromTBB(3)) != 0 {
+		t.Errorf("BabaYaga balance should be 3 TBB not %s", state.FormatAmount(state.Balances[babaYaga]))
+	}
+
+	// The block keeps the TXs in the listed order, the block hash commits them
+	if state.LatestBlock().TXs[0].Nonce != 3 {
+		t.Errorf("block TXs should keep the listed order")
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MaxLocksPerAccount bounds the amounts locked in an account balance at once, each one is tracked until it unlocks.
+const MaxLocksPerAccount = 64
+
+// MinLockedTBB is the smallest amount a locked transfer TX can lock, in whole TBB, so taking a recipient lock slot costs more than dust.
+const MinLockedTBB = 1
+
+// MaxLockDuration is how far in the future a lock can end, in seconds, so a lock slot taken by a third party frees up eventually.
+// Lock heights are capped at the number of target block times it spans.
+const MaxLockDuration = 4 * 365 * 24 * 60 * 60
+
+// TimeLock holds an amount until a block height and/or a time, both must be reached to unlock it.
+//
+// The time is compared with the latest block time, so the amount is spendable by the TXs of the blocks
+// following the first block mined after the lock time.
+type TimeLock struct {
+	UntilHeight uint64 `json:"until_height,omitempty"`
+	UntilTime   uint64 `json:"until_time,omitempty"`
+}
+
+// LockedAmount is part of an account balance its owner can't spend before the lock releases it.
+type LockedAmount struct {
+	Amount Amount `json:"amount"`
+	TimeLock
+}
+
+// GenesisVesting is a tranche of whole TBB allocated in the genesis on top of the account balance, locked until it vests.
+type GenesisVesting struct {
+	Amount uint `json:"amount"`
+	TimeLock
+}
+
+// isLockedAt returns true if the lock still holds the amount for the block at the given height following a block of the given time.
+func (l TimeLock) isLockedAt(height uint64, latestBlockTime uint64) bool {
+	return height < l.UntilHeight || latestBlockTime < l.UntilTime
+}
+
+func (l TimeLock) validate() error {
+	if l.UntilHeight == 0 && l.UntilTime == 0 {
+		return fmt.Errorf("invalid time lock. `UntilHeight` or `UntilTime` is required")
+	}
+
+	return nil
+}
+
+// validateHorizon checks the lock ends within MaxLockDuration of the block at the given height following a block of the given time.
+// The first block has no previous block time to measure the lock time from, only its height is capped.
+func (l TimeLock) validateHorizon(c ChainConfig, height uint64, latestBlockTime uint64) error {
+	maxHeight := height + MaxLockDuration/c.TargetBlockTime
+	if l.UntilHeight > maxHeight {
+		return fmt.Errorf("invalid time lock. `UntilHeight` %d is after the max lock height %d", l.UntilHeight, maxHeight)
+	}
+
+	maxTime := latestBlockTime + MaxLockDuration
+	if latestBlockTime != 0 && l.UntilTime > maxTime {
+		return fmt.Errorf("invalid time lock. `UntilTime` %d is after the max lock time %d", l.UntilTime, maxTime)
+	}
+
+	return nil
+}
+
+// NewLockedTransferTx creates a TX crediting the recipient an amount locked until the time lock releases it.
+func NewLockedTransferTx(from, to common.Address, gas uint, gasPrice uint, amount Amount, lock TimeLock, nonce uint, data string) Tx {
+	tx := NewTransferTx(from, to, gas, gasPrice, amount, nonce, data)
+	tx.Type = TxTypeLockedTransfer
+	tx.Lock = &lock
+
+	return tx
+}
+
+// Locks returns the amounts of the account balance still locked for the next block.
+func (s *State) Locks(account common.Address) []LockedAmount {
+	locks := make([]LockedAmount, 0)
+	for _, lock := range s.locks[account] {
+		if lock.isLockedAt(s.NextBlockNumber(), s.latestBlockTime()) {
+			locks = append(locks, lock)
+		}
+	}
+
+	return locks
+}
+
+// LockedBalance is the part of the account balance the TXs of the next block can't spend.
+func (s *State) LockedBalance(account common.Address) Amount {
+	locked := Amount{}
+	for _, lock := range s.Locks(account) {
+		// The locked amounts are part of the balance which fits 256 bits
+		locked, _ = locked.Add(lock.Amount)
+	}
+
+	return locked
+}
+
+// SpendableBalance is the account balance minus its locked amounts.
+func (s *State) SpendableBalance(account common.Address) Amount {
+	spendable, err := s.Balances[account].Sub(s.LockedBalance(account))
+	if err != nil {
+		return Amount{}
+	}
+
+	return spendable
+}
+
+func (s *State) latestBlockTime() uint64 {
+	if !s.hasGenesisBlock {
+		return 0
+	}
+
+	return s.latestBlock.Header.Time
+}
+
+// releaseUnlocked forgets the locks released for the block at the given height following the latest block,
+// before its TXs get applied. The block state root then commits the locks still holding an amount.
+func (s *State) releaseUnlocked(height uint64) {
+	for account, locks := range s.locks {
+		stillLocked := make([]LockedAmount, 0, len(locks))
+		for _, lock := range locks {
+			if lock.isLockedAt(height, s.latestBlockTime()) {
+				stillLocked = append(stillLocked, lock)
+			}
+		}
+
+		if len(stillLocked) == 0 {
+			delete(s.locks, account)
+		} else if len(stillLocked) != len(locks) {
+			s.locks[account] = stillLocked
+		}
+	}
+}
+
+// validateLockedTransferTx checks the time lock, then the transfer.
+func validateLockedTransferTx(tx SignedTx, s *State) error {
+	if tx.Lock == nil {
+		return fmt.Errorf("invalid TX. `Lock` is required by locked transfer TXs")
+	}
+
+	err := tx.Lock.validate()
+	if err != nil {
+		return err
+	}
+
+	err = tx.Lock.validateHorizon(s.config, s.NextBlockNumber(), s.latestBlockTime())
+	if err != nil {
+		return err
+	}
+
+	minLocked, _ := s.config.AmountUnit(s.NextBlockNumber()).Mul(NewAmount(MinLockedTBB))
+	if tx.TransferredAmount().Cmp(minLocked) < 0 {
+		return fmt.Errorf("invalid TX. Locked transfer TXs must lock at least %d TBB", MinLockedTBB)
+	}
+
+	if len(s.Locks(tx.To)) >= MaxLocksPerAccount {
+		return fmt.Errorf("wrong TX. Recipient '%s' already has the max %d locked amounts", tx.To.String(), MaxLocksPerAccount)
+	}
+
+	return validateTransferTx(tx, s)
+}
+
+func applyLockedTransferTx(tx SignedTx, s *State) error {
+	err := applyTransferTx(tx, s)
+	if err != nil {
+		return err
+	}
+
+	s.locks[tx.To] = append(s.locks[tx.To], LockedAmount{tx.TransferredAmount(), *tx.Lock})
+
+	return nil
+}
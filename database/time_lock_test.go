@@ -0,0 +1,254 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Andrej's genesis allocation is 100 TBB spendable and 500 TBB vesting at block 2
+//   - Andrej can't spend the vesting tranche before block 2 nor lock a zero amount
+//   - Andrej sends BabaYaga 50 TBB locked until block 3, committed in the state root, BabaYaga can't spend them before
+//   - The locks are restored after reloading the state from disk
+func TestState_TimeLocks(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babaYagaKey, _, babaYaga, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, miner, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	forks := make(map[Fork]uint64)
+	for _, fork := range KnownForks {
+		forks[fork] = 0
+	}
+
+	err = InitGenesis(dataDir, Genesis{
+		ChainID:  testChainID,
+		Symbol:   "TBB",
+		Balances: map[common.Address]uint{andrej: 100},
+		Vesting: map[common.Address][]GenesisVesting{
+			andrej: {{Amount: 500, TimeLock: TimeLock{UntilHeight: 2}}},
+		},
+		MiningDifficulty: GenesisParam(defaultTestMiningDifficulty),
+		Forks:            forks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if state.Balances[andrej].Cmp(AmountFromTBB(600)) != 0 {
+		t.Fatalf("Andrej balance should be 600 TBB not %s", state.FormatAmount(state.Balances[andrej]))
+	}
+
+	if state.LockedBalance(andrej).Cmp(AmountFromTBB(500)) != 0 {
+		t.Fatalf("Andrej locked balance should be 500 TBB not %s", state.FormatAmount(state.LockedBalance(andrej)))
+	}
+
+	if err := ValidateTx(signTestTx(t, andrejKey, andrej, babaYaga, 200, 1), state); err == nil {
+		t.Error("spending the vesting tranche before block 2 should be rejected")
+	}
+
+	unlockedTx, err := signTx(NewLockedTransferTx(andrej, babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(50), TimeLock{}, 1, ""), testChainID, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateTx(unlockedTx, state); err == nil {
+		t.Error("locked transfer without a lock height or time should be rejected")
+	}
+
+	zeroTx, err := signTx(NewLockedTransferTx(andrej, babaYaga, TxGas, TxGasPriceDefault, Amount{}, TimeLock{UntilHeight: 3}, 1, ""), testChainID, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateTx(zeroTx, state); err == nil {
+		t.Error("locked transfer of a zero amount should be rejected")
+	}
+
+	lockedTx, err := signTx(NewLockedTransferTx(andrej, babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(50), TimeLock{UntilHeight: 3}, 1, ""), testChainID, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, miner, lockedTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The block state root commits the lock, a node releasing it earlier disagrees on it
+	tamperedState := state.Copy()
+	tamperedState.locks[babaYaga][0].UntilHeight = 2
+	if tamperedState.StateRoot() == *state.LatestBlock().Header.StateRoot {
+		t.Error("state root should commit the locks release height")
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, miner, signTestTx(t, andrejKey, andrej, miner, 1, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = state.Close()
+
+	state, err = NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if !state.LockedBalance(andrej).IsZero() {
+		t.Errorf("Andrej vesting tranche should be unlocked for block 2, %s TBB is locked", state.FormatAmount(state.LockedBalance(andrej)))
+	}
+
+	if state.SpendableBalance(babaYaga).Cmp(Amount{}) != 0 || state.LockedBalance(babaYaga).Cmp(AmountFromTBB(50)) != 0 {
+		t.Fatalf("BabaYaga 50 TBB should be locked until block 3, spendable: %s, locked: %s", state.FormatAmount(state.SpendableBalance(babaYaga)), state.FormatAmount(state.LockedBalance(babaYaga)))
+	}
+
+	if err := ValidateTx(signTestTx(t, babaYagaKey, babaYaga, andrej, 10, 1), state); err == nil {
+		t.Error("spending the locked amount before block 3 should be rejected")
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, miner, signTestTx(t, andrejKey, andrej, babaYaga, 200, 3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// BabaYaga received 200 TBB spendable and the 50 TBB are unlocked for block 3
+	if state.SpendableBalance(babaYaga).Cmp(AmountFromTBB(250)) != 0 {
+		t.Errorf("BabaYaga spendable balance should be 250 TBB not %s", state.FormatAmount(state.SpendableBalance(babaYaga)))
+	}
+
+	if err := ValidateTx(signTestTx(t, babaYagaKey, babaYaga, andrej, 220, 1), state); err != nil {
+		t.Errorf("spending the unlocked amount should be valid: %s", err)
+	}
+}
+
+// The test logic summary:
+//   - A griefer tries to take BabaYaga lock slots with dust and with locks until the max height or time
+//   - The dust lock is rejected, so are the locks ending after MaxLockDuration
+//   - A 1 TBB lock ending within MaxLockDuration takes a slot
+func TestState_LockGriefing(t *testing.T) {
+	grieferKey, _, griefer, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, babaYaga, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, miner, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	forks := make(map[Fork]uint64)
+	for _, fork := range KnownForks {
+		forks[fork] = 0
+	}
+
+	err = InitGenesis(dataDir, Genesis{
+		ChainID:          testChainID,
+		Symbol:           "TBB",
+		Balances:         map[common.Address]uint{griefer: 100},
+		MiningDifficulty: GenesisParam(defaultTestMiningDifficulty),
+		Forks:            forks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	// The lock time is measured from the latest block time
+	_, err = state.AddBlock(mineTestBlock(t, state, miner, signTestTx(t, grieferKey, griefer, miner, 1, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latestTime := state.LatestBlock().Header.Time
+	maxHeight := state.NextBlockNumber() + MaxLockDuration/DefaultTargetBlockTime
+
+	rejected := map[string]Tx{
+		"dust":        NewLockedTransferTx(griefer, babaYaga, TxGas, TxGasPriceDefault, NewAmount(1), TimeLock{UntilHeight: 3}, 2, ""),
+		"max height":  NewLockedTransferTx(griefer, babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(1), TimeLock{UntilHeight: math.MaxUint64}, 2, ""),
+		"max time":    NewLockedTransferTx(griefer, babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(1), TimeLock{UntilTime: math.MaxUint64}, 2, ""),
+		"past height": NewLockedTransferTx(griefer, babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(1), TimeLock{UntilHeight: maxHeight + 1}, 2, ""),
+		"past time":   NewLockedTransferTx(griefer, babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(1), TimeLock{UntilTime: latestTime + MaxLockDuration + 1}, 2, ""),
+	}
+
+	for name, tx := range rejected {
+		signedTx, err := signTx(tx, testChainID, grieferKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ValidateTx(signedTx, state); err == nil {
+			t.Errorf("%s locked transfer should be rejected", name)
+		}
+	}
+
+	lockedTx, err := signTx(NewLockedTransferTx(griefer, babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(1), TimeLock{UntilHeight: maxHeight, UntilTime: latestTime + MaxLockDuration}, 2, ""), testChainID, grieferKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, miner, lockedTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(state.Locks(babaYaga)) != 1 {
+		t.Errorf("BabaYaga should have 1 locked amount, not %d", len(state.Locks(babaYaga)))
+	}
+}
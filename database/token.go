@@ -0,0 +1,216 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// tokenSymbolPattern restricts user-issued token symbols to short upper case tickers, e.g. "BEER"
+var tokenSymbolPattern = regexp.MustCompile(`^[A-Z0-9]{1,12}$`)
+
+// Token is a fungible token issued on the chain since the TIP13 fork.
+//
+// Token amounts are integers of the token smallest unit, the issuer decides what a unit is worth.
+type Token struct {
+	Symbol string         `json:"symbol"`
+	Issuer common.Address `json:"issuer"`
+	// Supply is the created amount minus the burned amounts
+	Supply Amount `json:"supply"`
+}
+
+// TokenAmount is the token and amount a token TX creates, transfers or burns.
+type TokenAmount struct {
+	Symbol string `json:"symbol"`
+	Amount Amount `json:"amount"`
+}
+
+// NewTokenCreateTx creates a TX issuing a new token with its whole supply credited to the issuer.
+func NewTokenCreateTx(issuer common.Address, gas uint, gasPrice uint, symbol string, supply Amount, nonce uint, data string) Tx {
+	return newTokenTx(TxTypeTokenCreate, issuer, issuer, gas, gasPrice, symbol, supply, nonce, data)
+}
+
+// NewTokenTransferTx creates a TX transferring an amount of a token to the recipient.
+func NewTokenTransferTx(from, to common.Address, gas uint, gasPrice uint, symbol string, amount Amount, nonce uint, data string) Tx {
+	return newTokenTx(TxTypeTokenTransfer, from, to, gas, gasPrice, symbol, amount, nonce, data)
+}
+
+// NewTokenBurnTx creates a TX destroying an amount of a token held by the sender.
+func NewTokenBurnTx(from common.Address, gas uint, gasPrice uint, symbol string, amount Amount, nonce uint, data string) Tx {
+	return newTokenTx(TxTypeTokenBurn, from, from, gas, gasPrice, symbol, amount, nonce, data)
+}
+
+// newTokenTx creates a token TX, it transfers no TBB and only pays the miner fee.
+func newTokenTx(txType TxType, from, to common.Address, gas uint, gasPrice uint, symbol string, amount Amount, nonce uint, data string) Tx {
+	tx := NewTx(from, to, gas, gasPrice, 0, nonce, data)
+	tx.Type = txType
+	tx.Token = &TokenAmount{symbol, amount}
+
+	return tx
+}
+
+// Token returns the token issued with the symbol.
+func (s *State) Token(symbol string) (Token, bool) {
+	token, ok := s.tokens[symbol]
+
+	return token, ok
+}
+
+// Tokens returns the issued tokens sorted by symbol.
+func (s *State) Tokens() []Token {
+	tokens := make([]Token, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Symbol < tokens[j].Symbol
+	})
+
+	return tokens
+}
+
+// TokenBalance returns the amount of the token held by the account.
+func (s *State) TokenBalance(symbol string, account common.Address) Amount {
+	return s.tokenBalances[symbol][account]
+}
+
+// TokenBalances returns the token holders and their non-zero balances.
+func (s *State) TokenBalances(symbol string) map[common.Address]Amount {
+	balances := make(map[common.Address]Amount)
+	for account, balance := range s.tokenBalances[symbol] {
+		balances[account] = balance
+	}
+
+	return balances
+}
+
+func isTokenTxType(txType TxType) bool {
+	return txType == TxTypeTokenCreate || txType == TxTypeTokenTransfer || txType == TxTypeTokenBurn
+}
+
+// validateTokenTx checks the token TX pays only the miner fee in TBB, then the rules of the token TX type.
+func validateTokenTx(tx SignedTx, s *State) error {
+	if tx.Token == nil {
+		return fmt.Errorf("invalid TX. `Token` is required by token TXs")
+	}
+
+	if tx.Value != 0 || tx.Amount != nil {
+		return fmt.Errorf("invalid TX. Token TXs transfer a `Token` amount, `Value` and `Amount` must be empty")
+	}
+
+	if tx.Token.Amount.IsZero() {
+		return fmt.Errorf("invalid TX. Token amount must be positive")
+	}
+
+	fee := s.config.MinerFee(tx.Tx, s.NextBlockNumber())
+	if fee.Cmp(s.SpendableBalance(tx.From)) > 0 {
+		return fmt.Errorf("wrong TX. Sender '%s' spendable balance is %s %s. Tx fee is %s %s", tx.From.String(), s.FormatAmount(s.SpendableBalance(tx.From)), s.genesis.Symbol, s.FormatAmount(fee), s.genesis.Symbol)
+	}
+
+	symbol := tx.Token.Symbol
+
+	if tx.Type == TxTypeTokenCreate {
+		if !tokenSymbolPattern.MatchString(symbol) {
+			return fmt.Errorf("invalid TX. Token symbol '%s' must be 1 to 12 upper case letters or digits", symbol)
+		}
+
+		if symbol == s.genesis.Symbol {
+			return fmt.Errorf("wrong TX. Token symbol '%s' is the chain native token symbol", symbol)
+		}
+
+		if _, ok := s.tokens[symbol]; ok {
+			return fmt.Errorf("wrong TX. Token '%s' is already issued", symbol)
+		}
+	} else if _, ok := s.tokens[symbol]; !ok {
+		return fmt.Errorf("wrong TX. Unknown token '%s'", symbol)
+	} else if tx.Token.Amount.Cmp(s.TokenBalance(symbol, tx.From)) > 0 {
+		return fmt.Errorf("wrong TX. Sender '%s' balance is %s %s. Tx amount is %s %s", tx.From.String(), s.TokenBalance(symbol, tx.From).String(), symbol, tx.Token.Amount.String(), symbol)
+	}
+
+	if tx.Type != TxTypeTokenTransfer && tx.To != tx.From {
+		return fmt.Errorf("invalid TX. Token create and burn TXs must be sent to their sender")
+	}
+
+	return nil
+}
+
+func applyTokenTx(tx SignedTx, s *State) error {
+	fee := s.config.MinerFee(tx.Tx, s.NextBlockNumber())
+	senderBalance, err := s.Balances[tx.From].Sub(fee)
+	if err != nil {
+		return err
+	}
+
+	s.Balances[tx.From] = senderBalance
+
+	symbol := tx.Token.Symbol
+	amount := tx.Token.Amount
+
+	switch tx.Type {
+	case TxTypeTokenCreate:
+		s.tokens[symbol] = Token{symbol, tx.From, amount}
+		s.tokenBalances[symbol] = map[common.Address]Amount{tx.From: amount}
+
+		return nil
+	case TxTypeTokenTransfer:
+		err = s.subTokenBalance(symbol, tx.From, amount)
+		if err != nil {
+			return err
+		}
+
+		// The recipient balance can't overflow as it's at most the token supply
+		s.tokenBalances[symbol][tx.To], _ = s.tokenBalances[symbol][tx.To].Add(amount)
+
+		return nil
+	case TxTypeTokenBurn:
+		err = s.subTokenBalance(symbol, tx.From, amount)
+		if err != nil {
+			return err
+		}
+
+		token := s.tokens[symbol]
+		token.Supply, err = token.Supply.Sub(amount)
+		if err != nil {
+			return err
+		}
+		s.tokens[symbol] = token
+
+		return nil
+	default:
+		return fmt.Errorf("invalid TX. Unknown token TX type %d", tx.Type)
+	}
+}
+
+// subTokenBalance debits the holder, holders without any token left are forgotten.
+func (s *State) subTokenBalance(symbol string, holder common.Address, amount Amount) error {
+	balance, err := s.tokenBalances[symbol][holder].Sub(amount)
+	if err != nil {
+		return fmt.Errorf("wrong TX. Sender '%s' %s balance %s", holder.String(), symbol, err)
+	}
+
+	if balance.IsZero() {
+		delete(s.tokenBalances[symbol], holder)
+	} else {
+		s.tokenBalances[symbol][holder] = balance
+	}
+
+	return nil
+}
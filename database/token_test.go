@@ -0,0 +1,179 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Andrej issues 1000 BEER, the same symbol or an invalid one can't be issued again
+//   - Andrej transfers 300 BEER to BabaYaga, who can't transfer more than she holds
+//   - BabaYaga burns 100 BEER, reducing the supply
+//   - The token TXs only cost their gas in TBB
+//   - A block built on tampered token balances fails the state root check
+//   - The tokens are known again after reloading the state from disk
+func TestState_Tokens(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babaYagaKey, _, babaYaga, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000, babaYaga: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	createTx, err := signTx(NewTokenCreateTx(andrej, TxGas, TxGasPriceDefault, "BEER", NewAmount(1000), 1, ""), testChainID, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encodedTx, err := createTx.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodedTx, err := DecodeTx(encodedTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decodedTx.Token == nil || decodedTx.Token.Symbol != "BEER" || decodedTx.Token.Amount.Cmp(NewAmount(1000)) != 0 {
+		t.Fatalf("decoded token create TX should issue 1000 BEER, got %+v", decodedTx.Token)
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, andrej, createTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, ok := state.Token("BEER")
+	if !ok {
+		t.Fatal("BEER token should be issued")
+	}
+
+	if token.Issuer != andrej || token.Supply.Cmp(NewAmount(1000)) != 0 {
+		t.Fatalf("BEER should be issued by Andrej with a supply of 1000, got %+v", token)
+	}
+
+	for _, symbol := range []string{"BEER", "beer", "BEERBEERBEERB"} {
+		invalidTx, err := signTx(NewTokenCreateTx(babaYaga, TxGas, TxGasPriceDefault, symbol, NewAmount(1), 1, ""), testChainID, babaYagaKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ValidateTx(invalidTx, state); err == nil {
+			t.Errorf("issuing a token with the '%s' symbol should be rejected", symbol)
+		}
+	}
+
+	transferTx, err := signTx(NewTokenTransferTx(andrej, babaYaga, TxGas, TxGasPriceDefault, "BEER", NewAmount(300), 2, ""), testChainID, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, andrej, transferTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overspendTx, err := signTx(NewTokenTransferTx(babaYaga, andrej, TxGas, TxGasPriceDefault, "BEER", NewAmount(301), 1, ""), testChainID, babaYagaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateTx(overspendTx, state); err == nil {
+		t.Error("transferring more BEER than held should be rejected")
+	}
+
+	unknownTx, err := signTx(NewTokenTransferTx(babaYaga, andrej, TxGas, TxGasPriceDefault, "WINE", NewAmount(1), 1, ""), testChainID, babaYagaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateTx(unknownTx, state); err == nil {
+		t.Error("transferring an unknown token should be rejected")
+	}
+
+	burnTx, err := signTx(NewTokenBurnTx(babaYaga, TxGas, TxGasPriceDefault, "BEER", NewAmount(100), 1, ""), testChainID, babaYagaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, andrej, burnTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.TokenBalance("BEER", andrej).Cmp(NewAmount(700)) != 0 {
+		t.Errorf("Andrej should hold 700 BEER not %s", state.TokenBalance("BEER", andrej))
+	}
+
+	if state.TokenBalance("BEER", babaYaga).Cmp(NewAmount(200)) != 0 {
+		t.Errorf("BabaYaga should hold 200 BEER not %s", state.TokenBalance("BEER", babaYaga))
+	}
+
+	// The block state root commits the token balances, a block built on tampered ones is rejected
+	tamperedState := state.Copy()
+	tamperedState.tokenBalances["BEER"][babaYaga] = NewAmount(1000)
+	if tamperedState.StateRoot() == *state.LatestBlock().Header.StateRoot {
+		t.Error("state root should commit the token balances")
+	}
+
+	tamperedBlock := mineTestBlock(t, &tamperedState, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, 3))
+	if _, err := state.AddBlock(tamperedBlock); err == nil {
+		t.Error("block with tampered token balances in its state root should be rejected")
+	}
+
+	// BabaYaga paid 21 gas * 1 TBB for the burn TX and nothing else
+	expectedBabaYagaBalance := AmountFromTBB(1000 - TxGas*TxGasPriceDefault)
+	if state.Balances[babaYaga].Cmp(expectedBabaYagaBalance) != 0 {
+		t.Errorf("BabaYaga balance should be %s TBB not %s", state.FormatAmount(expectedBabaYagaBalance), state.FormatAmount(state.Balances[babaYaga]))
+	}
+
+	_ = state.Close()
+
+	reloadedState, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloadedState.Close()
+
+	tokens := reloadedState.Tokens()
+	if len(tokens) != 1 || tokens[0].Supply.Cmp(NewAmount(900)) != 0 {
+		t.Fatalf("BEER supply should be 900 after reloading the state, got %+v", tokens)
+	}
+
+	if len(reloadedState.TokenBalances("BEER")) != 2 {
+		t.Errorf("BEER should have 2 holders after reloading the state not %d", len(reloadedState.TokenBalances("BEER")))
+	}
+}
@@ -38,15 +38,45 @@ type Tx struct {
 	Nonce    uint           `json:"nonce"`
 	Data     string         `json:"data"`
 	Time     uint64         `json:"time"`
+	// ChainID binds the TX signature to a single chain since the TIP4 fork
+	ChainID string `json:"chain_id,omitempty"`
+	// Amount replaces the whole TBB Value since the TIP9 fork
+	Amount *Amount `json:"amount,omitempty"`
+	// Type is required since the TIP10 fork, typed TXs are hashed and signed over their canonical binary encoding
+	Type TxType `json:"type,omitempty"`
+	// Multisig is the config of the account registered by multisig register TXs since the TIP11 fork
+	Multisig *Multisig `json:"multisig,omitempty"`
+	// Lock holds the amount credited by locked transfer TXs since the TIP12 fork
+	Lock *TimeLock `json:"lock,omitempty"`
+	// Token is the user-issued token amount of token TXs since the TIP13 fork
+	Token *TokenAmount `json:"token,omitempty"`
 }
 
 type SignedTx struct {
 	Tx
 	Sig []byte `json:"signature"`
+	// Sigs are the signatures of the multisig signers approving a multisig spend TX
+	Sigs [][]byte `json:"signatures,omitempty"`
 }
 
 func NewTx(from, to common.Address, gas uint, gasPrice uint, value, nonce uint, data string) Tx {
-	return Tx{from, to, gas, gasPrice, value, nonce, data, uint64(time.Now().Unix())}
+	return Tx{from, to, gas, gasPrice, value, nonce, data, uint64(time.Now().Unix()), "", nil, TxTypeLegacy, nil, nil, nil}
+}
+
+// NewAmountTx creates a TX transferring an amount of the smallest unit, as required since the TIP9 fork.
+func NewAmountTx(from, to common.Address, gas uint, gasPrice uint, amount Amount, nonce uint, data string) Tx {
+	tx := NewTx(from, to, gas, gasPrice, 0, nonce, data)
+	tx.Amount = &amount
+
+	return tx
+}
+
+// NewTransferTx creates a typed transfer TX of an amount of the smallest unit, as required since the TIP10 fork.
+func NewTransferTx(from, to common.Address, gas uint, gasPrice uint, amount Amount, nonce uint, data string) Tx {
+	tx := NewAmountTx(from, to, gas, gasPrice, amount, nonce, data)
+	tx.Type = TxTypeTransfer
+
+	return tx
 }
 
 func NewBaseTx(from, to common.Address, value, nonce uint, data string) Tx {
@@ -54,13 +84,23 @@ func NewBaseTx(from, to common.Address, value, nonce uint, data string) Tx {
 }
 
 func NewSignedTx(tx Tx, sig []byte) SignedTx {
-	return SignedTx{tx, sig}
+	return SignedTx{Tx: tx, Sig: sig}
 }
 
 func (t Tx) IsReward() bool {
 	return t.Data == "reward"
 }
 
+// TransferredAmount is the Amount credited to the recipient since the TIP9 fork, or the Value before.
+func (t Tx) TransferredAmount() Amount {
+	if t.Amount != nil {
+		return *t.Amount
+	}
+
+	return NewAmount(uint64(t.Value))
+}
+
+// Cost is the TX value plus its gas cost, or plus the default flat TX fee before the TIP1 fork.
 func (t Tx) Cost(isTip1Fork bool) uint {
 	if isTip1Fork {
 		return t.Value + t.GasCost()
@@ -82,98 +122,56 @@ func (t Tx) Hash() (Hash, error) {
 	return sha256.Sum256(txJson), nil
 }
 
+// Encode returns the TX bytes signed and hashed: the canonical binary envelope of typed TXs, or the JSON of legacy TXs.
 func (t Tx) Encode() ([]byte, error) {
+	if t.Type != TxTypeLegacy {
+		return t.encodeCanonical()
+	}
+
 	return json.Marshal(t)
 }
 
-// MarshalJSON is the main source of truth for encoding a TX for hash calculation from expected attributes.
+// txEncoding is the TX JSON encoding, signed and hashed for legacy TXs.
 //
-// The logic is bit ugly and hacky but prevents infinite marshaling loops of embedded objects and allows
-// the structure to change with new TIPs.
-func (t Tx) MarshalJSON() ([]byte, error) {
-	// Prior TIP1
-	if t.Gas == 0 {
-		type legacyTx struct {
-			From  common.Address `json:"from"`
-			To    common.Address `json:"to"`
-			Value uint           `json:"value"`
-			Nonce uint           `json:"nonce"`
-			Data  string         `json:"data"`
-			Time  uint64         `json:"time"`
-		}
-		return json.Marshal(legacyTx{
-			From:  t.From,
-			To:    t.To,
-			Value: t.Value,
-			Nonce: t.Nonce,
-			Data:  t.Data,
-			Time:  t.Time,
-		})
-	}
-
-	type tip1Tx struct {
-		From     common.Address `json:"from"`
-		To       common.Address `json:"to"`
-		Gas      uint           `json:"gas"`
-		GasPrice uint           `json:"gasPrice"`
-		Value    uint           `json:"value"`
-		Nonce    uint           `json:"nonce"`
-		Data     string         `json:"data"`
-		Time     uint64         `json:"time"`
-	}
+// Fields introduced by forks are omitted while empty so TXs from before a fork keep their original encoding.
+// ValidateTx requires the fork fields to be populated exactly when the ChainConfig activates the fork.
+type txEncoding struct {
+	From     common.Address `json:"from"`
+	To       common.Address `json:"to"`
+	Gas      uint           `json:"gas,omitempty"`
+	GasPrice uint           `json:"gasPrice,omitempty"`
+	Value    uint           `json:"value"`
+	Nonce    uint           `json:"nonce"`
+	Data     string         `json:"data"`
+	Time     uint64         `json:"time"`
+	ChainID  string         `json:"chain_id,omitempty"`
+	Amount   *Amount        `json:"amount,omitempty"`
+	Type     TxType         `json:"type,omitempty"`
+	Multisig *Multisig      `json:"multisig,omitempty"`
+	Lock     *TimeLock      `json:"lock,omitempty"`
+	Token    *TokenAmount   `json:"token,omitempty"`
+}
 
-	return json.Marshal(tip1Tx{
-		From:     t.From,
-		To:       t.To,
-		Gas:      t.Gas,
-		GasPrice: t.GasPrice,
-		Value:    t.Value,
-		Nonce:    t.Nonce,
-		Data:     t.Data,
-		Time:     t.Time,
-	})
+type signedTxEncoding struct {
+	txEncoding
+	Sig  []byte   `json:"signature"`
+	Sigs [][]byte `json:"signatures,omitempty"`
 }
 
-// MarshalJSON is the main source of truth for encoding a TX for hash calculation (backwards compatible for TIPs).
+// MarshalJSON is the main source of truth for encoding a legacy TX for hash calculation from expected attributes.
 //
-// The logic is bit ugly and hacky but prevents infinite marshaling loops of embedded objects and allows
-// the structure to change with new TIPs.
-func (t SignedTx) MarshalJSON() ([]byte, error) {
-	// Prior TIP1
-	if t.Gas == 0 {
-		type legacyTx struct {
-			From  common.Address `json:"from"`
-			To    common.Address `json:"to"`
-			Value uint           `json:"value"`
-			Nonce uint           `json:"nonce"`
-			Data  string         `json:"data"`
-			Time  uint64         `json:"time"`
-			Sig   []byte         `json:"signature"`
-		}
-		return json.Marshal(legacyTx{
-			From:  t.From,
-			To:    t.To,
-			Value: t.Value,
-			Nonce: t.Nonce,
-			Data:  t.Data,
-			Time:  t.Time,
-			Sig:   t.Sig,
-		})
-	}
+// Encoding through a separate struct prevents infinite marshaling loops of embedded objects.
+func (t Tx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newTxEncoding(t))
+}
 
-	type tip1Tx struct {
-		From     common.Address `json:"from"`
-		To       common.Address `json:"to"`
-		Gas      uint           `json:"gas"`
-		GasPrice uint           `json:"gasPrice"`
-		Value    uint           `json:"value"`
-		Nonce    uint           `json:"nonce"`
-		Data     string         `json:"data"`
-		Time     uint64         `json:"time"`
-		Sig      []byte         `json:"signature"`
-	}
+// MarshalJSON is the main source of truth for encoding a legacy TX for hash calculation (backwards compatible for TIPs).
+func (t SignedTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(signedTxEncoding{newTxEncoding(t.Tx), t.Sig, t.Sigs})
+}
 
-	return json.Marshal(tip1Tx{
+func newTxEncoding(t Tx) txEncoding {
+	return txEncoding{
 		From:     t.From,
 		To:       t.To,
 		Gas:      t.Gas,
@@ -182,8 +180,13 @@ func (t SignedTx) MarshalJSON() ([]byte, error) {
 		Nonce:    t.Nonce,
 		Data:     t.Data,
 		Time:     t.Time,
-		Sig:      t.Sig,
-	})
+		ChainID:  t.ChainID,
+		Amount:   t.Amount,
+		Type:     t.Type,
+		Multisig: t.Multisig,
+		Lock:     t.Lock,
+		Token:    t.Token,
+	}
 }
 
 func (t SignedTx) Hash() (Hash, error) {
@@ -201,14 +204,42 @@ func (t SignedTx) IsAuthentic() (bool, error) {
 		return false, err
 	}
 
-	recoveredPubKey, err := crypto.SigToPub(txHash[:], t.Sig)
+	recoveredAccount, err := recoverSigner(txHash, t.Sig)
 	if err != nil {
 		return false, err
 	}
 
+	return recoveredAccount.Hex() == t.From.Hex(), nil
+}
+
+// Cosigners returns the accounts which signed the multisig spend TX, in their signatures order.
+func (t SignedTx) Cosigners() ([]common.Address, error) {
+	txHash, err := t.Tx.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	cosigners := make([]common.Address, 0, len(t.Sigs))
+	for _, sig := range t.Sigs {
+		cosigner, err := recoverSigner(txHash, sig)
+		if err != nil {
+			return nil, err
+		}
+
+		cosigners = append(cosigners, cosigner)
+	}
+
+	return cosigners, nil
+}
+
+func recoverSigner(txHash Hash, sig []byte) (common.Address, error) {
+	recoveredPubKey, err := crypto.SigToPub(txHash[:], sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+
 	recoveredPubKeyBytes := elliptic.Marshal(crypto.S256(), recoveredPubKey.X, recoveredPubKey.Y)
 	recoveredPubKeyBytesHash := crypto.Keccak256(recoveredPubKeyBytes[1:])
-	recoveredAccount := common.BytesToAddress(recoveredPubKeyBytesHash[12:])
 
-	return recoveredAccount.Hex() == t.From.Hex(), nil
+	return common.BytesToAddress(recoveredPubKeyBytesHash[12:]), nil
 }
@@ -0,0 +1,322 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TxType identifies the kind and the payload version of a typed TX. A new version of a TX kind gets a new type.
+//
+// Typed TXs are enveloped as the type byte followed by the payload in the canonical binary encoding,
+// which they are hashed and signed over since the TIP10 fork.
+type TxType uint8
+
+const (
+	// TxTypeLegacy TXs are hashed and signed over their JSON encoding, the only TXs before the TIP10 fork
+	TxTypeLegacy TxType = 0
+	// TxTypeTransfer TXs transfer an amount to the recipient
+	TxTypeTransfer TxType = 1
+	// TxTypeMultisigRegister TXs register the multisig account of their recipient address and fund it, since the TIP11 fork
+	TxTypeMultisigRegister TxType = 2
+	// TxTypeMultisigSpend TXs transfer from a multisig account, signed by enough of its signers, since the TIP11 fork
+	TxTypeMultisigSpend TxType = 3
+	// TxTypeLockedTransfer TXs transfer an amount the recipient can't spend before a height and/or a time, since the TIP12 fork
+	TxTypeLockedTransfer TxType = 4
+	// TxTypeTokenCreate TXs issue a user token with its supply credited to the sender, since the TIP13 fork
+	TxTypeTokenCreate TxType = 5
+	// TxTypeTokenTransfer TXs transfer an amount of a user token to the recipient, since the TIP13 fork
+	TxTypeTokenTransfer TxType = 6
+	// TxTypeTokenBurn TXs destroy an amount of a user token held by the sender, since the TIP13 fork
+	TxTypeTokenBurn TxType = 7
+)
+
+// maxCanonicalBytesLength bounds the length prefixed byte strings of a decoded TX, the block byte cap is way lower anyway.
+const maxCanonicalBytesLength = 16 * 1024 * 1024
+
+// DecodeTx decodes a typed TX from its canonical binary encoding, see Tx.Encode.
+//
+// Legacy TXs have no binary encoding, they are decoded from JSON.
+func DecodeTx(data []byte) (Tx, error) {
+	d := canonicalDecoder{r: bytes.NewReader(data)}
+
+	txType := TxType(d.readByte())
+
+	var tx Tx
+	switch txType {
+	case TxTypeTransfer, TxTypeMultisigSpend:
+		tx = d.readTransferPayload()
+	case TxTypeMultisigRegister:
+		tx = d.readTransferPayload()
+		tx.Multisig = d.readMultisig()
+	case TxTypeLockedTransfer:
+		tx = d.readTransferPayload()
+		tx.Lock = d.readTimeLock()
+	case TxTypeTokenCreate, TxTypeTokenTransfer, TxTypeTokenBurn:
+		tx = d.readTransferPayload()
+		tx.Token = d.readTokenAmount()
+	default:
+		return Tx{}, fmt.Errorf("unable to decode TX of unknown type %d", txType)
+	}
+
+	if d.err != nil {
+		return Tx{}, fmt.Errorf("unable to decode TX of type %d: %w", txType, d.err)
+	}
+
+	if d.r.Len() != 0 {
+		return Tx{}, fmt.Errorf("unable to decode TX of type %d: %d trailing bytes", txType, d.r.Len())
+	}
+
+	tx.Type = txType
+
+	return tx, nil
+}
+
+// encodeCanonical returns the TX envelope: the TX type byte followed by its payload.
+func (t Tx) encodeCanonical() ([]byte, error) {
+	e := canonicalEncoder{}
+	e.buf.WriteByte(byte(t.Type))
+
+	switch t.Type {
+	case TxTypeTransfer, TxTypeMultisigSpend:
+		e.writeTransferPayload(t)
+	case TxTypeMultisigRegister:
+		if t.Multisig == nil {
+			return nil, fmt.Errorf("unable to encode multisig register TX without multisig")
+		}
+
+		e.writeTransferPayload(t)
+		e.writeMultisig(*t.Multisig)
+	case TxTypeLockedTransfer:
+		if t.Lock == nil {
+			return nil, fmt.Errorf("unable to encode locked transfer TX without lock")
+		}
+
+		e.writeTransferPayload(t)
+		e.writeTimeLock(*t.Lock)
+	case TxTypeTokenCreate, TxTypeTokenTransfer, TxTypeTokenBurn:
+		if t.Token == nil {
+			return nil, fmt.Errorf("unable to encode token TX without token")
+		}
+
+		e.writeTransferPayload(t)
+		e.writeTokenAmount(*t.Token)
+	default:
+		return nil, fmt.Errorf("unable to encode TX of unknown type %d", t.Type)
+	}
+
+	return e.buf.Bytes(), nil
+}
+
+// canonicalEncoder writes the deterministic binary encoding of typed TXs.
+//
+// Integers are fixed-width big-endian, byte strings are prefixed with their uint32 length
+// and optional amounts with a presence byte.
+type canonicalEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *canonicalEncoder) writeUint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *canonicalEncoder) writeBytes(b []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(b)))
+	e.buf.Write(length[:])
+	e.buf.Write(b)
+}
+
+func (e *canonicalEncoder) writeAddress(a common.Address) {
+	e.buf.Write(a[:])
+}
+
+func (e *canonicalEncoder) writeAmount(a *Amount) {
+	if a == nil {
+		e.buf.WriteByte(0)
+		return
+	}
+
+	e.buf.WriteByte(1)
+	e.writeBytes(a.Bytes())
+}
+
+// writeTransferPayload writes the transfer TX v1 payload.
+func (e *canonicalEncoder) writeTransferPayload(t Tx) {
+	e.writeAddress(t.From)
+	e.writeAddress(t.To)
+	e.writeUint64(uint64(t.Gas))
+	e.writeUint64(uint64(t.GasPrice))
+	e.writeUint64(uint64(t.Value))
+	e.writeAmount(t.Amount)
+	e.writeUint64(uint64(t.Nonce))
+	e.writeBytes([]byte(t.Data))
+	e.writeUint64(t.Time)
+	e.writeBytes([]byte(t.ChainID))
+}
+
+func (e *canonicalEncoder) writeMultisig(m Multisig) {
+	e.writeUint64(uint64(m.Threshold))
+	e.writeUint64(uint64(len(m.Signers)))
+
+	for _, signer := range m.Signers {
+		e.writeAddress(signer)
+	}
+}
+
+func (e *canonicalEncoder) writeTimeLock(l TimeLock) {
+	e.writeUint64(l.UntilHeight)
+	e.writeUint64(l.UntilTime)
+}
+
+func (e *canonicalEncoder) writeTokenAmount(t TokenAmount) {
+	e.writeBytes([]byte(t.Symbol))
+	e.writeAmount(&t.Amount)
+}
+
+// canonicalDecoder reads the canonical binary encoding, the first error sticks and zero values are read past it.
+type canonicalDecoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *canonicalDecoder) read(n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+
+	if n > d.r.Len() {
+		d.err = fmt.Errorf("unexpected end of data")
+		return make([]byte, n)
+	}
+
+	b := make([]byte, n)
+	_, _ = d.r.Read(b)
+
+	return b
+}
+
+func (d *canonicalDecoder) readByte() byte {
+	return d.read(1)[0]
+}
+
+func (d *canonicalDecoder) readUint64() uint64 {
+	return binary.BigEndian.Uint64(d.read(8))
+}
+
+func (d *canonicalDecoder) readBytes() []byte {
+	length := binary.BigEndian.Uint32(d.read(4))
+	if length > maxCanonicalBytesLength {
+		if d.err == nil {
+			d.err = fmt.Errorf("byte string of %d bytes exceeds the %d bytes limit", length, maxCanonicalBytesLength)
+		}
+		return nil
+	}
+
+	return d.read(int(length))
+}
+
+func (d *canonicalDecoder) readAddress() common.Address {
+	return common.BytesToAddress(d.read(common.AddressLength))
+}
+
+func (d *canonicalDecoder) readAmount() *Amount {
+	switch d.readByte() {
+	case 0:
+		return nil
+	case 1:
+		b := d.readBytes()
+		if len(b) > 0 && b[0] == 0 && d.err == nil {
+			d.err = fmt.Errorf("amount with leading zero bytes isn't canonical")
+		}
+
+		amount, err := newCheckedAmount(new(big.Int).SetBytes(b))
+		if err != nil && d.err == nil {
+			d.err = err
+		}
+
+		return &amount
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("invalid amount presence byte")
+		}
+
+		return nil
+	}
+}
+
+func (d *canonicalDecoder) readTransferPayload() Tx {
+	return Tx{
+		From:     d.readAddress(),
+		To:       d.readAddress(),
+		Gas:      uint(d.readUint64()),
+		GasPrice: uint(d.readUint64()),
+		Value:    uint(d.readUint64()),
+		Amount:   d.readAmount(),
+		Nonce:    uint(d.readUint64()),
+		Data:     string(d.readBytes()),
+		Time:     d.readUint64(),
+		ChainID:  string(d.readBytes()),
+	}
+}
+
+func (d *canonicalDecoder) readMultisig() *Multisig {
+	multisig := Multisig{Threshold: uint(d.readUint64())}
+
+	count := d.readUint64()
+	if count > MaxMultisigSigners {
+		if d.err == nil {
+			d.err = fmt.Errorf("multisig of %d signers exceeds the %d signers limit", count, MaxMultisigSigners)
+		}
+		return &multisig
+	}
+
+	multisig.Signers = make([]common.Address, 0, count)
+	for i := uint64(0); i < count; i++ {
+		multisig.Signers = append(multisig.Signers, d.readAddress())
+	}
+
+	return &multisig
+}
+
+func (d *canonicalDecoder) readTimeLock() *TimeLock {
+	return &TimeLock{
+		UntilHeight: d.readUint64(),
+		UntilTime:   d.readUint64(),
+	}
+}
+
+func (d *canonicalDecoder) readTokenAmount() *TokenAmount {
+	token := TokenAmount{Symbol: string(d.readBytes())}
+
+	amount := d.readAmount()
+	if amount == nil {
+		if d.err == nil {
+			d.err = fmt.Errorf("token amount is required")
+		}
+		return &token
+	}
+	token.Amount = *amount
+
+	return &token
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// A legacy TX of the public TBB chain block 0, signed over its JSON encoding
+const legacyTxJson = `{"from":"0x09ee50f2f37fcba1845de6fe5c762e83e65e755c","to":"0x22ba1f80452e6220c7cc6ea2d1e3eeddac5f694a","value":5,"nonce":1,"data":"","time":1590684702,"signature":"0JE1yEoA3gwIiTj5ayanUZfo5ZnN7kHIRQPOw8/OZIRYWjbvbMA7vWdPgoqxnhFGiTH7FIbjCQJ25fQlvMvmPwA="}`
+
+func TestTx_LegacyJsonEncoding(t *testing.T) {
+	var tx SignedTx
+	err := json.Unmarshal([]byte(legacyTxJson), &tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx.Type != TxTypeLegacy {
+		t.Fatalf("TX without type should be legacy not type %d", tx.Type)
+	}
+
+	ok, err := tx.IsAuthentic()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Fatal("legacy TX signed over its JSON encoding should stay authentic")
+	}
+
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(txJson) != legacyTxJson {
+		t.Errorf("legacy TX JSON encoding should be unchanged, got %s", txJson)
+	}
+}
+
+func TestTx_CanonicalEncoding(t *testing.T) {
+	privKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	amount, err := ParseTBB("1.25")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := signTx(NewTransferTx(andrej, babaYaga, TxGas, TxGasPriceDefault, amount, 1, "bar tab"), testChainID, privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := tx.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if encoded[0] != byte(TxTypeTransfer) {
+		t.Fatalf("typed TX envelope should start with its type byte not %d", encoded[0])
+	}
+
+	decoded, err := DecodeTx(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reencoded, err := decoded.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(encoded, reencoded) || decoded.Amount.Cmp(amount) != 0 || decoded.Data != "bar tab" || decoded.ChainID != testChainID {
+		t.Fatalf("decoded TX should match the encoded TX, got %+v", decoded)
+	}
+
+	// The JSON stored in blocks keeps the type so the TX is still hashed over the canonical encoding
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var jsonTx SignedTx
+	err = json.Unmarshal(txJson, &jsonTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, signedTx := range map[string]SignedTx{"signed": tx, "JSON decoded": jsonTx} {
+		ok, err := signedTx.IsAuthentic()
+		if err != nil || !ok {
+			t.Errorf("%s typed TX should be authentic. %v", name, err)
+		}
+	}
+
+	tampered := tx
+	tamperedAmount := AmountFromTBB(100)
+	tampered.Amount = &tamperedAmount
+	if ok, _ := tampered.IsAuthentic(); ok {
+		t.Error("changing the amount of a typed TX should invalidate its signature")
+	}
+
+	for name, data := range map[string][]byte{
+		"unknown type":   append([]byte{0xff}, encoded[1:]...),
+		"truncated":      encoded[:len(encoded)-1],
+		"trailing bytes": append(append([]byte{}, encoded...), 0),
+	} {
+		if _, err := DecodeTx(data); err == nil {
+			t.Errorf("decoding a TX with %s should fail", name)
+		}
+	}
+}
+
+func TestValidateTx_Type(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := NewAccount(testBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	legacyTx, err := signTx(NewAmountTx(andrej, babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(1), 1, ""), testChainID, andrejKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateTx(legacyTx, state); err == nil {
+		t.Error("legacy TX should be rejected since TIP10")
+	}
+
+	unknownTx := NewTransferTx(andrej, babaYaga, TxGas, TxGasPriceDefault, AmountFromTBB(1), 1, "")
+	unknownTx.Type = 0xff
+	if err := ValidateTx(NewSignedTx(unknownTx, legacyTx.Sig), state); err == nil {
+		t.Error("TX of unknown type should be rejected")
+	}
+
+	if err := ValidateTx(signTestTx(t, andrejKey, andrej, babaYaga, 1, 1), state); err != nil {
+		t.Errorf("typed transfer TX should be valid: %s", err)
+	}
+}
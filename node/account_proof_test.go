@@ -0,0 +1,116 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/database"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Andrej mines 3 blocks sending TBB to BabaYaga, every header commits the state root and blocks 1 and 2 are snapshotted
+//   - BabaYaga's balance and nonce served by /account/{addr}/proof must verify against the latest and the snapshotted block state roots
+//   - Block 0 without a snapshot isn't proven, it would require replaying the chain
+//   - A tampered balance and an account without any TBB must be proven correctly too
+func TestAccountProof(t *testing.T) {
+	defaultSnapshotInterval := database.SnapshotInterval
+	database.SnapshotInterval = 1
+	defer func() { database.SnapshotInterval = defaultSnapshotInterval }()
+
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := database.NewAccount(testKsBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	n := New(dataDir, "127.0.0.1", 8085, andrej, PeerNode{}, nodeVersion, defaultTestMiningDifficulty)
+
+	state, err := database.NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+	n.state = state
+
+	blocks := make([]database.Block, 3)
+	for i := range blocks {
+		blocks[i] = mineTestBlock(t, state, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 10, uint(i+1)))
+		_, err = state.AddBlock(blocks[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requestProof := func(account common.Address, query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/account/"+account.Hex()+"/proof"+query, nil)
+		accountHandler(rr, req, n)
+
+		return rr
+	}
+
+	getProof := func(account common.Address, query string) database.AccountProof {
+		rr := requestProof(account, query)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d %s", rr.Code, rr.Body.String())
+		}
+
+		var proof database.AccountProof
+		err := json.NewDecoder(rr.Body).Decode(&proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return proof
+	}
+
+	latestProof := getProof(babaYaga, "")
+	if latestProof.Balance.Cmp(database.AmountFromTBB(30)) != 0 || latestProof.StateRoot != *blocks[2].Header.StateRoot {
+		t.Errorf("latest proof should prove balance 30 TBB against block 2 state root, got balance %s", latestProof.Balance)
+	}
+
+	block1Proof := getProof(babaYaga, "?block=1")
+	if block1Proof.Balance.Cmp(database.AmountFromTBB(20)) != 0 || block1Proof.StateRoot != *blocks[1].Header.StateRoot {
+		t.Errorf("block 1 proof should prove balance 20 TBB against block 1 state root, got balance %s", block1Proof.Balance)
+	}
+
+	if rr := requestProof(babaYaga, "?block=0"); rr.Code == http.StatusOK {
+		t.Errorf("block 0 without a snapshot should not be proven")
+	}
+
+	for _, proof := range []database.AccountProof{latestProof, block1Proof, getProof(andrej, ""), getProof(common.Address{}, "")} {
+		if !database.VerifyAccountProof(proof) {
+			t.Errorf("proof of %s at block %d should be valid", proof.Account.Hex(), proof.BlockNumber)
+		}
+	}
+
+	latestProof.Balance, _ = latestProof.Balance.Add(database.NewAmount(1))
+	if database.VerifyAccountProof(latestProof) {
+		t.Errorf("proof of a tampered balance must not verify")
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/database"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Andrej sends TBB to BabaYaga in blocks 0 and 1, BabaYaga sends some back in block 2 mined by her
+//   - BabaYaga's TXs are listed newest first across 2 pages: her miner reward, her TX out, and 2 TXs in
+//   - The listing is the same once the index is rebuilt from the blocks
+func TestAccountTxs(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babaYagaKey, _, babaYaga, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	n := New(dataDir, "127.0.0.1", 8085, andrej, PeerNode{}, nodeVersion, defaultTestMiningDifficulty)
+
+	state, err := database.NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.state = state
+
+	block0 := mineTestBlock(t, state, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 10, 1))
+	if _, err := state.AddBlock(block0); err != nil {
+		t.Fatal(err)
+	}
+
+	block1 := mineTestBlock(t, state, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 20, 2))
+	if _, err := state.AddBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+
+	block2 := mineTestBlock(t, state, babaYaga, signTestTx(t, babaYagaKey, babaYaga, andrej, 5, 1))
+	if _, err := state.AddBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+
+	getPage := func(query string) database.AccountTxsPage {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/account/"+babaYaga.Hex()+"/txs"+query, nil)
+		accountHandler(rr, req, n)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d %s", rr.Code, rr.Body.String())
+		}
+
+		var page database.AccountTxsPage
+		err := json.NewDecoder(rr.Body).Decode(&page)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return page
+	}
+
+	assertListing := func() {
+		firstPage := getPage("?limit=2")
+		if len(firstPage.TXs) != 2 || firstPage.NextCursor == "" {
+			t.Fatalf("first page should have 2 TXs and a next cursor, got %d TXs and cursor '%s'", len(firstPage.TXs), firstPage.NextCursor)
+		}
+
+		secondPage := getPage("?limit=2&cursor=" + firstPage.NextCursor)
+		if len(secondPage.TXs) != 2 || secondPage.NextCursor != "" {
+			t.Fatalf("second page should have 2 TXs and no next cursor, got %d TXs and cursor '%s'", len(secondPage.TXs), secondPage.NextCursor)
+		}
+
+		expected := []struct {
+			txType string
+			height uint64
+			value  uint
+		}{
+			{database.AccountTxMinerReward, 2, 0},
+			{database.AccountTxOut, 2, 5},
+			{database.AccountTxIn, 1, 20},
+			{database.AccountTxIn, 0, 10},
+		}
+
+		for i, accountTx := range append(firstPage.TXs, secondPage.TXs...) {
+			if accountTx.Type != expected[i].txType || accountTx.BlockHeight != expected[i].height {
+				t.Errorf("TX %d should be %s at height %d, got %s at %d", i, expected[i].txType, expected[i].height, accountTx.Type, accountTx.BlockHeight)
+				continue
+			}
+
+			if accountTx.Type == database.AccountTxMinerReward {
+				expectedReward := database.AmountFromTBB(database.BlockReward + database.TxGas*database.TxGasPriceDefault)
+				if accountTx.Reward == nil || accountTx.Reward.Cmp(expectedReward) != 0 {
+					t.Errorf("miner reward should include the TX fee, got %v", accountTx.Reward)
+				}
+				continue
+			}
+
+			if accountTx.Tx == nil || accountTx.Tx.TransferredAmount().Cmp(database.AmountFromTBB(uint64(expected[i].value))) != 0 {
+				t.Errorf("TX %d should transfer %d TBB", i, expected[i].value)
+			}
+		}
+	}
+
+	assertListing()
+	_ = state.Close()
+
+	err = database.RebuildChainIndex(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.state, err = database.NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.state.Close()
+
+	assertListing()
+}
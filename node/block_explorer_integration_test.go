@@ -3,14 +3,26 @@ package node
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/web3coach/the-blockchain-bar/database"
+	"github.com/web3coach/the-blockchain-bar/fs"
 )
 
 func TestBlockExplorer(t *testing.T) {
+	for _, blockStore := range []string{database.BlockStoreFile, database.BlockStoreLevelDB} {
+		t.Run(blockStore, func(t *testing.T) {
+			testBlockExplorer(t, blockStore)
+		})
+	}
+}
+
+func testBlockExplorer(t *testing.T, blockStore string) {
 
 	tc := []struct {
 		arg  string
@@ -22,7 +34,16 @@ func TestBlockExplorer(t *testing.T) {
 		{"000000244ab3ada6479fd06f0eb81b3b97051859191380758cc546bfe2074759", 2},
 		{"99", 99}, // this must return http.Status != 200
 	}
-	datadir := "test_block_explorer_db"
+	datadir, err := copyTestDataDir("test_block_explorer_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(datadir)
+
+	err = database.MigrateBlockStore(datadir, blockStore)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	n := New(datadir, "127.0.0.1", 8085, database.NewAccount(DefaultMiner), PeerNode{}, nodeVersion, 3)
 
@@ -71,3 +92,40 @@ func TestBlockExplorer(t *testing.T) {
 		}
 	}
 }
+
+// copyTestDataDir copies a commited testing data dir into a new temporary dir so tests can freely modify it
+//
+// Remember to remove the dir once test finishes: defer fs.RemoveDir(dataDir)
+func copyTestDataDir(srcDir string) (string, error) {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		return "", err
+	}
+
+	err = filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dataDir, relPath), 0777)
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(filepath.Join(dataDir, relPath), content, 0600)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return dataDir, nil
+}
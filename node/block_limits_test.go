@@ -0,0 +1,93 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package node
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/database"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - The genesis block gas limit fits 3 TXs
+//   - The block template picks the first 3 of 5 TXs and the mined block is valid
+func TestSelectBlockTXs_BlockLimits(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := database.NewAccount(testKsBabaYagaAccount)
+
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	forks := make(map[database.Fork]uint64)
+	for _, fork := range database.KnownForks {
+		forks[fork] = 0
+	}
+
+	txs := make([]database.SignedTx, 0)
+	for nonce := uint(1); nonce <= 5; nonce++ {
+		txs = append(txs, signTestTx(t, andrejKey, andrej, babaYaga, 1, nonce))
+	}
+
+	txSize, err := database.TxSize(txs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = database.InitGenesis(dataDir, database.Genesis{
+		ChainID:          testChainID,
+		Balances:         map[common.Address]uint{andrej: 1000},
+		MiningDifficulty: database.GenesisParam(defaultTestMiningDifficulty),
+		BlockGasLimit:    3 * database.TxGas,
+		BlockMaxBytes:    4 * txSize,
+		Forks:            forks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := database.NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	blockTXs, err := selectBlockTXs(state, txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blockTXs) != 3 {
+		t.Fatalf("block template should pick 3 TXs not %d", len(blockTXs))
+	}
+
+	for i, tx := range blockTXs {
+		if tx.Nonce != uint(i+1) {
+			t.Fatalf("block template TX %d should have nonce %d not %d", i, i+1, tx.Nonce)
+		}
+	}
+
+	if _, err := state.AddBlock(mineTestBlock(t, state, andrej, blockTXs...)); err != nil {
+		t.Fatalf("block fitting the limits should be valid: %s", err)
+	}
+}
@@ -18,6 +18,7 @@ package node
 import (
 	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
 	"strconv"
 	"strings"
@@ -32,8 +33,16 @@ type ErrRes struct {
 }
 
 type BalancesRes struct {
-	Hash     database.Hash           `json:"block_hash"`
-	Balances map[common.Address]uint `json:"balances"`
+	Hash     database.Hash                      `json:"block_hash"`
+	Balances map[common.Address]database.Amount `json:"balances"`
+	// BalancesTBB are the balances formatted in decimal TBB, e.g. "1.5"
+	BalancesTBB map[common.Address]string `json:"balances_tbb"`
+	// Locked is the part of the balances held by time locks, Spendable the rest
+	Locked       map[common.Address]database.Amount `json:"locked"`
+	LockedTBB    map[common.Address]string          `json:"locked_tbb"`
+	Spendable    map[common.Address]database.Amount `json:"spendable"`
+	SpendableTBB map[common.Address]string          `json:"spendable_tbb"`
+	Symbol       string                             `json:"symbol"`
 }
 
 type TxAddReq struct {
@@ -43,7 +52,38 @@ type TxAddReq struct {
 	Gas      uint   `json:"gas"`
 	GasPrice uint   `json:"gasPrice"`
 	Value    uint   `json:"value"`
-	Data     string `json:"data"`
+	// Amount is the decimal TBB amount to transfer since the TIP9 fork, e.g. "1.5". It defaults to the whole TBB Value.
+	Amount string `json:"amount"`
+	Data   string `json:"data"`
+	// Multisig registers a multisig account funded with the amount since the TIP11 fork, its address replaces 'to'
+	Multisig *database.Multisig `json:"multisig,omitempty"`
+	// Lock locks the amount credited to 'to' until a height and/or a time since the TIP12 fork
+	Lock *database.TimeLock `json:"lock,omitempty"`
+	// Token creates, transfers or burns a user-issued token since the TIP13 fork, instead of transferring TBB
+	Token *TokenTxReq `json:"token,omitempty"`
+}
+
+const TokenOpCreate = "create"
+const TokenOpTransfer = "transfer"
+const TokenOpBurn = "burn"
+
+type TokenTxReq struct {
+	// Op is one of "create", "transfer" or "burn"
+	Op     string `json:"op"`
+	Symbol string `json:"symbol"`
+	// Amount is the integer amount of the token, the supply of created tokens
+	Amount string `json:"amount"`
+}
+
+type TokensRes struct {
+	Hash   database.Hash    `json:"block_hash"`
+	Tokens []database.Token `json:"tokens"`
+}
+
+type TokenBalancesRes struct {
+	Hash     database.Hash                      `json:"block_hash"`
+	Token    database.Token                     `json:"token"`
+	Balances map[common.Address]database.Amount `json:"balances"`
 }
 
 type TxAddRes struct {
@@ -53,12 +93,25 @@ type TxAddRes struct {
 type StatusRes struct {
 	Hash        database.Hash       `json:"block_hash"`
 	Number      uint64              `json:"block_number"`
+	TotalWork   *big.Int            `json:"total_work"`
 	KnownPeers  map[string]PeerNode `json:"peers_known"`
 	PendingTXs  []database.SignedTx `json:"pending_txs"`
 	NodeVersion string              `json:"node_version"`
 	Account     common.Address      `json:"account"`
 }
 
+const TxStatusPending = "pending"
+const TxStatusMined = "mined"
+const TxStatusUnknown = "unknown"
+
+type TxRes struct {
+	Tx            *database.SignedTx `json:"tx,omitempty"`
+	Status        string             `json:"status"`
+	BlockHash     *database.Hash     `json:"block_hash,omitempty"`
+	BlockHeight   *uint64            `json:"block_height,omitempty"`
+	Confirmations uint64             `json:"confirmations"`
+}
+
 type SyncRes struct {
 	Blocks []database.Block `json:"blocks"`
 }
@@ -71,7 +124,32 @@ type AddPeerRes struct {
 func listBalancesHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
 	enableCors(&w)
 
-	writeRes(w, BalancesRes{state.LatestBlockHash(), state.Balances})
+	res := BalancesRes{
+		Hash:         state.LatestBlockHash(),
+		Balances:     state.Balances,
+		BalancesTBB:  make(map[common.Address]string),
+		Locked:       make(map[common.Address]database.Amount),
+		LockedTBB:    make(map[common.Address]string),
+		Spendable:    make(map[common.Address]database.Amount),
+		SpendableTBB: make(map[common.Address]string),
+		Symbol:       state.Genesis().Symbol,
+	}
+
+	for account, balance := range state.Balances {
+		res.BalancesTBB[account] = state.FormatAmount(balance)
+
+		spendable := state.SpendableBalance(account)
+		res.Spendable[account] = spendable
+		res.SpendableTBB[account] = state.FormatAmount(spendable)
+
+		locked := state.LockedBalance(account)
+		if !locked.IsZero() {
+			res.Locked[account] = locked
+			res.LockedTBB[account] = state.FormatAmount(locked)
+		}
+	}
+
+	writeRes(w, res)
 }
 
 func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
@@ -97,7 +175,57 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	nonce := node.state.GetNextAccountNonce(from)
 	tx := database.NewTx(from, database.NewAccount(req.To), req.Gas, req.GasPrice, req.Value, nonce, req.Data)
 
-	signedTx, err := wallet.SignTxWithKeystoreAccount(tx, from, req.FromPwd, wallet.GetKeystoreDirPath(node.dataDir))
+	if node.state.IsForkActive(database.ForkTIP9) {
+		amount := database.AmountFromTBB(uint64(req.Value))
+		if req.Amount != "" {
+			amount, err = database.ParseTBB(req.Amount)
+			if err != nil {
+				writeErrRes(w, err)
+				return
+			}
+		}
+
+		tx = database.NewAmountTx(from, database.NewAccount(req.To), req.Gas, req.GasPrice, amount, nonce, req.Data)
+	} else if req.Amount != "" {
+		writeErrRes(w, fmt.Errorf("'amount' requires the TIP9 fork to be active, use the whole TBB 'value' instead"))
+		return
+	}
+
+	if node.state.IsForkActive(database.ForkTIP10) {
+		tx.Type = database.TxTypeTransfer
+	}
+
+	if req.Multisig != nil {
+		multisig := database.NewMultisig(req.Multisig.Threshold, req.Multisig.Signers)
+		tx.To = multisig.Address()
+		tx.Type = database.TxTypeMultisigRegister
+		tx.Multisig = &multisig
+	}
+
+	if req.Lock != nil {
+		if req.Multisig != nil {
+			writeErrRes(w, fmt.Errorf("a TX can't both register a 'multisig' account and 'lock' the amount"))
+			return
+		}
+
+		tx.Type = database.TxTypeLockedTransfer
+		tx.Lock = req.Lock
+	}
+
+	if req.Token != nil {
+		if req.Multisig != nil || req.Lock != nil {
+			writeErrRes(w, fmt.Errorf("a 'token' TX can't register a 'multisig' account or 'lock' an amount"))
+			return
+		}
+
+		tx, err = newTokenTx(*req.Token, tx)
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+	}
+
+	signedTx, err := wallet.SignTxWithKeystoreAccount(tx, node.state.TxChainID(), from, req.FromPwd, wallet.GetKeystoreDirPath(node.dataDir))
 	if err != nil {
 		writeErrRes(w, err)
 		return
@@ -112,12 +240,50 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	writeRes(w, TxAddRes{Success: true})
 }
 
+// newTokenTx turns the TX into the token TX of the request, it pays the same gas.
+func newTokenTx(req TokenTxReq, tx database.Tx) (database.Tx, error) {
+	amount, err := database.ParseAmount(req.Amount)
+	if err != nil {
+		return database.Tx{}, fmt.Errorf("invalid token amount '%s': %s", req.Amount, err)
+	}
+
+	switch req.Op {
+	case TokenOpCreate:
+		return database.NewTokenCreateTx(tx.From, tx.Gas, tx.GasPrice, req.Symbol, amount, tx.Nonce, tx.Data), nil
+	case TokenOpTransfer:
+		return database.NewTokenTransferTx(tx.From, tx.To, tx.Gas, tx.GasPrice, req.Symbol, amount, tx.Nonce, tx.Data), nil
+	case TokenOpBurn:
+		return database.NewTokenBurnTx(tx.From, tx.Gas, tx.GasPrice, req.Symbol, amount, tx.Nonce, tx.Data), nil
+	default:
+		return database.Tx{}, fmt.Errorf("unknown token op '%s'. Expected: %s, %s or %s", req.Op, TokenOpCreate, TokenOpTransfer, TokenOpBurn)
+	}
+}
+
+// txSubmitHandler adds a TX signed outside of the node, e.g. a multisig spend TX co-signed by its signers.
+func txSubmitHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	tx := database.SignedTx{}
+	err := readReq(r, &tx)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	err = node.AddPendingTX(tx, node.info)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, TxAddRes{Success: true})
+}
+
 func statusHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	enableCors(&w)
 
 	res := StatusRes{
 		Hash:        node.state.LatestBlockHash(),
 		Number:      node.state.LatestBlock().Header.Number,
+		TotalWork:   node.state.TotalWork(),
 		KnownPeers:  node.knownPeers,
 		PendingTXs:  node.getPendingTXsAsArray(),
 		NodeVersion: node.nodeVersion,
@@ -137,7 +303,7 @@ func syncHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 		return
 	}
 
-	blocks, err := database.GetBlocksAfter(hash, node.dataDir)
+	blocks, err := database.GetBlocksAfter(node.state, hash)
 	if err != nil {
 		writeErrRes(w, err)
 		return
@@ -189,7 +355,7 @@ func blockByNumberOrHash(w http.ResponseWriter, r *http.Request, node *Node) {
 		hsh = p
 	}
 
-	block, err := database.GetBlockByHeightOrHash(node.state, height, hsh, node.dataDir)
+	block, err := database.GetBlockByHeightOrHash(node.state, height, hsh)
 	if err != nil {
 		writeErrRes(w, err)
 		return
@@ -198,8 +364,163 @@ func blockByNumberOrHash(w http.ResponseWriter, r *http.Request, node *Node) {
 	writeRes(w, block)
 }
 
+// txHandler serves /tx/{hash} with the TX status and /tx/{hash}/proof with the Merkle branch proving the TX was mined.
+func txHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	enableCors(&w)
+
+	params := strings.Split(strings.TrimPrefix(r.URL.Path, endpointTx), "/")
+	if len(params) > 2 || (len(params) == 2 && params[1] != endpointTxProof) {
+		writeErrRes(w, fmt.Errorf("unknown endpoint '%s'. Expected: %s{hash} or %s{hash}/%s", r.URL.Path, endpointTx, endpointTx, endpointTxProof))
+		return
+	}
+
+	txHash := database.Hash{}
+	err := txHash.UnmarshalText([]byte(strings.TrimSpace(params[0])))
+	if err != nil {
+		writeErrRes(w, fmt.Errorf("invalid TX hash: '%s'", params[0]))
+		return
+	}
+
+	if len(params) == 2 {
+		txProofHandler(w, txHash, node)
+		return
+	}
+
+	if tx, isPending := node.pendingTXs.get(txHash); isPending {
+		writeRes(w, TxRes{Tx: &tx, Status: TxStatusPending})
+		return
+	}
+
+	minedTx, isMined, err := database.GetMinedTx(node.state, txHash)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	if !isMined {
+		writeRes(w, TxRes{Status: TxStatusUnknown})
+		return
+	}
+
+	writeRes(w, TxRes{
+		Tx:            &minedTx.Tx,
+		Status:        TxStatusMined,
+		BlockHash:     &minedTx.BlockHash,
+		BlockHeight:   &minedTx.BlockHeight,
+		Confirmations: node.state.LatestBlock().Header.Number - minedTx.BlockHeight + 1,
+	})
+}
+
+func txProofHandler(w http.ResponseWriter, txHash database.Hash, node *Node) {
+	proof, err := database.GetTxProof(node.state, txHash)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, proof)
+}
+
+// accountHandler serves /account/{addr}/proof and /account/{addr}/txs.
+func accountHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	enableCors(&w)
+
+	params := strings.Split(strings.TrimPrefix(r.URL.Path, endpointAccount), "/")
+	if len(params) != 2 || (params[1] != endpointAccountProof && params[1] != endpointAccountTxs) {
+		writeErrRes(w, fmt.Errorf("unknown endpoint '%s'. Expected: %s{address}/%s or %s{address}/%s", r.URL.Path, endpointAccount, endpointAccountProof, endpointAccount, endpointAccountTxs))
+		return
+	}
+
+	if !common.IsHexAddress(params[0]) {
+		writeErrRes(w, fmt.Errorf("invalid account address: '%s'", params[0]))
+		return
+	}
+	account := database.NewAccount(params[0])
+
+	if params[1] == endpointAccountTxs {
+		accountTxsHandler(w, r, account, node)
+		return
+	}
+
+	accountProofHandler(w, r, account, node)
+}
+
+// accountProofHandler serves /account/{addr}/proof?block={height or hash} with the account balance and nonce
+// proven against the block state root. Defaults to the latest block, older blocks are proven at the snapshot heights.
+func accountProofHandler(w http.ResponseWriter, r *http.Request, account common.Address, node *Node) {
+	block := strings.TrimSpace(r.URL.Query().Get(endpointAccountProofQueryKeyBlock))
+	if block == "" {
+		block = fmt.Sprintf("%d", node.state.LatestBlock().Header.Number)
+	}
+
+	hsh := ""
+	height, err := strconv.ParseUint(block, 10, 64)
+	if err != nil {
+		hsh = block
+	}
+
+	proof, err := database.GetAccountProof(node.state, account, height, hsh)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, proof)
+}
+
+// accountTxsHandler serves /account/{addr}/txs?cursor=&limit= with the TXs sent and received by the account
+// and its miner rewards, newest first.
+func accountTxsHandler(w http.ResponseWriter, r *http.Request, account common.Address, node *Node) {
+	limit := accountTxsDefaultLimit
+
+	limitRaw := strings.TrimSpace(r.URL.Query().Get(endpointAccountTxsQueryKeyLimit))
+	if limitRaw != "" {
+		parsedLimit, err := strconv.ParseUint(limitRaw, 10, 32)
+		if err != nil || parsedLimit == 0 || parsedLimit > accountTxsMaxLimit {
+			writeErrRes(w, fmt.Errorf("invalid limit '%s'. Must be between 1 and %d", limitRaw, accountTxsMaxLimit))
+			return
+		}
+		limit = int(parsedLimit)
+	}
+
+	cursor := strings.TrimSpace(r.URL.Query().Get(endpointAccountTxsQueryKeyCursor))
+
+	page, err := database.GetAccountTxs(node.state, account, cursor, limit)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, page)
+}
+
 func mempoolViewer(w http.ResponseWriter, r *http.Request, txs map[string]database.SignedTx) {
 	enableCors(&w)
 
 	writeRes(w, txs)
 }
+
+func listTokensHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	enableCors(&w)
+
+	writeRes(w, TokensRes{state.LatestBlockHash(), state.Tokens()})
+}
+
+// tokenHandler serves /token/{symbol}/balances with the token holders balances.
+func tokenHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	enableCors(&w)
+
+	params := strings.Split(strings.TrimPrefix(r.URL.Path, endpointToken), "/")
+	if len(params) != 2 || params[1] != endpointTokenBalances {
+		writeErrRes(w, fmt.Errorf("unknown endpoint '%s'. Expected: %s{symbol}/%s", r.URL.Path, endpointToken, endpointTokenBalances))
+		return
+	}
+
+	token, ok := state.Token(params[0])
+	if !ok {
+		writeErrRes(w, fmt.Errorf("unknown token '%s'", params[0]))
+		return
+	}
+
+	writeRes(w, TokenBalancesRes{state.LatestBlockHash(), token, state.TokenBalances(token.Symbol)})
+}
@@ -0,0 +1,523 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package node
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/database"
+)
+
+// txPool holds the pending TXs waiting to be mined, by their hash.
+//
+// TXs with a nonce gap after their sender pending TXs wait in a queue until the missing TXs arrive.
+// The pool is shared by the HTTP handlers, the sync and the miner so it's safe for concurrent use.
+type txPool struct {
+	mu     sync.RWMutex
+	txs    map[string]pooledTx
+	queued map[string]pooledTx
+
+	// maxSize caps the number of pending TXs, the lowest paying TX is evicted for a better paying one
+	maxSize int
+	// ttl is how long a TX can stay pending before it expires
+	ttl time.Duration
+	// maxQueuedPerSender caps the number of future nonce TXs of a single sender
+	maxQueuedPerSender int
+	now                func() time.Time
+}
+
+type pooledTx struct {
+	tx      database.SignedTx
+	addedAt time.Time
+}
+
+func newTxPool(maxSize int, ttl time.Duration) *txPool {
+	return &txPool{
+		txs:                make(map[string]pooledTx),
+		queued:             make(map[string]pooledTx),
+		maxSize:            maxSize,
+		ttl:                ttl,
+		maxQueuedPerSender: DefaultMempoolQueuePerSender,
+		now:                time.Now,
+	}
+}
+
+// add returns false if the TX is already pending.
+func (p *txPool) add(txHash database.Hash, tx database.SignedTx) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.txs[txHash.Hex()]; exists {
+		return false
+	}
+
+	p.txs[txHash.Hex()] = pooledTx{tx, p.now()}
+
+	return true
+}
+
+// get returns the pending, or queued, TX.
+func (p *txPool) get(txHash database.Hash) (database.SignedTx, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if pooled, exists := p.txs[txHash.Hex()]; exists {
+		return pooled.tx, true
+	}
+
+	pooled, exists := p.queued[txHash.Hex()]
+
+	return pooled.tx, exists
+}
+
+// remove returns false if the TX wasn't pending nor queued.
+func (p *txPool) remove(txHash database.Hash) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, isPending := p.txs[txHash.Hex()]
+	_, isQueued := p.queued[txHash.Hex()]
+
+	delete(p.txs, txHash.Hex())
+	delete(p.queued, txHash.Hex())
+
+	return isPending || isQueued
+}
+
+// queue holds a TX with a future nonce until its sender missing TXs arrive.
+func (p *txPool) queue(txHash database.Hash, tx database.SignedTx) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	senderQueued := 0
+	for _, pooled := range p.queued {
+		if pooled.tx.From != tx.From {
+			continue
+		}
+
+		if pooled.tx.Nonce == tx.Nonce {
+			return fmt.Errorf("TX with nonce '%d' is already queued", tx.Nonce)
+		}
+		senderQueued++
+	}
+
+	if p.maxQueuedPerSender > 0 && senderQueued >= p.maxQueuedPerSender {
+		return fmt.Errorf("sender '%s' has %d queued TXs already, the max is %d", tx.From.String(), senderQueued, p.maxQueuedPerSender)
+	}
+
+	p.queued[txHash.Hex()] = pooledTx{tx, p.now()}
+
+	return nil
+}
+
+// queuedLen returns the number of TXs waiting for their sender missing nonces.
+func (p *txPool) queuedLen() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return len(p.queued)
+}
+
+// queuedSenders returns the senders with queued TXs.
+func (p *txPool) queuedSenders() []common.Address {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	senders := make(map[common.Address]bool)
+	for _, pooled := range p.queued {
+		senders[pooled.tx.From] = true
+	}
+
+	list := make([]common.Address, 0, len(senders))
+	for sender := range senders {
+		list = append(list, sender)
+	}
+
+	return list
+}
+
+// takeQueued removes and returns the queued sender TX with the given nonce.
+// The sender queued TXs with a lower nonce can no longer be mined and are dropped.
+func (p *txPool) takeQueued(sender common.Address, nonce uint) (database.Hash, database.SignedTx, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var found pooledTx
+	var foundHash string
+	for txHash, pooled := range p.queued {
+		if pooled.tx.From != sender || pooled.tx.Nonce > nonce {
+			continue
+		}
+
+		delete(p.queued, txHash)
+		if pooled.tx.Nonce == nonce {
+			found = pooled
+			foundHash = txHash
+		}
+	}
+
+	if foundHash == "" {
+		return database.Hash{}, database.SignedTx{}, false
+	}
+
+	txHash, err := found.tx.Hash()
+	if err != nil {
+		return database.Hash{}, database.SignedTx{}, false
+	}
+
+	return txHash, found.tx, true
+}
+
+func (p *txPool) len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return len(p.txs)
+}
+
+func (p *txPool) isFull() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.maxSize > 0 && len(p.txs) >= p.maxSize
+}
+
+// asMap returns a copy of the pending TXs by their hash.
+func (p *txPool) asMap() map[string]database.SignedTx {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	txs := make(map[string]database.SignedTx, len(p.txs))
+	for txHash, pooled := range p.txs {
+		txs[txHash] = pooled.tx
+	}
+
+	return txs
+}
+
+func (p *txPool) list() []database.SignedTx {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	txs := make([]database.SignedTx, 0, len(p.txs))
+	for _, pooled := range p.txs {
+		txs = append(txs, pooled.tx)
+	}
+
+	return txs
+}
+
+// all returns the pending and the queued TXs.
+func (p *txPool) all() []database.SignedTx {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	txs := make([]database.SignedTx, 0, len(p.txs)+len(p.queued))
+	for _, pooled := range p.txs {
+		txs = append(txs, pooled.tx)
+	}
+	for _, pooled := range p.queued {
+		txs = append(txs, pooled.tx)
+	}
+
+	return txs
+}
+
+// findByNonce returns the pending TX of the sender with the given nonce.
+func (p *txPool) findByNonce(sender common.Address, nonce uint) (database.Hash, database.SignedTx, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, pooled := range p.txs {
+		if pooled.tx.From == sender && pooled.tx.Nonce == nonce {
+			txHash, err := pooled.tx.Hash()
+			if err != nil {
+				continue
+			}
+
+			return txHash, pooled.tx, true
+		}
+	}
+
+	return database.Hash{}, database.SignedTx{}, false
+}
+
+// expire removes and returns the TXs pending, or queued, for longer than the pool TTL.
+func (p *txPool) expire() []database.SignedTx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	expired := make([]database.SignedTx, 0)
+	if p.ttl <= 0 {
+		return expired
+	}
+
+	for _, txs := range []map[string]pooledTx{p.txs, p.queued} {
+		for txHash, pooled := range txs {
+			if p.now().Sub(pooled.addedAt) > p.ttl {
+				expired = append(expired, pooled.tx)
+				delete(txs, txHash)
+			}
+		}
+	}
+
+	return expired
+}
+
+// evictionCandidate returns the lowest paying TX among the senders latest TXs, evicting an earlier nonce
+// would leave the sender next TXs unmineable. The TXs of the excluded sender are never candidates.
+func (p *txPool) evictionCandidate(state *database.State, exclude common.Address) (database.Hash, database.SignedTx, bool) {
+	latest := make(map[common.Address]database.SignedTx)
+	for _, tx := range p.list() {
+		if tx.From == exclude {
+			continue
+		}
+
+		if current, ok := latest[tx.From]; !ok || tx.Nonce > current.Nonce {
+			latest[tx.From] = tx
+		}
+	}
+
+	config := state.ChainConfig()
+	height := state.NextBlockNumber()
+
+	var cheapest database.SignedTx
+	found := false
+	for _, tx := range latest {
+		if !found || comparePrice(config, height, tx, cheapest) < 0 {
+			cheapest = tx
+			found = true
+		}
+	}
+
+	if !found {
+		return database.Hash{}, database.SignedTx{}, false
+	}
+
+	txHash, err := cheapest.Hash()
+	if err != nil {
+		return database.Hash{}, database.SignedTx{}, false
+	}
+
+	return txHash, cheapest, true
+}
+
+// byPrice returns the pending TXs mineable on top of the state, the highest fee per gas first.
+func (p *txPool) byPrice(state *database.State) []database.SignedTx {
+	txs := p.list()
+	ordered := make([]database.SignedTx, 0, len(txs))
+
+	candidates := newTxsByPrice(state, txs)
+	for tx, ok := candidates.peek(); ok; tx, ok = candidates.peek() {
+		ordered = append(ordered, tx)
+		candidates.shift()
+	}
+
+	return ordered
+}
+
+// txsByPrice yields TXs paying the highest fee per gas first while keeping each sender TXs in nonce order.
+//
+// Only the sender TXs continuing from its next state nonce are yielded, a TX after a nonce gap can't be mined yet.
+type txsByPrice struct {
+	heads    *priceHeap
+	bySender map[common.Address][]database.SignedTx
+}
+
+func newTxsByPrice(state *database.State, txs []database.SignedTx) *txsByPrice {
+	bySender := make(map[common.Address][]database.SignedTx)
+	for _, tx := range txs {
+		bySender[tx.From] = append(bySender[tx.From], tx)
+	}
+
+	heads := &priceHeap{config: state.ChainConfig(), height: state.NextBlockNumber()}
+
+	for sender, senderTXs := range bySender {
+		sort.Slice(senderTXs, func(i, j int) bool { return senderTXs[i].Nonce < senderTXs[j].Nonce })
+
+		nextNonce := state.GetNextAccountNonce(sender)
+		contiguous := make([]database.SignedTx, 0, len(senderTXs))
+
+		for _, tx := range senderTXs {
+			if tx.Nonce < nextNonce {
+				continue
+			}
+
+			// Blocks apply TXs by time so a TX signed before the previous nonce could never follow it
+			isAfterPrevious := len(contiguous) == 0 || tx.Time >= contiguous[len(contiguous)-1].Time
+			if tx.Nonce != nextNonce || !isAfterPrevious {
+				break
+			}
+
+			contiguous = append(contiguous, tx)
+			nextNonce++
+		}
+
+		if len(contiguous) == 0 {
+			delete(bySender, sender)
+			continue
+		}
+
+		heads.txs = append(heads.txs, contiguous[0])
+		bySender[sender] = contiguous[1:]
+	}
+
+	heap.Init(heads)
+
+	return &txsByPrice{heads, bySender}
+}
+
+// peek returns the best paying TX, false once there are no TXs left.
+func (t *txsByPrice) peek() (database.SignedTx, bool) {
+	if t.heads.Len() == 0 {
+		return database.SignedTx{}, false
+	}
+
+	return t.heads.txs[0], true
+}
+
+// shift replaces the best paying TX with the next TX of the same sender.
+func (t *txsByPrice) shift() {
+	sender := t.heads.txs[0].From
+
+	if next := t.bySender[sender]; len(next) > 0 {
+		t.heads.txs[0] = next[0]
+		t.bySender[sender] = next[1:]
+		heap.Fix(t.heads, 0)
+		return
+	}
+
+	heap.Pop(t.heads)
+}
+
+// pop drops the best paying TX together with the rest of the sender TXs, they can't be mined without it.
+func (t *txsByPrice) pop() {
+	delete(t.bySender, t.heads.txs[0].From)
+	heap.Pop(t.heads)
+}
+
+// priceHeap orders TXs by their fee per gas, the earlier TX first on a tie.
+type priceHeap struct {
+	config database.ChainConfig
+	height uint64
+	txs    []database.SignedTx
+}
+
+func (h *priceHeap) Len() int { return len(h.txs) }
+
+func (h *priceHeap) Less(i, j int) bool {
+	if c := comparePrice(h.config, h.height, h.txs[i], h.txs[j]); c != 0 {
+		return c > 0
+	}
+
+	return h.txs[i].Time < h.txs[j].Time
+}
+
+func (h *priceHeap) Swap(i, j int) { h.txs[i], h.txs[j] = h.txs[j], h.txs[i] }
+
+func (h *priceHeap) Push(x interface{}) { h.txs = append(h.txs, x.(database.SignedTx)) }
+
+func (h *priceHeap) Pop() interface{} {
+	last := h.txs[len(h.txs)-1]
+	h.txs = h.txs[:len(h.txs)-1]
+
+	return last
+}
+
+// comparePrice returns a positive number if the TX a pays a higher fee per gas than the TX b, negative if lower.
+func comparePrice(config database.ChainConfig, height uint64, a, b database.SignedTx) int {
+	gasA, gasB := database.NewAmount(uint64(config.TxGas(a.Tx, height))), database.NewAmount(uint64(config.TxGas(b.Tx, height)))
+
+	// Compares feeA/gasA with feeB/gasB without losing the integer division remainder.
+	// Miner fees fit 128 bits so the products can't overflow.
+	scoreA, _ := config.MinerFee(a.Tx, height).Mul(gasB)
+	scoreB, _ := config.MinerFee(b.Tx, height).Mul(gasA)
+
+	return scoreA.Cmp(scoreB)
+}
+
+// recentTxCache remembers the hashes of the latest mined TXs so peers still relaying them don't re-add them quietly.
+//
+// The cache is bounded, an older mined TX is rejected by the nonce validation instead.
+type recentTxCache struct {
+	mu sync.Mutex
+	// hashes maps the cached TX hashes to their ring slots
+	hashes   map[database.Hash]int
+	ring     []database.Hash
+	next     int
+	capacity int
+}
+
+func newRecentTxCache(capacity int) (*recentTxCache, error) {
+	if capacity < 1 {
+		return nil, fmt.Errorf("recent TX cache capacity must be at least 1 not %d", capacity)
+	}
+
+	return &recentTxCache{hashes: make(map[database.Hash]int), ring: make([]database.Hash, 0, capacity), capacity: capacity}, nil
+}
+
+// add evicts the oldest TX once the cache is full.
+func (c *recentTxCache) add(txHash database.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.hashes[txHash]; exists {
+		return
+	}
+
+	if len(c.ring) < c.capacity {
+		c.hashes[txHash] = len(c.ring)
+		c.ring = append(c.ring, txHash)
+		return
+	}
+
+	// A slot emptied by remove holds no hash to evict
+	if evicted := c.ring[c.next]; !evicted.IsEmpty() {
+		delete(c.hashes, evicted)
+	}
+
+	c.ring[c.next] = txHash
+	c.hashes[txHash] = c.next
+	c.next = (c.next + 1) % c.capacity
+}
+
+func (c *recentTxCache) has(txHash database.Hash) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, exists := c.hashes[txHash]
+
+	return exists
+}
+
+// remove empties the TX ring slot too, so the TX added again isn't evicted with its old slot.
+func (c *recentTxCache) remove(txHash database.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	slot, exists := c.hashes[txHash]
+	if !exists {
+		return
+	}
+
+	c.ring[slot] = database.Hash{}
+	delete(c.hashes, txHash)
+}
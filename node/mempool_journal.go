@@ -0,0 +1,158 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package node
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/web3coach/the-blockchain-bar/database"
+)
+
+// txJournal persists the accepted pending TXs, one JSON TX per line, so they survive a node restart.
+//
+// The journal is append only, removed TXs stay in it until it's rotated with the pool TXs.
+type txJournal struct {
+	mu   sync.Mutex
+	path string
+	// nil until the journal is rotated, TXs re-added while loading the journal aren't appended again
+	file *os.File
+}
+
+func newTxJournal(dataDir string) *txJournal {
+	return &txJournal{path: database.GetMempoolJournalFilePath(dataDir)}
+}
+
+// load reads the journaled TXs. A torn last line left by a crash is skipped.
+func (j *txJournal) load() ([]database.SignedTx, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	txs := make([]database.SignedTx, 0)
+
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return txs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var tx database.SignedTx
+		err = json.Unmarshal(scanner.Bytes(), &tx)
+		if err != nil {
+			fmt.Printf("Skipping corrupted mempool journal entry. %s\n", err)
+			continue
+		}
+
+		txs = append(txs, tx)
+	}
+
+	return txs, scanner.Err()
+}
+
+// insert appends the TX to the journal.
+func (j *txJournal) insert(tx database.SignedTx) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = j.file.Write(append(txJson, '\n'))
+
+	return err
+}
+
+// rotate replaces the journal content with the given TXs and keeps appending to the new journal.
+func (j *txJournal) rotate(txs []database.SignedTx) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	tmpPath := j.path + ".new"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, tx := range txs {
+		txJson, err := json.Marshal(tx)
+		if err != nil {
+			_ = tmp.Close()
+			return err
+		}
+
+		_, err = w.Write(append(txJson, '\n'))
+		if err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if j.file != nil {
+		_ = j.file.Close()
+		j.file = nil
+	}
+
+	err = os.Rename(tmpPath, j.path)
+	if err != nil {
+		return err
+	}
+
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+
+	return err
+}
+
+func (j *txJournal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+
+	err := j.file.Close()
+	j.file = nil
+
+	return err
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package node
+
+import (
+	"bufio"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/database"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Andrej submits TXs with the nonces 1 and 2, and 4 which is queued
+//   - The TX with nonce 1 gets mined and the node restarts
+//   - The restarted node reloads the TXs 2 and 4 from the journal and drops the mined one
+func TestNode_MempoolJournal(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := database.NewAccount(testKsBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	state, err := database.NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	startNode := func() *Node {
+		n := New(dataDir, "127.0.0.1", 8085, andrej, PeerNode{}, nodeVersion, defaultTestMiningDifficulty)
+		n.state = state
+		n.resetPendingState()
+
+		err := n.loadJournaledTXs()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return n
+	}
+
+	n := startNode()
+
+	txs := make([]database.SignedTx, 0)
+	for _, nonce := range []uint{1, 2, 4} {
+		tx := signTestTx(t, andrejKey, andrej, babaYaga, 1, nonce)
+		txs = append(txs, tx)
+
+		if err := n.AddPendingTX(tx, n.info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = n.journal.close()
+
+	if _, err := state.AddBlock(mineTestBlock(t, state, andrej, txs[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	n = startNode()
+	defer n.journal.close()
+
+	for i, isPooled := range []bool{false, true, true} {
+		txHash, err := txs[i].Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := n.pendingTXs.get(txHash); ok != isPooled {
+			t.Errorf("journaled TX with nonce %d pooled should be %t", txs[i].Nonce, isPooled)
+		}
+	}
+
+	if n.pendingTXs.len() != 1 || n.pendingTXs.queuedLen() != 1 {
+		t.Fatalf("1 TX should be pending and 1 queued, not %d pending and %d queued", n.pendingTXs.len(), n.pendingTXs.queuedLen())
+	}
+
+	f, err := os.Open(database.GetMempoolJournalFilePath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+	}
+
+	if lines != 2 {
+		t.Fatalf("rotated journal should hold 2 TXs not %d", lines)
+	}
+}
@@ -0,0 +1,393 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package node
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/database"
+	"github.com/web3coach/the-blockchain-bar/fs"
+	"github.com/web3coach/the-blockchain-bar/wallet"
+)
+
+// The test logic summary:
+//   - Andrej pays the default gas price for 3 TXs, BabaYaga pays a 5x gas price for 2 TXs
+//   - The pool lists BabaYaga's TXs first, each sender TXs in nonce order
+//   - A TX after a nonce gap isn't listed
+//   - The block template with a gas limit of 3 TXs picks BabaYaga's 2 TXs and Andrej's first TX
+func TestTxPool_FeePriority(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYagaKey, _, babaYaga, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	forks := make(map[database.Fork]uint64)
+	for _, fork := range database.KnownForks {
+		forks[fork] = 0
+	}
+
+	err = database.InitGenesis(dataDir, database.Genesis{
+		ChainID:          testChainID,
+		Balances:         map[common.Address]uint{andrej: 1000, babaYaga: 1000},
+		MiningDifficulty: database.GenesisParam(defaultTestMiningDifficulty),
+		BlockGasLimit:    3 * database.TxGas,
+		Forks:            forks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := database.NewStateFromDisk(dataDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	pool := newTxPool(DefaultMempoolSize, DefaultMempoolTTL)
+	addTx := func(tx database.SignedTx) {
+		txHash, err := tx.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.add(txHash, tx)
+	}
+
+	for nonce := uint(1); nonce <= 3; nonce++ {
+		addTx(signTestTx(t, andrejKey, andrej, babaYaga, 1, nonce))
+	}
+
+	for nonce := uint(1); nonce <= 2; nonce++ {
+		tx, err := wallet.SignTx(database.NewTransferTx(babaYaga, andrej, database.TxGas, 5*database.TxGasPriceDefault, database.AmountFromTBB(1), nonce, ""), testChainID, babaYagaKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addTx(tx)
+	}
+
+	addTx(signTestTx(t, andrejKey, andrej, babaYaga, 1, 5))
+
+	expected := []struct {
+		from  common.Address
+		nonce uint
+	}{{babaYaga, 1}, {babaYaga, 2}, {andrej, 1}, {andrej, 2}, {andrej, 3}}
+
+	txs := pool.byPrice(state)
+	if len(txs) != len(expected) {
+		t.Fatalf("pool should list %d TXs not %d", len(expected), len(txs))
+	}
+
+	for i, tx := range txs {
+		if tx.From != expected[i].from || tx.Nonce != expected[i].nonce {
+			t.Errorf("TX %d should be from %s with nonce %d not from %s with nonce %d", i, expected[i].from, expected[i].nonce, tx.From, tx.Nonce)
+		}
+	}
+
+	blockTXs, err := selectBlockTXs(state, txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blockTXs) != 3 {
+		t.Fatalf("block template should pick 3 TXs not %d", len(blockTXs))
+	}
+
+	andrejTXs := 0
+	for _, tx := range blockTXs {
+		if tx.From == andrej {
+			andrejTXs++
+		}
+	}
+
+	if andrejTXs != 1 {
+		t.Fatalf("block template should pick 1 Andrej TX not %d", andrejTXs)
+	}
+
+	if _, err := state.AddBlock(mineTestBlock(t, state, andrej, blockTXs...)); err != nil {
+		t.Fatalf("block template should be valid: %s", err)
+	}
+}
+
+// The test logic summary:
+//   - The mempool holds 2 TXs, from Andrej and BabaYaga, both paying the default gas price
+//   - Another Andrej TX doesn't pay more than the cheapest pending TX and is rejected
+//   - BabaYaga replaces her TX with the same nonce, only with a high enough gas price
+//   - Caesar's better paying TX evicts Andrej's TX, the cheapest one
+//   - The pending TXs expire after the TTL and the same nonces are accepted again
+func TestNode_MempoolLimits(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYagaKey, _, babaYaga, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caesarKey, _, caesar, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000, babaYaga: 1000, caesar: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	n := New(dataDir, "127.0.0.1", 8085, andrej, PeerNode{}, nodeVersion, defaultTestMiningDifficulty)
+	n.ConfigureMempool(2, time.Hour)
+
+	state, err := database.NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+	n.state = state
+	n.resetPendingState()
+
+	signPricedTx := func(key *ecdsa.PrivateKey, from, to common.Address, gasPrice, nonce uint) database.SignedTx {
+		tx, err := wallet.SignTx(database.NewTransferTx(from, to, database.TxGas, gasPrice, database.AmountFromTBB(1), nonce, ""), testChainID, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return tx
+	}
+
+	andrejTx := signPricedTx(andrejKey, andrej, babaYaga, 1, 1)
+	babaYagaTx := signPricedTx(babaYagaKey, babaYaga, andrej, 1, 1)
+	for _, tx := range []database.SignedTx{andrejTx, babaYagaTx} {
+		if err := n.AddPendingTX(tx, n.info); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := n.AddPendingTX(signPricedTx(andrejKey, andrej, babaYaga, 1, 2), n.info); err == nil {
+		t.Fatal("TX not paying more than the cheapest pending TX should be rejected by a full mempool")
+	}
+
+	if err := n.AddPendingTX(signPricedTx(babaYagaKey, babaYaga, caesar, 1, 1), n.info); err == nil {
+		t.Fatal("replacement TX without a higher gas price should be rejected")
+	}
+
+	replacementTx := signPricedTx(babaYagaKey, babaYaga, caesar, 2, 1)
+	if err := n.AddPendingTX(replacementTx, n.info); err != nil {
+		t.Fatalf("replacement TX with a higher gas price should be accepted: %s", err)
+	}
+
+	assertPending := func(tx database.SignedTx, isPending bool) {
+		txHash, err := tx.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := n.pendingTXs.get(txHash); ok != isPending {
+			t.Fatalf("TX %s pending should be %t", txHash.Hex(), isPending)
+		}
+	}
+
+	assertPending(babaYagaTx, false)
+	assertPending(replacementTx, true)
+
+	caesarTx := signPricedTx(caesarKey, caesar, andrej, 5, 1)
+	if err := n.AddPendingTX(caesarTx, n.info); err != nil {
+		t.Fatalf("better paying TX should evict the cheapest pending TX: %s", err)
+	}
+
+	assertPending(andrejTx, false)
+	assertPending(caesarTx, true)
+
+	if n.pendingTXs.len() != 2 {
+		t.Fatalf("mempool should hold 2 TXs not %d", n.pendingTXs.len())
+	}
+
+	n.pendingTXs.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	n.expirePendingTXs()
+
+	if n.pendingTXs.len() != 0 {
+		t.Fatalf("pending TXs should expire after the TTL, %d TXs left", n.pendingTXs.len())
+	}
+
+	if err := n.AddPendingTX(signPricedTx(caesarKey, caesar, andrej, 1, 1), n.info); err != nil {
+		t.Fatalf("nonce of an expired TX should be accepted again: %s", err)
+	}
+}
+
+// The test logic summary:
+//   - Andrej's TXs with the nonces 3 and 2 arrive first and are queued
+//   - A 3rd queued TX exceeds Andrej's queue limit of 2 TXs
+//   - The TX with nonce 1 is pending and promotes the queued TXs
+func TestNode_MempoolQueue(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := database.NewAccount(testKsBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	n := New(dataDir, "127.0.0.1", 8085, andrej, PeerNode{}, nodeVersion, defaultTestMiningDifficulty)
+	n.pendingTXs.maxQueuedPerSender = 2
+
+	state, err := database.NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+	n.state = state
+	n.resetPendingState()
+
+	for _, nonce := range []uint{3, 2} {
+		if err := n.AddPendingTX(signTestTx(t, andrejKey, andrej, babaYaga, 1, nonce), n.info); err != nil {
+			t.Fatalf("TX with future nonce %d should be queued: %s", nonce, err)
+		}
+	}
+
+	if n.pendingTXs.len() != 0 || n.pendingTXs.queuedLen() != 2 {
+		t.Fatalf("2 TXs should be queued and none pending, not %d queued and %d pending", n.pendingTXs.queuedLen(), n.pendingTXs.len())
+	}
+
+	if err := n.AddPendingTX(signTestTx(t, andrejKey, andrej, babaYaga, 1, 4), n.info); err == nil {
+		t.Fatal("TX exceeding the sender queue limit should be rejected")
+	}
+
+	if err := n.AddPendingTX(signTestTx(t, andrejKey, andrej, babaYaga, 1, 1), n.info); err != nil {
+		t.Fatal(err)
+	}
+
+	if n.pendingTXs.len() != 3 || n.pendingTXs.queuedLen() != 0 {
+		t.Fatalf("queued TXs should be promoted, %d TXs pending and %d queued", n.pendingTXs.len(), n.pendingTXs.queuedLen())
+	}
+
+	if next := n.pendingState.GetNextAccountNonce(andrej); next != 4 {
+		t.Fatalf("Andrej next pending nonce should be 4 not %d", next)
+	}
+}
+
+// The test logic summary:
+//   - The archived TXs cache remembers the 2 latest mined TXs
+//   - Andrej's 3 mined TXs are re-added, the 2 latest are ignored as archived
+//   - The oldest, no longer cached, TX is rejected by its nonce
+func TestNode_ArchivedTXs(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := database.NewAccount(testKsBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	n := New(dataDir, "127.0.0.1", 8085, andrej, PeerNode{}, nodeVersion, defaultTestMiningDifficulty)
+	n.archivedTXs, err = newRecentTxCache(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := database.NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+	n.state = state
+	n.resetPendingState()
+
+	txs := make([]database.SignedTx, 0)
+	for nonce := uint(1); nonce <= 3; nonce++ {
+		tx := signTestTx(t, andrejKey, andrej, babaYaga, 1, nonce)
+		txs = append(txs, tx)
+
+		if err := n.AddPendingTX(tx, n.info); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	block := mineTestBlock(t, state, andrej, txs...)
+	n.removeMinedPendingTXs(block)
+	if err := n.addBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.AddPendingTX(txs[0], n.info); err == nil {
+		t.Error("mined TX missing in the archived TXs cache should be rejected by its nonce")
+	}
+
+	for _, tx := range txs[1:] {
+		if err := n.AddPendingTX(tx, n.info); err != nil {
+			t.Errorf("archived TX should be ignored: %s", err)
+		}
+	}
+
+	if n.pendingTXs.len() != 0 {
+		t.Fatalf("mined TXs shouldn't be pending again, %d TXs pending", n.pendingTXs.len())
+	}
+}
+
+// The test logic summary:
+//   - A cache without capacity is rejected
+//   - A TX removed and added again takes a new ring slot, its old slot doesn't evict it
+//   - Once full, the oldest TX is evicted
+func TestRecentTxCache(t *testing.T) {
+	if _, err := newRecentTxCache(0); err == nil {
+		t.Error("recent TX cache without capacity should be rejected")
+	}
+
+	cache, err := newRecentTxCache(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b, c, d := database.Hash{1}, database.Hash{2}, database.Hash{3}, database.Hash{4}
+
+	cache.add(a)
+	cache.remove(a)
+	if cache.has(a) {
+		t.Fatal("removed TX should not be cached")
+	}
+
+	cache.add(a)
+	cache.add(b)
+	cache.add(c)
+	for _, txHash := range []database.Hash{a, b, c} {
+		if !cache.has(txHash) {
+			t.Errorf("TX %x should be cached", txHash)
+		}
+	}
+
+	cache.add(d)
+	if cache.has(a) || !cache.has(d) {
+		t.Errorf("oldest TX %x should be evicted by %x", a, d)
+	}
+}
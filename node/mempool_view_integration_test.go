@@ -74,19 +74,19 @@ func TestNode_MempoolViewer(t *testing.T) {
 	tx2 := database.NewBaseTx(andrej, babaYaga, 2, 2, "")
 	tx3 := database.NewBaseTx(babaYaga, andrej, 1, 1, "")
 
-	signedTx1, err := wallet.SignTxWithKeystoreAccount(tx1, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+	signedTx1, err := wallet.SignTxWithKeystoreAccount(tx1, "", andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
-	signedTx2, err := wallet.SignTxWithKeystoreAccount(tx2, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+	signedTx2, err := wallet.SignTxWithKeystoreAccount(tx2, "", andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
-	signedTx3, err := wallet.SignTxWithKeystoreAccount(tx3, babaYaga, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+	signedTx3, err := wallet.SignTxWithKeystoreAccount(tx3, "", babaYaga, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
 	if err != nil {
 		t.Error(err)
 		return
@@ -110,7 +110,7 @@ func TestNode_MempoolViewer(t *testing.T) {
 	req, _ := http.NewRequest(http.MethodGet, "/mempool/", nil)
 
 	func(w http.ResponseWriter, r *http.Request, node *Node) {
-		mempoolViewer(w, r, node.pendingTXs)
+		mempoolViewer(w, r, node.pendingTXs.asMap())
 	}(rr, req, n)
 
 	if rr.Code != http.StatusOK {
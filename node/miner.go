@@ -31,24 +31,171 @@ type PendingBlock struct {
 	time   uint64
 	miner  common.Address
 	txs    []database.SignedTx
+
+	// Committed in the block header since the TIP2 fork
+	txRoot *database.Hash
+	// Committed in the block header since the TIP3 fork
+	stateRoot *database.Hash
+	// Committed in the block header since the TIP5 fork
+	difficulty *uint
+	// Committed in the block header since the TIP6 fork
+	bits *uint32
 }
 
 func NewPendingBlock(parent database.Hash, number uint64, miner common.Address, txs []database.SignedTx) PendingBlock {
-	return PendingBlock{parent, number, uint64(time.Now().Unix()), miner, txs}
+	return PendingBlock{parent: parent, number: number, time: uint64(time.Now().Unix()), miner: miner, txs: txs}
+}
+
+// selectBlockTXs picks the TXs paying the highest fee per gas which fit in the block gas limit and byte cap
+// since the TIP8 fork. The TXs left out wait in the mempool for a next block.
+//
+// Each sender TXs are picked in nonce order, once a sender TX doesn't fit, or fails, its next TXs are skipped.
+func selectBlockTXs(state *database.State, txs []database.SignedTx) ([]database.SignedTx, error) {
+	config := state.ChainConfig()
+	height := state.NextBlockNumber()
+	hasLimits := state.IsForkActive(database.ForkTIP8)
+
+	next := state.Copy()
+	selected := make([]database.SignedTx, 0)
+	gas := uint(0)
+	size := uint64(0)
+
+	candidates := newTxsByPrice(state, txs)
+	for tx, ok := candidates.peek(); ok; tx, ok = candidates.peek() {
+		txGas := config.TxGas(tx.Tx, height)
+		txSize, err := database.TxSize(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		if hasLimits && (gas+txGas > config.BlockGasLimit || size+txSize > config.BlockMaxBytes) {
+			candidates.pop()
+			continue
+		}
+
+		err = database.ApplyTx(tx, &next)
+		if err != nil {
+			candidates.pop()
+			continue
+		}
+
+		selected = append(selected, tx)
+		gas += txGas
+		size += txSize
+		candidates.shift()
+	}
+
+	return validBlockOrder(state, selected), nil
+}
+
+// validBlockOrder sorts the TXs the way blocks apply them, by time, and drops the TXs failing in that order
+// together with their sender next TXs, e.g. a TX spending funds received from a TX signed after it.
+func validBlockOrder(state *database.State, txs []database.SignedTx) []database.SignedTx {
+	database.SortBlockTXs(txs)
+
+	for {
+		next := state.Copy()
+		failed := -1
+
+		for i, tx := range txs {
+			if database.ApplyTx(tx, &next) != nil {
+				failed = i
+				break
+			}
+		}
+
+		if failed < 0 {
+			return txs
+		}
+
+		remaining := make([]database.SignedTx, 0, len(txs)-1)
+		for i, tx := range txs {
+			if i != failed && (tx.From != txs[failed].From || tx.Nonce < txs[failed].Nonce) {
+				remaining = append(remaining, tx)
+			}
+		}
+		txs = remaining
+	}
+}
+
+// withTimeAfter moves the pending block time past the median time of the latest blocks, required since the TIP7 fork.
+func (pb PendingBlock) withTimeAfter(medianTimePast uint64) PendingBlock {
+	if pb.time <= medianTimePast {
+		pb.time = medianTimePast + 1
+	}
+
+	return pb
+}
+
+// withTxRoot commits the pending block TXs in the mined block header, required since the TIP2 fork.
+func (pb PendingBlock) withTxRoot() (PendingBlock, error) {
+	txRoot, err := database.TxRoot(pb.txs)
+	if err != nil {
+		return PendingBlock{}, err
+	}
+
+	pb.txRoot = &txRoot
+
+	return pb, nil
+}
+
+// withStateRoot commits the state after applying the pending block on top of the given state, required since the TIP3 fork.
+func (pb PendingBlock) withStateRoot(state *database.State) (PendingBlock, error) {
+	stateRoot, err := state.NextStateRoot(pb.miner, pb.txs)
+	if err != nil {
+		return PendingBlock{}, err
+	}
+
+	pb.stateRoot = &stateRoot
+
+	return pb, nil
+}
+
+// withDifficulty commits the retargeted mining difficulty in the mined block header, required since the TIP5 fork.
+func (pb PendingBlock) withDifficulty(difficulty uint) PendingBlock {
+	pb.difficulty = &difficulty
+
+	return pb
 }
 
+// withBits commits the 256-bit target, in its compact form, in the mined block header, required since the TIP6 fork.
+func (pb PendingBlock) withBits(bits uint32) PendingBlock {
+	pb.bits = &bits
+
+	return pb
+}
+
+// Mine searches for a block hash satisfying the mining difficulty.
+//
+// A pending block committing to a retargeted difficulty, or target, is mined at it instead of the given miningDifficulty.
 func Mine(ctx context.Context, pb PendingBlock, miningDifficulty uint) (database.Block, error) {
 	if len(pb.txs) == 0 {
 		return database.Block{}, fmt.Errorf("mining empty blocks is not allowed")
 	}
 
+	if pb.difficulty != nil {
+		miningDifficulty = *pb.difficulty
+	}
+
 	start := time.Now()
 	attempt := 0
 	var block database.Block
 	var hash database.Hash
 	var nonce uint32
 
-	for !database.IsBlockHashValid(hash, miningDifficulty) {
+	isHashValid := func(hash database.Hash) bool {
+		return database.IsBlockHashValid(hash, miningDifficulty)
+	}
+
+	if pb.bits != nil {
+		target := database.BitsToTarget(*pb.bits)
+		isHashValid = func(hash database.Hash) bool {
+			// The zero value isn't a mined hash yet
+			return !hash.IsEmpty() && database.IsBlockHashBelowTarget(hash, target)
+		}
+	}
+
+	for !isHashValid(hash) {
 		select {
 		case <-ctx.Done():
 			fmt.Println("Mining cancelled!")
@@ -65,6 +212,10 @@ func Mine(ctx context.Context, pb PendingBlock, miningDifficulty uint) (database
 		}
 
 		block = database.NewBlock(pb.parent, pb.number, nonce, pb.time, pb.miner, pb.txs)
+		block.Header.TxRoot = pb.txRoot
+		block.Header.StateRoot = pb.stateRoot
+		block.Header.Difficulty = pb.difficulty
+		block.Header.Bits = pb.bits
 		blockHash, err := block.Hash()
 		if err != nil {
 			return database.Block{}, fmt.Errorf("couldn't mine block. %s", err.Error())
@@ -21,6 +21,7 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -124,7 +125,7 @@ func generateKey() (*ecdsa.PrivateKey, ecdsa.PublicKey, common.Address, error) {
 
 func createRandomPendingBlock(privKey *ecdsa.PrivateKey, acc common.Address) (PendingBlock, error) {
 	tx := database.NewBaseTx(acc, database.NewAccount(testKsBabaYagaAccount), 1, 1, "")
-	signedTx, err := wallet.SignTx(tx, privKey)
+	signedTx, err := wallet.SignTx(tx, "", privKey)
 	if err != nil {
 		return PendingBlock{}, err
 	}
@@ -136,3 +137,88 @@ func createRandomPendingBlock(privKey *ecdsa.PrivateKey, acc common.Address) (Pe
 		[]database.SignedTx{signedTx},
 	), nil
 }
+
+// signTestTx signs a typed transfer TX of whole TBB on the test chains having all forks active
+func signTestTx(t *testing.T, privKey *ecdsa.PrivateKey, from, to common.Address, value, nonce uint) database.SignedTx {
+	tx := database.NewTransferTx(from, to, database.TxGas, database.TxGasPriceDefault, database.AmountFromTBB(uint64(value)), nonce, "")
+
+	signedTx, err := wallet.SignTx(tx, testChainID, privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signedTx
+}
+
+// mineTestBlock mines the TXs in a block on top of the state latest block, timed like the node miner does
+func mineTestBlock(t *testing.T, state *database.State, miner common.Address, txs ...database.SignedTx) database.Block {
+	blockTime := uint64(time.Now().Unix())
+	if state.IsForkActive(database.ForkTIP7) && blockTime <= state.MedianTimePast() {
+		blockTime = state.MedianTimePast() + 1
+	}
+
+	return mineTestBlockAt(t, state, blockTime, miner, txs...)
+}
+
+// mineTestBlockAt mines the TXs in a block with the given time on top of the state latest block
+func mineTestBlockAt(t *testing.T, state *database.State, blockTime uint64, miner common.Address, txs ...database.SignedTx) database.Block {
+	pendingBlock := NewPendingBlock(state.LatestBlockHash(), state.NextBlockNumber(), miner, txs)
+	pendingBlock.time = blockTime
+
+	pendingBlock, err := pendingBlock.withTxRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pendingBlock, err = pendingBlock.withStateRoot(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.IsForkActive(database.ForkTIP6) {
+		pendingBlock = pendingBlock.withBits(state.NextBits())
+	} else if state.IsForkActive(database.ForkTIP5) {
+		pendingBlock = pendingBlock.withDifficulty(state.NextDifficulty())
+	}
+
+	block, err := Mine(context.Background(), pendingBlock, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+const testChainID = "tbb-test"
+
+// setupTestGenesisDir creates a node directory without keystore accounts and with all forks active from the start
+//
+// Remember to remove the dir once test finishes: defer fs.RemoveDir(dataDir)
+func setupTestGenesisDir(balances map[common.Address]uint) (string, error) {
+	dataDir, err := getTestDataDirPath()
+	if err != nil {
+		return "", err
+	}
+
+	forks := make(map[database.Fork]uint64)
+	for _, fork := range database.KnownForks {
+		forks[fork] = 0
+	}
+
+	genesisJson, err := json.Marshal(database.Genesis{
+		ChainID:          testChainID,
+		Balances:         balances,
+		MiningDifficulty: database.GenesisParam(defaultTestMiningDifficulty),
+		Forks:            forks,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = database.InitDataDirIfNotExists(dataDir, genesisJson)
+	if err != nil {
+		return "", err
+	}
+
+	return dataDir, nil
+}
@@ -47,10 +47,36 @@ const endpointAddPeerQueryKeyMiner = "miner"
 const endpointAddPeerQueryKeyVersion = "version"
 
 const endpointBlockByNumberOrHash = "/block/"
+const endpointTx = "/tx/"
+const endpointTxProof = "proof"
+
+const endpointAccount = "/account/"
+const endpointAccountProof = "proof"
+const endpointAccountProofQueryKeyBlock = "block"
+const endpointAccountTxs = "txs"
+const endpointAccountTxsQueryKeyCursor = "cursor"
+const endpointAccountTxsQueryKeyLimit = "limit"
+
+const accountTxsDefaultLimit = 20
+const accountTxsMaxLimit = 100
 const endpointMempoolViewer = "/mempool/"
 
+const endpointTokens = "/tokens/list"
+const endpointToken = "/token/"
+const endpointTokenBalances = "balances"
+
 const miningIntervalSeconds = 10
-const DefaultMiningDifficulty = 3
+
+const DefaultMempoolSize = 5000
+const DefaultMempoolTTL = 3 * time.Hour
+const DefaultMempoolQueuePerSender = 64
+
+// A pending TX is replaced by a TX with the same sender and nonce paying a gas price higher by at least this percentage
+const mempoolPriceBumpPercent = 10
+
+// Number of the latest mined TXs remembered to ignore peers relaying them, older TXs fail the nonce validation
+const archivedTXsCacheSize = 10000
+const DefaultMiningDifficulty = database.DefaultMiningDifficulty
 
 type PeerNode struct {
 	IP          string         `json:"ip"`
@@ -86,26 +112,32 @@ type Node struct {
 	pendingState *database.State
 
 	knownPeers      map[string]PeerNode
-	pendingTXs      map[string]database.SignedTx
-	archivedTXs     map[string]database.SignedTx
+	pendingTXs      *txPool
+	journal         *txJournal
+	archivedTXs     *recentTxCache
 	newSyncedBlocks chan database.Block
 	newPendingTXs   chan database.SignedTx
 	nodeVersion     string
 
-	// Number of zeroes the hash must start with to be considered valid. Default 3
+	// Number of zeroes the hash must start with to be considered valid before the TIP5 fork retargeting. Default 3
 	miningDifficulty uint
 	isMining         bool
 }
 
+// New creates a node. The mining difficulty overrides the genesis one unless it's 0.
 func New(dataDir string, ip string, port uint64, acc common.Address, bootstrap PeerNode, version string, miningDifficulty uint) *Node {
 	knownPeers := make(map[string]PeerNode)
 
+	// The cache size is a positive constant
+	archivedTXs, _ := newRecentTxCache(archivedTXsCacheSize)
+
 	n := &Node{
 		dataDir:          dataDir,
 		info:             NewPeerNode(ip, port, false, acc, true, version),
 		knownPeers:       knownPeers,
-		pendingTXs:       make(map[string]database.SignedTx),
-		archivedTXs:      make(map[string]database.SignedTx),
+		pendingTXs:       newTxPool(DefaultMempoolSize, DefaultMempoolTTL),
+		journal:          newTxJournal(dataDir),
+		archivedTXs:      archivedTXs,
 		newSyncedBlocks:  make(chan database.Block),
 		newPendingTXs:    make(chan database.SignedTx, 10000),
 		nodeVersion:      version,
@@ -132,10 +164,17 @@ func (n *Node) Run(ctx context.Context, isSSLDisabled bool, sslEmail string) err
 	defer state.Close()
 
 	n.state = state
+	n.miningDifficulty = state.MiningDifficulty()
 
 	pendingState := state.Copy()
 	n.pendingState = &pendingState
 
+	err = n.loadJournaledTXs()
+	if err != nil {
+		return err
+	}
+	defer n.journal.close()
+
 	fmt.Println("Blockchain state:")
 	fmt.Printf("	- height: %d\n", n.state.LatestBlock().Header.Number)
 	fmt.Printf("	- hash: %s\n", n.state.LatestBlockHash().Hex())
@@ -161,6 +200,10 @@ func (n *Node) serveHttp(ctx context.Context, isSSLDisabled bool, sslEmail strin
 		txAddHandler(w, r, n)
 	})
 
+	handler.HandleFunc("/tx/submit", func(w http.ResponseWriter, r *http.Request) {
+		txSubmitHandler(w, r, n)
+	})
+
 	handler.HandleFunc(endpointStatus, func(w http.ResponseWriter, r *http.Request) {
 		statusHandler(w, r, n)
 	})
@@ -177,8 +220,24 @@ func (n *Node) serveHttp(ctx context.Context, isSSLDisabled bool, sslEmail strin
 		blockByNumberOrHash(w, r, n)
 	})
 
+	handler.HandleFunc(endpointTx, func(w http.ResponseWriter, r *http.Request) {
+		txHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointAccount, func(w http.ResponseWriter, r *http.Request) {
+		accountHandler(w, r, n)
+	})
+
+	handler.HandleFunc(endpointTokens, func(w http.ResponseWriter, r *http.Request) {
+		listTokensHandler(w, r, n.state)
+	})
+
+	handler.HandleFunc(endpointToken, func(w http.ResponseWriter, r *http.Request) {
+		tokenHandler(w, r, n.state)
+	})
+
 	handler.HandleFunc(endpointMempoolViewer, func(w http.ResponseWriter, r *http.Request) {
-		mempoolViewer(w, r, n.pendingTXs)
+		mempoolViewer(w, r, n.pendingTXs.asMap())
 	})
 
 	if isSSLDisabled {
@@ -212,8 +271,10 @@ func (n *Node) mine(ctx context.Context) error {
 	for {
 		select {
 		case <-ticker.C:
+			n.expirePendingTXs()
+
 			go func() {
-				if len(n.pendingTXs) > 0 && !n.isMining {
+				if n.pendingTXs.len() > 0 && !n.isMining {
 					n.isMining = true
 
 					miningCtx, stopCurrentMining = context.WithCancel(ctx)
@@ -243,13 +304,42 @@ func (n *Node) mine(ctx context.Context) error {
 }
 
 func (n *Node) minePendingTXs(ctx context.Context) error {
+	txs, err := selectBlockTXs(n.state, n.getPendingTXsAsArray())
+	if err != nil {
+		return err
+	}
+
 	blockToMine := NewPendingBlock(
 		n.state.LatestBlockHash(),
 		n.state.NextBlockNumber(),
 		n.info.Account,
-		n.getPendingTXsAsArray(),
+		txs,
 	)
 
+	if n.state.IsForkActive(database.ForkTIP7) {
+		blockToMine = blockToMine.withTimeAfter(n.state.MedianTimePast())
+	}
+
+	if n.state.IsForkActive(database.ForkTIP2) {
+		blockToMine, err = blockToMine.withTxRoot()
+		if err != nil {
+			return err
+		}
+	}
+
+	if n.state.IsForkActive(database.ForkTIP3) {
+		blockToMine, err = blockToMine.withStateRoot(n.state)
+		if err != nil {
+			return err
+		}
+	}
+
+	if n.state.IsForkActive(database.ForkTIP6) {
+		blockToMine = blockToMine.withBits(n.state.NextBits())
+	} else if n.state.IsForkActive(database.ForkTIP5) {
+		blockToMine = blockToMine.withDifficulty(n.state.NextDifficulty())
+	}
+
 	minedBlock, err := Mine(ctx, blockToMine, n.miningDifficulty)
 	if err != nil {
 		return err
@@ -266,21 +356,27 @@ func (n *Node) minePendingTXs(ctx context.Context) error {
 }
 
 func (n *Node) removeMinedPendingTXs(block database.Block) {
-	if len(block.TXs) > 0 && len(n.pendingTXs) > 0 {
+	if len(block.TXs) > 0 && n.pendingTXs.len() > 0 {
 		fmt.Println("Updating in-memory Pending TXs Pool:")
 	}
 
 	for _, tx := range block.TXs {
 		txHash, _ := tx.Hash()
-		if _, exists := n.pendingTXs[txHash.Hex()]; exists {
+		if n.pendingTXs.remove(txHash) {
 			fmt.Printf("\t-archiving mined TX: %s\n", txHash.Hex())
 
-			n.archivedTXs[txHash.Hex()] = tx
-			delete(n.pendingTXs, txHash.Hex())
+			n.archivedTXs.add(txHash)
 		}
 	}
 }
 
+// ConfigureMempool changes the max number of pending TXs and how long a TX can stay pending, 0 disables the limit.
+func (n *Node) ConfigureMempool(maxSize int, ttl time.Duration) {
+	n.pendingTXs.maxSize = maxSize
+	n.pendingTXs.ttl = ttl
+}
+
+// ChangeMiningDifficulty changes the static difficulty of the blocks before the TIP5 fork.
 func (n *Node) ChangeMiningDifficulty(newDifficulty uint) {
 	n.miningDifficulty = newDifficulty
 	n.state.ChangeMiningDifficulty(newDifficulty)
@@ -315,52 +411,295 @@ func (n *Node) AddPendingTX(tx database.SignedTx, fromPeer PeerNode) error {
 		return err
 	}
 
+	_, isAlreadyPending := n.pendingTXs.get(txHash)
+	if isAlreadyPending || n.archivedTXs.has(txHash) {
+		return nil
+	}
+
+	if replacedHash, replaced, ok := n.pendingTXs.findByNonce(tx.From, tx.Nonce); ok {
+		return n.replacePendingTX(replacedHash, replaced, txHash, tx)
+	}
+
+	if tx.Nonce > n.pendingState.GetNextAccountNonce(tx.From) {
+		return n.queueTX(txHash, tx, fromPeer)
+	}
+
 	err = n.validateTxBeforeAddingToMempool(tx)
 	if err != nil {
 		return err
 	}
 
-	_, isAlreadyPending := n.pendingTXs[txHash.Hex()]
-	_, isArchived := n.archivedTXs[txHash.Hex()]
+	isEvicted := false
+	if n.pendingTXs.isFull() {
+		evictedHash, evicted, ok := n.pendingTXs.evictionCandidate(n.state, tx.From)
+		if !ok || comparePrice(n.state.ChainConfig(), n.state.NextBlockNumber(), tx, evicted) <= 0 {
+			// Reverts the TX applied by the validation
+			n.resetPendingState()
+
+			return fmt.Errorf("mempool is full. TX must pay a higher gas price than the cheapest pending TX")
+		}
+
+		n.pendingTXs.remove(evictedHash)
+		isEvicted = true
+		fmt.Printf("Evicted Pending TX %s paying the lowest gas price %d\n", evictedHash.Hex(), evicted.GasPrice)
+	}
+
+	n.pendingTXs.add(txHash, tx)
+	fmt.Printf("Added Pending TX %s from Peer %s\n", txJson, fromPeer.TcpAddress())
+	n.journalTX(tx)
+	n.notifyPendingTX(tx)
 
-	if !isAlreadyPending && !isArchived {
-		fmt.Printf("Added Pending TX %s from Peer %s\n", txJson, fromPeer.TcpAddress())
-		n.pendingTXs[txHash.Hex()] = tx
-		n.newPendingTXs <- tx
+	if isEvicted {
+		n.resetPendingState()
+	} else {
+		n.promoteQueuedTXs()
 	}
 
 	return nil
 }
 
-// addBlock is a wrapper around the n.state.AddBlock() to have a single function for changing the main state
-// from the Node perspective, so we can also reset the pending state in the same time.
-func (n *Node) addBlock(block database.Block) error {
-	_, err := n.state.AddBlock(block)
+// queueTX holds a TX with a nonce gap after its sender pending TXs until the missing TXs arrive.
+func (n *Node) queueTX(txHash database.Hash, tx database.SignedTx, fromPeer PeerNode) error {
+	// Validates the TX as if the missing TXs were already pending
+	queueState := n.pendingState.Copy()
+	queueState.Account2Nonce[tx.From] = tx.Nonce - 1
+
+	err := database.ValidateTx(tx, &queueState)
+	if err != nil {
+		return err
+	}
+
+	err = n.pendingTXs.queue(txHash, tx)
 	if err != nil {
 		return err
 	}
 
-	// Reset the pending state
+	fmt.Printf("Queued TX %s with future nonce '%d' from Peer %s\n", txHash.Hex(), tx.Nonce, fromPeer.TcpAddress())
+	n.journalTX(tx)
+
+	return nil
+}
+
+// promoteQueuedTXs moves the queued TXs continuing their sender pending nonces to the pending TXs.
+func (n *Node) promoteQueuedTXs() {
+	for _, sender := range n.pendingTXs.queuedSenders() {
+		for !n.pendingTXs.isFull() {
+			txHash, tx, ok := n.pendingTXs.takeQueued(sender, n.pendingState.GetNextAccountNonce(sender))
+			if !ok {
+				break
+			}
+
+			err := database.ApplyTx(tx, n.pendingState)
+			if err != nil {
+				fmt.Printf("Queued TX %s dropped. %s\n", txHash.Hex(), err)
+				break
+			}
+
+			n.pendingTXs.add(txHash, tx)
+			fmt.Printf("Promoted queued TX %s\n", txHash.Hex())
+			n.notifyPendingTX(tx)
+		}
+	}
+}
+
+// replacePendingTX replaces a pending TX by a TX with the same sender and nonce paying a higher gas price.
+func (n *Node) replacePendingTX(replacedHash database.Hash, replaced database.SignedTx, txHash database.Hash, tx database.SignedTx) error {
+	minGasPrice := replaced.GasPrice * (100 + mempoolPriceBumpPercent) / 100
+	if minGasPrice <= replaced.GasPrice {
+		minGasPrice = replaced.GasPrice + 1
+	}
+
+	if tx.GasPrice < minGasPrice {
+		return fmt.Errorf("TX with nonce '%d' is already pending. A replacement must pay a gas price of at least %d", tx.Nonce, minGasPrice)
+	}
+
+	// The replacement follows the sender earlier pending TXs
+	senderState := n.state.Copy()
+	senderTXs := make([]database.SignedTx, 0)
+	for _, pendingTx := range n.pendingTXs.list() {
+		if pendingTx.From == tx.From && pendingTx.Nonce < tx.Nonce {
+			senderTXs = append(senderTXs, pendingTx)
+		}
+	}
+	database.SortBlockTXs(senderTXs)
+
+	for _, pendingTx := range senderTXs {
+		err := database.ApplyTx(pendingTx, &senderState)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := database.ApplyTx(tx, &senderState)
+	if err != nil {
+		return err
+	}
+
+	n.pendingTXs.remove(replacedHash)
+	n.pendingTXs.add(txHash, tx)
+	fmt.Printf("Replaced Pending TX %s with %s paying gas price %d\n", replacedHash.Hex(), txHash.Hex(), tx.GasPrice)
+	n.journalTX(tx)
+	n.notifyPendingTX(tx)
+
+	// The sender next TXs may no longer be affordable with the higher gas price
+	n.resetPendingState()
+
+	return nil
+}
+
+// notifyPendingTX doesn't block when nobody keeps up with the new pending TXs.
+func (n *Node) notifyPendingTX(tx database.SignedTx) {
+	select {
+	case n.newPendingTXs <- tx:
+	default:
+	}
+}
+
+// expirePendingTXs drops the TXs pending for longer than the mempool TTL.
+func (n *Node) expirePendingTXs() {
+	expired := n.pendingTXs.expire()
+	for _, tx := range expired {
+		txHash, _ := tx.Hash()
+		fmt.Printf("Pending TX %s expired\n", txHash.Hex())
+	}
+
+	if len(expired) > 0 {
+		n.resetPendingState()
+		n.rotateJournal()
+	}
+}
+
+// loadJournaledTXs re-adds the TXs pending before the node stopped, except those mined in the meantime,
+// and rotates the journal to the TXs still valid.
+func (n *Node) loadJournaledTXs() error {
+	txs, err := n.journal.load()
+	if err != nil {
+		return err
+	}
+
+	database.SortBlockTXs(txs)
+
+	for _, tx := range txs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			continue
+		}
+
+		_, isMined, err := database.GetMinedTx(n.state, txHash)
+		if err != nil {
+			return err
+		}
+
+		if isMined {
+			continue
+		}
+
+		err = n.AddPendingTX(tx, n.info)
+		if err != nil {
+			fmt.Printf("Journaled TX %s dropped. %s\n", txHash.Hex(), err)
+		}
+	}
+
+	if len(txs) > 0 {
+		fmt.Printf("Loaded %d of %d journaled TXs\n", n.pendingTXs.len()+n.pendingTXs.queuedLen(), len(txs))
+	}
+
+	return n.journal.rotate(n.pendingTXs.all())
+}
+
+// journalTX persists the accepted TX, the TX stays pending even if the journal can't be written.
+func (n *Node) journalTX(tx database.SignedTx) {
+	err := n.journal.insert(tx)
+	if err != nil {
+		fmt.Printf("ERROR: journaling pending TX failed. %s\n", err)
+	}
+}
+
+// rotateJournal drops the TXs no longer pending from the journal.
+func (n *Node) rotateJournal() {
+	err := n.journal.rotate(n.pendingTXs.all())
+	if err != nil {
+		fmt.Printf("ERROR: rotating the mempool journal failed. %s\n", err)
+	}
+}
+
+// resetPendingState rebuilds the pending state from the main state and the pending TXs, in the order blocks apply them.
+//
+// Pending TXs no longer valid on top of the main state are dropped, e.g. TXs mined by a peer.
+func (n *Node) resetPendingState() {
 	pendingState := n.state.Copy()
+
+	txs := n.pendingTXs.list()
+	database.SortBlockTXs(txs)
+
+	for _, tx := range txs {
+		err := database.ApplyTx(tx, &pendingState)
+		if err == nil {
+			continue
+		}
+
+		txHash, _ := tx.Hash()
+		n.pendingTXs.remove(txHash)
+
+		// A TX following an expired, or evicted, TX waits in the queue for a new TX with the missing nonce
+		if tx.Nonce > pendingState.GetNextAccountNonce(tx.From) && n.pendingTXs.queue(txHash, tx) == nil {
+			continue
+		}
+
+		if tx.Nonce < pendingState.GetNextAccountNonce(tx.From) {
+			// Mined by a peer
+			n.archivedTXs.add(txHash)
+			continue
+		}
+
+		fmt.Printf("Pending TX %s dropped. %s\n", txHash.Hex(), err)
+	}
+
 	n.pendingState = &pendingState
 
+	n.promoteQueuedTXs()
+}
+
+// addBlock is a wrapper around the n.state.ImportBlock() to have a single function for changing the main state
+// from the Node perspective, so we can also reset the pending state in the same time.
+func (n *Node) addBlock(block database.Block) error {
+	_, orphanedTXs, err := n.state.ImportBlock(block)
+	if err != nil {
+		return err
+	}
+
+	n.resetPendingState()
+
+	n.restoreOrphanedTXs(orphanedTXs)
+	n.rotateJournal()
+
 	return nil
 }
 
+// restoreOrphanedTXs re-adds TXs from blocks abandoned during a chain reorganization back to the mempool.
+func (n *Node) restoreOrphanedTXs(txs []database.SignedTx) {
+	for _, tx := range txs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			continue
+		}
+
+		n.archivedTXs.remove(txHash)
+
+		err = n.AddPendingTX(tx, n.info)
+		if err != nil {
+			fmt.Printf("Orphaned TX %s dropped. %s\n", txHash.Hex(), err)
+		}
+	}
+}
+
 // validateTxBeforeAddingToMempool ensures the TX is authentic, with correct nonce, and the sender has sufficient
 // funds so we waste PoW resources on TX we can tell in advance are wrong.
 func (n *Node) validateTxBeforeAddingToMempool(tx database.SignedTx) error {
 	return database.ApplyTx(tx, n.pendingState)
 }
 
+// getPendingTXsAsArray returns the pending TXs paying the highest fee per gas first, each sender TXs in nonce order.
 func (n *Node) getPendingTXsAsArray() []database.SignedTx {
-	txs := make([]database.SignedTx, len(n.pendingTXs))
-
-	i := 0
-	for _, tx := range n.pendingTXs {
-		txs[i] = tx
-		i++
-	}
-
-	return txs
+	return n.pendingTXs.byPrice(n.state)
 }
@@ -104,7 +104,7 @@ func TestNode_Mining(t *testing.T) {
 		time.Sleep(time.Second * miningIntervalSeconds / 3)
 
 		tx := database.NewBaseTx(andrej, babaYaga, 1, 1, "")
-		signedTx, err := wallet.SignTxWithKeystoreAccount(tx, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+		signedTx, err := wallet.SignTxWithKeystoreAccount(tx, "", andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
 		if err != nil {
 			t.Error(err)
 			return
@@ -119,7 +119,7 @@ func TestNode_Mining(t *testing.T) {
 		time.Sleep(time.Second*(miningIntervalSeconds/3) + 1)
 
 		tx := database.NewBaseTx(babaYaga, andrej, 50, 1, "")
-		signedTx, err := wallet.SignTxWithKeystoreAccount(tx, babaYaga, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+		signedTx, err := wallet.SignTxWithKeystoreAccount(tx, "", babaYaga, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
 		if err != nil {
 			t.Error(err)
 			return
@@ -139,7 +139,7 @@ func TestNode_Mining(t *testing.T) {
 		time.Sleep(time.Second * (miningIntervalSeconds + 2))
 
 		tx := database.NewBaseTx(andrej, babaYaga, 2, 2, "")
-		signedTx, err := wallet.SignTxWithKeystoreAccount(tx, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+		signedTx, err := wallet.SignTxWithKeystoreAccount(tx, "", andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
 		if err != nil {
 			t.Error(err)
 			return
@@ -195,7 +195,7 @@ func TestNode_ForgedTx(t *testing.T) {
 	txNonce := uint(1)
 	tx := database.NewBaseTx(andrej, babaYaga, txValue, txNonce, "")
 
-	validSignedTx, err := wallet.SignTxWithKeystoreAccount(tx, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+	validSignedTx, err := wallet.SignTxWithKeystoreAccount(tx, "", andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
 	if err != nil {
 		t.Error(err)
 		closeNode()
@@ -258,7 +258,7 @@ func TestNode_ForgedTx(t *testing.T) {
 		t.Fatal("was suppose to mine only one TX. The second TX was forged")
 	}
 
-	if n.state.Balances[babaYaga] != txValue {
+	if n.state.Balances[babaYaga].Uint64() != uint64(txValue) {
 		t.Fatal("forged tx succeeded")
 	}
 }
@@ -284,7 +284,7 @@ func TestNode_ReplayedTx(t *testing.T) {
 	txNonce := uint(1)
 	tx := database.NewBaseTx(andrej, babaYaga, txValue, txNonce, "")
 
-	signedTx, err := wallet.SignTxWithKeystoreAccount(tx, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+	signedTx, err := wallet.SignTxWithKeystoreAccount(tx, "", andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
 	if err != nil {
 		t.Error(err)
 		closeNode()
@@ -320,7 +320,7 @@ func TestNode_ReplayedTx(t *testing.T) {
 					// Execute the attack by replaying the TX again!
 					if !wasReplayedTxAdded {
 						// Simulate the TX was submitted to different node
-						n.archivedTXs = make(map[string]database.SignedTx)
+						n.archivedTXs, _ = newRecentTxCache(archivedTXsCacheSize)
 						// Execute the attack
 						err = n.AddPendingTX(signedTx, babaYagaPeerNode)
 						t.Log(err)
@@ -341,12 +341,12 @@ func TestNode_ReplayedTx(t *testing.T) {
 
 	_ = n.Run(ctx, true, "")
 
-	if n.state.Balances[babaYaga] == txValue*2 {
+	if n.state.Balances[babaYaga].Uint64() == uint64(txValue*2) {
 		t.Errorf("replayed attack was successful :( Damn digital signatures!")
 		return
 	}
 
-	if n.state.Balances[babaYaga] != txValue {
+	if n.state.Balances[babaYaga].Uint64() != uint64(txValue) {
 		t.Errorf("replayed attack was successful :( Damn digital signatures!")
 		return
 	}
@@ -427,13 +427,13 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 				tx2.GasPrice = 0
 			}
 
-			signedTx1, err := wallet.SignTxWithKeystoreAccount(tx1, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+			signedTx1, err := wallet.SignTxWithKeystoreAccount(tx1, "", andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
 			if err != nil {
 				t.Error(err)
 				return
 			}
 
-			signedTx2, err := wallet.SignTxWithKeystoreAccount(tx2, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+			signedTx2, err := wallet.SignTxWithKeystoreAccount(tx2, "", andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
 			if err != nil {
 				t.Error(err)
 				return
@@ -494,9 +494,9 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 				}
 
 				// Mined TX1 by Andrej should be removed from the Mempool
-				_, onlyTX2IsPending := n.pendingTXs[tx2Hash.Hex()]
+				_, onlyTX2IsPending := n.pendingTXs.get(tx2Hash)
 
-				if len(n.pendingTXs) != 1 && !onlyTX2IsPending {
+				if n.pendingTXs.len() != 1 && !onlyTX2IsPending {
 					t.Fatal("synced block should have canceled mining of already mined TX")
 				}
 			}()
@@ -522,15 +522,15 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 				// Take a snapshot of the DB balances
 				// before the mining is finished and the 2 blocks
 				// are created.
-				startingAndrejBalance := n.state.Balances[andrej]
-				startingBabaYagaBalance := n.state.Balances[babaYaga]
+				startingAndrejBalance := uint(n.state.Balances[andrej].Uint64())
+				startingBabaYagaBalance := uint(n.state.Balances[babaYaga].Uint64())
 
 				// Wait until the 30 mins timeout is reached or
 				// the 2 blocks got already mined and the closeNode() was triggered
 				<-ctx.Done()
 
-				endAndrejBalance := n.state.Balances[andrej]
-				endBabaYagaBalance := n.state.Balances[babaYaga]
+				endAndrejBalance := uint(n.state.Balances[andrej].Uint64())
+				endBabaYagaBalance := uint(n.state.Balances[babaYaga].Uint64())
 
 				// In TX1 Andrej transferred 1 TBB token to BabaYaga
 				// In TX2 Andrej transferred 2 TBB tokens to BabaYaga
@@ -541,7 +541,7 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 				// Andrej will occur the cost of SENDING 2 TXs but will collect the reward for mining one block with tx1 in it
 				// BabaYaga will RECEIVE value from 2 TXs and will also collect the reward for mining one block with tx2 in it
 
-				if n.state.IsTIP1Fork() {
+				if n.state.IsForkActive(database.ForkTIP1) {
 					expectedEndAndrejBalance = startingAndrejBalance - tx1.Cost(true) - tx2.Cost(true) + database.BlockReward + tx1.GasCost()
 					expectedEndBabaYagaBalance = startingBabaYagaBalance + tx1.Value + tx2.Value + database.BlockReward + tx2.GasCost()
 				} else {
@@ -569,7 +569,7 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 				t.Fatal("was suppose to mine 2 pending TX into 2 valid blocks under 30m")
 			}
 
-			if len(n.pendingTXs) != 0 {
+			if n.pendingTXs.len() != 0 {
 				t.Fatal("no pending TXs should be left to mine")
 			}
 		})
@@ -627,7 +627,7 @@ func TestNode_MiningSpamTransactions(t *testing.T) {
 						tx.GasPrice = 0
 					}
 
-					signedTx, err := wallet.SignTxWithKeystoreAccount(tx, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+					signedTx, err := wallet.SignTxWithKeystoreAccount(tx, "", andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
 					if err != nil {
 						t.Fatal(err)
 					}
@@ -665,7 +665,7 @@ func TestNode_MiningSpamTransactions(t *testing.T) {
 			var expectedMinerBalance uint
 
 			// in nutshell: sender occurs tx.Cost(), receiver gains tx.Value() and miner collects tx.GasCost()
-			if n.state.IsTIP1Fork() {
+			if n.state.IsForkActive(database.ForkTIP1) {
 				expectedAndrejBalance = andrejBalance
 				expectedMinerBalance = minerBalance + database.BlockReward
 
@@ -681,21 +681,21 @@ func TestNode_MiningSpamTransactions(t *testing.T) {
 				expectedMinerBalance = minerBalance + database.BlockReward + (txCount * database.TxFee)
 			}
 
-			if n.state.Balances[andrej] != expectedAndrejBalance {
-				t.Errorf("Andrej balance is incorrect. Expected: %d. Got: %d", expectedAndrejBalance, n.state.Balances[andrej])
+			if n.state.Balances[andrej].Uint64() != uint64(expectedAndrejBalance) {
+				t.Errorf("Andrej balance is incorrect. Expected: %d. Got: %s", expectedAndrejBalance, n.state.Balances[andrej])
 			}
 
-			if n.state.Balances[babaYaga] != expectedBabaYagaBalance {
-				t.Errorf("BabaYaga balance is incorrect. Expected: %d. Got: %d", expectedBabaYagaBalance, n.state.Balances[babaYaga])
+			if n.state.Balances[babaYaga].Uint64() != uint64(expectedBabaYagaBalance) {
+				t.Errorf("BabaYaga balance is incorrect. Expected: %d. Got: %s", expectedBabaYagaBalance, n.state.Balances[babaYaga])
 			}
 
-			if n.state.Balances[miner] != expectedMinerBalance {
-				t.Errorf("Miner balance is incorrect. Expected: %d. Got: %d", expectedMinerBalance, n.state.Balances[miner])
+			if n.state.Balances[miner].Uint64() != uint64(expectedMinerBalance) {
+				t.Errorf("Miner balance is incorrect. Expected: %d. Got: %s", expectedMinerBalance, n.state.Balances[miner])
 			}
 
-			t.Logf("Andrej final balance: %d TBB", n.state.Balances[andrej])
-			t.Logf("BabaYaga final balance: %d TBB", n.state.Balances[babaYaga])
-			t.Logf("Miner final balance: %d TBB", n.state.Balances[miner])
+			t.Logf("Andrej final balance: %s TBB", n.state.Balances[andrej])
+			t.Logf("BabaYaga final balance: %s TBB", n.state.Balances[babaYaga])
+			t.Logf("Miner final balance: %s TBB", n.state.Balances[miner])
 		})
 	}
 }
@@ -17,6 +17,7 @@ package node
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -90,47 +91,101 @@ func (n *Node) doSync() {
 }
 
 func (n *Node) syncBlocks(peer PeerNode, status StatusRes) error {
-	localBlockNumber := n.state.LatestBlock().Header.Number
-
 	// If the peer has no blocks, ignore it
 	if status.Hash.IsEmpty() {
 		return nil
 	}
 
-	// If the peer has less blocks than us, ignore it
-	if status.Number < localBlockNumber {
+	// If we already know the peer's latest block, there is nothing new to sync
+	if n.state.IsKnownBlock(status.Hash) {
 		return nil
 	}
 
-	// If it's the genesis block and we already synced it, ignore it
-	if status.Number == 0 && !n.state.LatestBlockHash().IsEmpty() {
+	// If the peer's chain isn't heavier than ours, ignore it
+	if !n.isPeerChainHeavier(status) {
 		return nil
 	}
 
-	// Display found 1 new block if we sync the genesis block 0
-	newBlocksCount := status.Number - localBlockNumber
-	if localBlockNumber == 0 && status.Number == 0 {
-		newBlocksCount = 1
-	}
-	fmt.Printf("Found %d new blocks from Peer %s\n", newBlocksCount, peer.TcpAddress())
-
-	blocks, err := fetchBlocksFromPeer(peer, n.state.LatestBlockHash())
+	blocks, err := n.fetchMissingBlocksFromPeer(peer)
 	if err != nil {
 		return err
 	}
 
+	fmt.Printf("Found %d new blocks from Peer %s\n", len(blocks), peer.TcpAddress())
+
 	for _, block := range blocks {
-		err = n.addBlock(block)
+		blockHash, err := block.Hash()
 		if err != nil {
 			return err
 		}
 
+		if n.state.IsKnownBlock(blockHash) {
+			continue
+		}
+
+		err = n.addBlock(block)
+		if errors.Is(err, database.ErrBlockTimeInFuture) {
+			// The block may become valid later, retry on a next sync once the node clock catches up
+			return fmt.Errorf("postponing block %d '%x' from Peer %s: %s", block.Header.Number, blockHash, peer.TcpAddress(), err)
+		}
+		if err != nil {
+			return fmt.Errorf("rejected block %d '%x' from Peer %s: %s", block.Header.Number, blockHash, peer.TcpAddress(), err)
+		}
+
 		n.newSyncedBlocks <- block
 	}
 
 	return nil
 }
 
+func (n *Node) isPeerChainHeavier(status StatusRes) bool {
+	if n.state.LatestBlockHash().IsEmpty() {
+		return true
+	}
+
+	// Peers running an older version don't report their chain work, compare the chain length instead
+	if status.TotalWork == nil {
+		return status.Number > n.state.LatestBlock().Header.Number
+	}
+
+	return status.TotalWork.Cmp(n.state.TotalWork()) > 0
+}
+
+// fetchMissingBlocksFromPeer downloads the peer's blocks after the latest block both nodes have in common.
+//
+// If our latest block isn't part of the peer's chain, the peer returns no blocks and we step back
+// with exponentially growing steps until a common ancestor, or the genesis, is found.
+func (n *Node) fetchMissingBlocksFromPeer(peer PeerNode) ([]database.Block, error) {
+	fromBlock := n.state.LatestBlockHash()
+	fromHeight := n.state.LatestBlock().Header.Number
+	step := uint64(1)
+
+	for {
+		blocks, err := fetchBlocksFromPeer(peer, fromBlock)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(blocks) > 0 || fromBlock.IsEmpty() {
+			return blocks, nil
+		}
+
+		if fromHeight < step {
+			fromBlock = database.Hash{}
+			continue
+		}
+
+		fromHeight -= step
+		step *= 2
+
+		block, err := database.GetBlockByHeightOrHash(n.state, fromHeight, "")
+		if err != nil {
+			return nil, err
+		}
+		fromBlock = block.Key
+	}
+}
+
 func (n *Node) syncKnownPeers(status StatusRes) error {
 	for _, statusPeer := range status.KnownPeers {
 		if !n.IsKnownPeer(statusPeer) {
@@ -143,14 +198,23 @@ func (n *Node) syncKnownPeers(status StatusRes) error {
 	return nil
 }
 
+// syncPendingTXs adds all the peer pending TXs it can, a rejected TX doesn't stop the others.
 func (n *Node) syncPendingTXs(peer PeerNode, txs []database.SignedTx) error {
+	rejected := 0
+	var lastErr error
+
 	for _, tx := range txs {
 		err := n.AddPendingTX(tx, peer)
 		if err != nil {
-			return err
+			rejected++
+			lastErr = err
 		}
 	}
 
+	if rejected > 0 {
+		return fmt.Errorf("%d of %d pending TXs from Peer %s rejected. Last error: %s", rejected, len(txs), peer.TcpAddress(), lastErr)
+	}
+
 	return nil
 }
 
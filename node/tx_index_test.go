@@ -0,0 +1,136 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/database"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Andrej mines 2 blocks, the TX of the 1st block has 2 confirmations
+//   - A TX in the mempool is pending, a random hash is unknown
+//   - The TX is still found after a restart and after the index is deleted and rebuilt from the blocks
+func TestTxStatus(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := database.NewAccount(testKsBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	n := New(dataDir, "127.0.0.1", 8085, andrej, PeerNode{}, nodeVersion, defaultTestMiningDifficulty)
+
+	state, err := database.NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.state = state
+
+	minedTx := signTestTx(t, andrejKey, andrej, babaYaga, 1, 1)
+	block0Hash, err := state.AddBlock(mineTestBlock(t, state, andrej, minedTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = state.AddBlock(mineTestBlock(t, state, andrej, signTestTx(t, andrejKey, andrej, babaYaga, 1, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pendingTx := signTestTx(t, andrejKey, andrej, babaYaga, 1, 3)
+	pendingTxHash, err := pendingTx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.pendingTXs.add(pendingTxHash, pendingTx)
+
+	minedTxHash, err := minedTx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getTx := func(txHash database.Hash) TxRes {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/tx/"+txHash.Hex(), nil)
+		txHandler(rr, req, n)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d %s", rr.Code, rr.Body.String())
+		}
+
+		var res TxRes
+		err := json.NewDecoder(rr.Body).Decode(&res)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return res
+	}
+
+	assertMined := func() {
+		res := getTx(minedTxHash)
+		if res.Status != TxStatusMined || res.Tx == nil || res.Tx.Value != minedTx.Value {
+			t.Fatalf("TX %x should be mined, got status %s", minedTxHash, res.Status)
+		}
+
+		if *res.BlockHash != block0Hash || *res.BlockHeight != 0 || res.Confirmations != 2 {
+			t.Errorf("TX %x should be mined in block %x at height 0 with 2 confirmations, got %x at %d with %d", minedTxHash, block0Hash, *res.BlockHash, *res.BlockHeight, res.Confirmations)
+		}
+	}
+
+	assertMined()
+
+	if res := getTx(pendingTxHash); res.Status != TxStatusPending || res.Tx == nil {
+		t.Errorf("TX %x should be pending, got status %s", pendingTxHash, res.Status)
+	}
+
+	if res := getTx(database.Hash{}); res.Status != TxStatusUnknown || res.Tx != nil {
+		t.Errorf("unknown TX should have unknown status, got status %s", res.Status)
+	}
+
+	_ = state.Close()
+
+	for _, removeIndex := range []bool{false, true} {
+		if removeIndex {
+			err = os.RemoveAll(filepath.Join(dataDir, "database", "index"))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		n.state, err = database.NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertMined()
+		_ = n.state.Close()
+	}
+}
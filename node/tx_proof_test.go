@@ -0,0 +1,108 @@
+// Copyright 2020 The the-blockchain-bar Authors
+// This file is part of the the-blockchain-bar library.
+//
+// The the-blockchain-bar library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The the-blockchain-bar library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/web3coach/the-blockchain-bar/database"
+	"github.com/web3coach/the-blockchain-bar/fs"
+)
+
+// The test logic summary:
+//   - Andrej mines a block with 3 TXs committed by the header TX root
+//   - The proof of every TX served by /tx/{hash}/proof must verify against the header TX root
+//   - A proof for a different TX must not verify
+func TestTxProof(t *testing.T) {
+	andrejKey, _, andrej, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	babaYaga := database.NewAccount(testKsBabaYagaAccount)
+
+	dataDir, err := setupTestGenesisDir(map[common.Address]uint{andrej: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(dataDir)
+
+	n := New(dataDir, "127.0.0.1", 8085, andrej, PeerNode{}, nodeVersion, defaultTestMiningDifficulty)
+
+	state, err := database.NewStateFromDisk(dataDir, defaultTestMiningDifficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+	n.state = state
+
+	txs := []database.SignedTx{
+		signTestTx(t, andrejKey, andrej, babaYaga, 1, 1),
+		signTestTx(t, andrejKey, andrej, babaYaga, 2, 2),
+		signTestTx(t, andrejKey, andrej, babaYaga, 3, 3),
+	}
+
+	block := mineTestBlock(t, state, andrej, txs...)
+	blockHash, err := state.AddBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tx := range txs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/tx/"+txHash.Hex()+"/proof", nil)
+		txHandler(rr, req, n)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d %s", rr.Code, rr.Body.String())
+		}
+
+		var proof database.TxProof
+		err = json.NewDecoder(rr.Body).Decode(&proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if proof.BlockHash != blockHash || proof.TxRoot != *block.Header.TxRoot {
+			t.Errorf("proof must point to block %x with TX root %x", blockHash, *block.Header.TxRoot)
+		}
+
+		if !database.VerifyTxProof(proof) {
+			t.Errorf("proof of TX %x should be valid", txHash)
+		}
+
+		proof.TxHash = database.Hash{}
+		if database.VerifyTxProof(proof) {
+			t.Errorf("proof of TX %x must not verify a different TX", txHash)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/tx/"+database.Hash{}.Hex()+"/proof", nil)
+	txHandler(rr, req, n)
+
+	if rr.Code == http.StatusOK {
+		t.Errorf("proof of an unknown TX should fail")
+	}
+}
@@ -46,32 +46,49 @@ func NewKeystoreAccount(dataDir, password string) (common.Address, error) {
 	return acc.Address, nil
 }
 
-func SignTxWithKeystoreAccount(tx database.Tx, acc common.Address, pwd, keystoreDir string) (database.SignedTx, error) {
-	ks := keystore.NewKeyStore(keystoreDir, keystore.StandardScryptN, keystore.StandardScryptP)
-	ksAccount, err := ks.Find(accounts.Account{Address: acc})
+func SignTxWithKeystoreAccount(tx database.Tx, chainID string, acc common.Address, pwd, keystoreDir string) (database.SignedTx, error) {
+	key, err := decryptKeystoreAccount(acc, pwd, keystoreDir)
 	if err != nil {
 		return database.SignedTx{}, err
 	}
 
-	ksAccountJson, err := ioutil.ReadFile(ksAccount.URL.Path)
+	signedTx, err := SignTx(tx, chainID, key.PrivateKey)
 	if err != nil {
 		return database.SignedTx{}, err
 	}
 
-	key, err := keystore.DecryptKey(ksAccountJson, pwd)
+	return signedTx, nil
+}
+
+// CosignTxWithKeystoreAccount adds the signature of the keystore account to the multisig spend TX, see CosignTx.
+func CosignTxWithKeystoreAccount(tx database.SignedTx, acc common.Address, pwd, keystoreDir string) (database.SignedTx, error) {
+	key, err := decryptKeystoreAccount(acc, pwd, keystoreDir)
 	if err != nil {
 		return database.SignedTx{}, err
 	}
 
-	signedTx, err := SignTx(tx, key.PrivateKey)
+	return CosignTx(tx, key.PrivateKey)
+}
+
+func decryptKeystoreAccount(acc common.Address, pwd, keystoreDir string) (*keystore.Key, error) {
+	ks := keystore.NewKeyStore(keystoreDir, keystore.StandardScryptN, keystore.StandardScryptP)
+	ksAccount, err := ks.Find(accounts.Account{Address: acc})
+	if err != nil {
+		return nil, err
+	}
+
+	ksAccountJson, err := ioutil.ReadFile(ksAccount.URL.Path)
 	if err != nil {
-		return database.SignedTx{}, err
+		return nil, err
 	}
 
-	return signedTx, nil
+	return keystore.DecryptKey(ksAccountJson, pwd)
 }
 
-func SignTx(tx database.Tx, privKey *ecdsa.PrivateKey) (database.SignedTx, error) {
+// SignTx signs the TX for the given chain. Pass an empty chain ID to sign for chains before the TIP4 fork.
+func SignTx(tx database.Tx, chainID string, privKey *ecdsa.PrivateKey) (database.SignedTx, error) {
+	tx.ChainID = chainID
+
 	rawTx, err := tx.Encode()
 	if err != nil {
 		return database.SignedTx{}, err
@@ -85,6 +102,40 @@ func SignTx(tx database.Tx, privKey *ecdsa.PrivateKey) (database.SignedTx, error
 	return database.NewSignedTx(tx, sig), nil
 }
 
+// CosignTx adds the signer signature to the multisig spend TX, partially signed until enough signers co-signed it.
+func CosignTx(tx database.SignedTx, privKey *ecdsa.PrivateKey) (database.SignedTx, error) {
+	if tx.Type != database.TxTypeMultisigSpend {
+		return database.SignedTx{}, fmt.Errorf("only multisig spend TXs are co-signed, not TXs of type %d", tx.Type)
+	}
+
+	signer := crypto.PubkeyToAddress(privKey.PublicKey)
+
+	cosigners, err := tx.Cosigners()
+	if err != nil {
+		return database.SignedTx{}, err
+	}
+
+	for _, cosigner := range cosigners {
+		if cosigner == signer {
+			return database.SignedTx{}, fmt.Errorf("account %s already signed the TX", signer.Hex())
+		}
+	}
+
+	rawTx, err := tx.Tx.Encode()
+	if err != nil {
+		return database.SignedTx{}, err
+	}
+
+	sig, err := Sign(rawTx, privKey)
+	if err != nil {
+		return database.SignedTx{}, err
+	}
+
+	tx.Sigs = append(append(make([][]byte, 0, len(tx.Sigs)+1), tx.Sigs...), sig)
+
+	return tx, nil
+}
+
 func Sign(msg []byte, privKey *ecdsa.PrivateKey) (sig []byte, err error) {
 	msgHash := sha256.Sum256(msg)
 
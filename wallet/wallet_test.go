@@ -140,7 +140,7 @@ func TestSignTxWithKeystoreAccount(t *testing.T) {
 
 	tx := database.NewBaseTx(andrej, babaYaga, 100, 1, "")
 
-	signedTx, err := SignTxWithKeystoreAccount(tx, andrej, testKeystoreAccountsPwd, GetKeystoreDirPath(tmpDir))
+	signedTx, err := SignTxWithKeystoreAccount(tx, "", andrej, testKeystoreAccountsPwd, GetKeystoreDirPath(tmpDir))
 	if err != nil {
 		t.Error(err)
 		return
@@ -195,7 +195,7 @@ func TestSignForgedTxWithKeystoreAccount(t *testing.T) {
 
 	forgedTx := database.NewBaseTx(babaYaga, hacker, 100, 1, "")
 
-	signedTx, err := SignTxWithKeystoreAccount(forgedTx, hacker, testKeystoreAccountsPwd, GetKeystoreDirPath(tmpDir))
+	signedTx, err := SignTxWithKeystoreAccount(forgedTx, "", hacker, testKeystoreAccountsPwd, GetKeystoreDirPath(tmpDir))
 	if err != nil {
 		t.Error(err)
 		return
@@ -211,3 +211,61 @@ func TestSignForgedTxWithKeystoreAccount(t *testing.T) {
 		t.Fatal("the TX 'from' attribute was forged and should have not be authentic")
 	}
 }
+
+func TestCosignTxWithKeystoreAccount(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "wallet_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.RemoveDir(tmpDir)
+
+	andrej, err := NewKeystoreAccount(tmpDir, testKeystoreAccountsPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babaYaga, err := NewKeystoreAccount(tmpDir, testKeystoreAccountsPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	multisig := database.NewMultisig(2, []common.Address{andrej, babaYaga})
+	tx := database.SignedTx{Tx: database.NewMultisigSpendTx(multisig.Address(), andrej, database.TxGas, database.TxGasPriceDefault, database.AmountFromTBB(1), 1, "")}
+
+	for _, signer := range []common.Address{andrej, babaYaga} {
+		tx, err = CosignTxWithKeystoreAccount(tx, signer, testKeystoreAccountsPwd, GetKeystoreDirPath(tmpDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cosigners, err := tx.Cosigners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, []common.Address{andrej, babaYaga}, cosigners)
+
+	_, err = CosignTxWithKeystoreAccount(tx, andrej, testKeystoreAccountsPwd, GetKeystoreDirPath(tmpDir))
+	if err == nil {
+		t.Fatal("a signer must not co-sign the same TX twice")
+	}
+
+	// The partially signed TX file is JSON
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var txUnmarshaled database.SignedTx
+	err = json.Unmarshal(txJson, &txUnmarshaled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	require.Equal(t, tx, txUnmarshaled)
+
+	_, err = CosignTxWithKeystoreAccount(database.SignedTx{Tx: database.NewBaseTx(andrej, babaYaga, 1, 1, "")}, andrej, testKeystoreAccountsPwd, GetKeystoreDirPath(tmpDir))
+	if err == nil {
+		t.Fatal("only multisig spend TXs should be co-signed")
+	}
+}